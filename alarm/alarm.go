@@ -21,61 +21,86 @@
 package alarm
 
 import (
-	"bytes"
-	"encoding/json"
-	"errors"
+	"context"
 	"fmt"
-	"io/ioutil"
 	"log"
-	"net/http"
-	"os"
 	"time"
-	"unsafe"
 )
 
-/*
-#cgo CFLAGS: -I../
-#cgo LDFLAGS: -lrmr_si
-
-#include "utils.h"
-*/
-import "C"
+var _ Alarmer = (*RICAlarm)(nil)
 
 // InitAlarm is the init routine which returns a new alarm instance.
 // The MO and APP identities are given as a parameters.
 // The identities are used when raising/clearing alarms, unless provided by the applications.
-func InitAlarm(mo, id string) (*RICAlarm, error) {
+// The environment variables give the defaults, which can be overridden with options.
+func InitAlarm(mo, id string, opts ...Option) (*RICAlarm, error) {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if o.logger == nil {
+		o.logger = log.Default()
+	}
+	if o.httpClient == nil {
+		client, err := NewHTTPClient(o.httpConfig)
+		if err != nil {
+			return nil, err
+		}
+		o.httpClient = client
+	}
+
 	r := &RICAlarm{
 		moId:        mo,
 		appId:       id,
-		managerUrl:  ALARM_MANAGER_HTTP_URL,
-		rmrEndpoint: ALARM_MANAGER_RMR_URL,
+		managerUrl:  o.managerUrl,
+		rmrEndpoint: o.rmrEndpoint,
+		listenPort:  o.listenPort,
+		logger:      o.logger,
+		httpClient:  o.httpClient,
+		timeout:     o.timeout,
 	}
 
-	//
-	// http service information (used in case of no rmr connectivity)
-	//
-	if os.Getenv("ALARM_MANAGER_URL") != "" {
-		r.managerUrl = os.Getenv("ALARM_MANAGER_URL")
+	if o.transport == nil {
+		r.rmr = newRMRTransport(o.rmrConfig())
+		r.transport = NewFallbackTransport(r.rmr, newHTTPTransport(r.managerUrl, r.httpClient, o.httpConfig, r.logger))
+		go InitRMR(r)
+	} else {
+		r.rmr = findRMRTransport(o.transport)
+		r.transport = o.transport
 	}
 
-	if os.Getenv("ALARM_MANAGER_SERVICE_NAME") != "" && os.Getenv("ALARM_MANAGER_SERVICE_PORT") != "" {
-		r.rmrEndpoint = fmt.Sprintf("%s:%s", os.Getenv("ALARM_MANAGER_SERVICE_NAME"), os.Getenv("ALARM_MANAGER_SERVICE_PORT"))
+	if o.definitionsFile != "" {
+		if err := r.LoadDefinitions(o.definitionsFile); err != nil {
+			return nil, err
+		}
 	}
+	r.fetchDefs = o.fetchDefs
 
-	if os.Getenv("ALARM_IF_RMR") == "" {
-		if r.moId == "my-pod" {
-			r.rmrEndpoint = "127.0.0.1:4560"
-		} else if r.moId == "my-pod-lib" {
-			r.rmrEndpoint = "127.0.0.1:4588"
+	if o.metrics {
+		if err := r.EnableMetrics(o.registerer); err != nil {
+			return nil, err
 		}
 	}
-
-	go InitRMR(r)
+	if o.rateLimit != nil {
+		r.EnableRateLimit(*o.rateLimit)
+	}
+	if o.async != nil {
+		r.EnableAsync(*o.async)
+	}
+	if o.resync != nil {
+		r.EnableResync(*o.resync)
+	}
 
 	return r, nil
 }
 
+// InitAlarmWithTransport returns a new alarm instance which uses the given transport for delivering
+// the alarms to the alarm manager. Same as InitAlarm with WithTransport option.
+func InitAlarmWithTransport(mo, id string, t Transport) (*RICAlarm, error) {
+	return InitAlarm(mo, id, WithTransport(t))
+}
+
 // Create a new Alarm instance
 func (r *RICAlarm) NewAlarm(sp int, severity Severity, ainfo, iinfo string) Alarm {
 	return Alarm{
@@ -104,44 +129,122 @@ func (r *RICAlarm) SetApplicationId(app string) {
 
 // Raise a RIC alarm
 func (r *RICAlarm) Raise(a Alarm) error {
+	return r.RaiseContext(context.Background(), a)
+}
+
+// RaiseContext raises a RIC alarm, and gives up when the context is done
+func (r *RICAlarm) RaiseContext(ctx context.Context, a Alarm) error {
+	r.ensureDefinitions(ctx)
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
+	if err := r.validate(a, AlarmActionRaise); err != nil {
+		return err
+	}
+
+	if r.isDuplicate(a) {
+		return nil
+	}
+
+	if r.isRateLimited(a) {
+		return ErrRateLimited
+	}
+
 	m := r.NewAlarmMessage(a, AlarmActionRaise)
-	return r.sendAlarmUpdateReq(m)
+	return r.sendAlarmUpdateReq(ctx, m)
 }
 
 // Clear a RIC alarm
 func (r *RICAlarm) Clear(a Alarm) error {
+	return r.ClearContext(context.Background(), a)
+}
+
+// ClearContext clears a RIC alarm, and gives up when the context is done
+func (r *RICAlarm) ClearContext(ctx context.Context, a Alarm) error {
+	r.ensureDefinitions(ctx)
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
+	if err := r.validate(a, AlarmActionClear); err != nil {
+		return err
+	}
+
 	m := r.NewAlarmMessage(a, AlarmActionClear)
-	return r.sendAlarmUpdateReq(m)
+	return r.sendAlarmUpdateReq(ctx, m)
 }
 
-// Re-raise a RIC alarm
+// Re-raise a RIC alarm. The alarm is cleared and raised again, i.e. the alarm manager assigns a new alarm ID.
+// Use UpdateSeverity to change the severity of an active alarm.
 func (r *RICAlarm) Reraise(a Alarm) error {
+	return r.ReraiseContext(context.Background(), a)
+}
+
+// ReraiseContext re-raises a RIC alarm, and gives up when the context is done. The re-raise is rate limited
+// as a raise, i.e. if the limits are exceeded, neither the clear nor the raise is sent and the alarm stays active.
+func (r *RICAlarm) ReraiseContext(ctx context.Context, a Alarm) error {
+	r.ensureDefinitions(ctx)
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
+	if err := r.validate(a, AlarmActionRaise); err != nil {
+		return err
+	}
+
+	if r.isRateLimited(a) {
+		return ErrRateLimited
+	}
+
 	m := r.NewAlarmMessage(a, AlarmActionClear)
-	if err := r.sendAlarmUpdateReq(m); err != nil {
-		return errors.New(fmt.Sprintf("Reraise failed: %v", err))
+	if err := r.sendAlarmUpdateReq(ctx, m); err != nil {
+		return fmt.Errorf("Reraise failed: %w", err)
+	}
+
+	return r.sendAlarmUpdateReq(ctx, r.NewAlarmMessage(a, AlarmActionRaise))
+}
+
+// UpdateSeverity changes the severity and additional info of an active RIC alarm in place, i.e. the alarm
+// keeps its alarm ID. If the alarm is not active, the alarm manager raises it.
+func (r *RICAlarm) UpdateSeverity(a Alarm, severity Severity) error {
+	return r.UpdateSeverityContext(context.Background(), a, severity)
+}
+
+// UpdateSeverityContext updates the severity of a RIC alarm, and gives up when the context is done
+func (r *RICAlarm) UpdateSeverityContext(ctx context.Context, a Alarm, severity Severity) error {
+	r.ensureDefinitions(ctx)
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	a.PerceivedSeverity = severity
+	if err := r.validate(a, AlarmActionRaise); err != nil {
+		return err
+	}
+
+	if r.isDuplicate(a) {
+		return nil
 	}
 
-	return r.sendAlarmUpdateReq(r.NewAlarmMessage(a, AlarmActionRaise))
+	if r.isRateLimited(a) {
+		return ErrRateLimited
+	}
+
+	m := r.NewAlarmMessage(a, AlarmActionUpdate)
+	return r.sendAlarmUpdateReq(ctx, m)
 }
 
 // Clear all alarms raised by the application
 func (r *RICAlarm) ClearAll() error {
+	return r.ClearAllContext(context.Background())
+}
+
+// ClearAllContext clears all alarms raised by the application, and gives up when the context is done
+func (r *RICAlarm) ClearAllContext(ctx context.Context) error {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
 	a := r.NewAlarm(0, SeverityDefault, "", "")
 	m := r.NewAlarmMessage(a, AlarmActionClearAll)
 
-	return r.sendAlarmUpdateReq(m)
+	return r.sendAlarmUpdateReq(ctx, m)
 }
 
 func (r *RICAlarm) AlarmString(a AlarmMessage) string {
@@ -149,96 +252,138 @@ func (r *RICAlarm) AlarmString(a AlarmMessage) string {
 	return fmt.Sprintf(s, a.ManagedObjectId, a.ApplicationId, a.SpecificProblem, a.PerceivedSeverity, a.IdentifyingInfo)
 }
 
-func (r *RICAlarm) sendAlarmUpdateReqWithHttp(payload []byte) error {
-	url := fmt.Sprintf("%s/%s", r.managerUrl, "ric/v1/alarms")
-	resp, err := http.Post(url, "application/json", bytes.NewReader(payload))
-	if err != nil || resp == nil {
-		return fmt.Errorf("HttpError=Post failed with error: %v", err)
+// EnableAsync switches the alarm instance to asynchronous delivery. Raise, Clear, Reraise and ClearAll
+// queue the alarms and return immediately, and the alarms are sent in background with retries.
+func (r *RICAlarm) EnableAsync(cfg AsyncConfig) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.async.Load() == nil {
+		r.async.Store(newAsyncSender(cfg, func(m AlarmMessage) error {
+			return r.sendAlarm(context.Background(), m)
+		}, r.logger))
+	}
+}
+
+// Flush waits until all queued alarms are sent, or the context is done
+func (r *RICAlarm) Flush(ctx context.Context) error {
+	s := r.async.Load()
+	if s == nil {
+		return nil
 	}
-	log.Printf("Alarm posted to %s [status=%d]", url, resp.StatusCode)
-	return nil
+	return s.flush(ctx)
 }
 
-func (r *RICAlarm) sendAlarmUpdateReqWithRmr(payload []byte) error {
-	if r.rmrCtx == nil || !r.rmrReady {
-		return fmt.Errorf("RmrError=rmr not ready")
+// QueueLength returns the number of alarms waiting for asynchronous delivery
+func (r *RICAlarm) QueueLength() int {
+	s := r.async.Load()
+	if s == nil {
+		return 0
 	}
-	datap := C.CBytes(payload)
-	defer C.free(datap)
-	meid := C.CString("ric")
-	defer C.free(unsafe.Pointer(meid))
+	return s.length()
+}
 
-	if state := C.rmrSend(r.rmrCtx, RIC_ALARM_UPDATE, datap, C.int(len(payload)), meid); state != C.RMR_OK {
-		return errors.New(fmt.Sprintf("RmrError=rmrSend via %s failed with error: %d", r.rmrEndpoint, state))
+// DroppedCount returns the number of alarms dropped due to queue overflow or delivery failure
+func (r *RICAlarm) DroppedCount() uint64 {
+	s := r.async.Load()
+	if s == nil {
+		return 0
 	}
-	log.Printf("Alarm sent via rmr to %s", r.rmrEndpoint)
-	return nil
+	return s.droppedCount()
 }
 
-func (r *RICAlarm) sendAlarmUpdateReq(a AlarmMessage) error {
+func (r *RICAlarm) sendAlarmUpdateReq(ctx context.Context, a AlarmMessage) error {
+	r.updateOutstanding(a)
+	return r.dispatch(ctx, a)
+}
 
-	payload, err := json.Marshal(a)
-	if err != nil {
-		log.Println("json.Marshal failed with error: ", err)
-		return err
+// dispatch sends the alarm, or queues it in async mode. Must be called with the mutex held. The mutex is
+// released while waiting for room in the queue, so that the other alarm operations are not blocked.
+func (r *RICAlarm) dispatch(ctx context.Context, a AlarmMessage) error {
+	// A raise following a clear is not a duplicate, even if the clear is still queued
+	if a.AlarmAction == AlarmActionClear || a.AlarmAction == AlarmActionClearAll {
+		r.updateDelivered(a)
 	}
-	log.Println("Sending alarm: ", fmt.Sprintf("%s", payload))
 
-	// --
-	// Try rmr sending
-	// --
-	err = r.sendAlarmUpdateReqWithRmr(payload)
+	if s := r.async.Load(); s != nil {
+		err := s.enqueue(ctx, a)
+		for err == errQueueBlocked {
+			r.mutex.Unlock()
+			err = s.waitForRoom(ctx)
+			r.mutex.Lock()
 
-	// --
-	// Try http posting if rmr is not done for some reason: rmrSend error, rmr not initialized yet etc.
-	// --
-	if err != nil {
-		if httperr := r.sendAlarmUpdateReqWithHttp(payload); httperr != nil {
-			err = fmt.Errorf("%s and  %s", err.Error(), httperr.Error())
-		} else {
-			err = nil
+			if err == nil {
+				err = s.enqueue(ctx, a)
+			}
 		}
+		if m := r.metrics.Load(); m != nil {
+			m.setQueueDepth(r.appId, s.length())
+		}
+		return err
 	}
+	return r.sendAlarm(ctx, a)
+}
 
+func (r *RICAlarm) sendAlarm(ctx context.Context, a AlarmMessage) error {
+	r.logger.Printf("Sending alarm: %s", r.AlarmString(a))
+
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	var err error
+	if m := r.metrics.Load(); m != nil {
+		err = m.send(ctx, r.transport, a)
+		m.setQueueDepth(r.appId, r.QueueLength())
+	} else {
+		err = r.transport.Send(ctx, a)
+	}
 	if err != nil {
-		log.Printf("Alarm sent error %s", err.Error())
+		r.logger.Printf("Alarm sent error %s", err.Error())
+	} else {
+		r.updateDelivered(a)
+	}
+
+	// Resync the outstanding alarms when the alarm manager is reachable again
+	// sendAlarm is called also by the async sender, without the mutex held
+	if failed := r.sendFailed.Swap(err != nil); err == nil && failed {
+		r.triggerResync()
 	}
 	return err
 }
 
-func (r *RICAlarm) ReceiveMessage(cb func(AlarmMessage)) error {
-	if rbuf := C.rmrRcv(r.rmrCtx); rbuf != nil {
-		payload := C.GoBytes(unsafe.Pointer(rbuf.payload), C.int(rbuf.len))
-		a := AlarmMessage{}
-		if err := json.Unmarshal(payload, &a); err == nil {
-			cb(a)
-		}
+// withTimeout limits the context with the timeout of the alarm instance, if set
+func (r *RICAlarm) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if r.timeout > 0 {
+		return context.WithTimeout(ctx, r.timeout)
 	}
-	return errors.New("rmrRcv failed!")
+	return context.WithCancel(ctx)
 }
 
-func InitRMR(r *RICAlarm) error {
-	// Setup static RT for alarm system
-	alarmRT := fmt.Sprintf("newrt|start\nrte|13111|%s\nnewrt|end\n", r.rmrEndpoint)
-	alarmRTFile := "/tmp/alarm.rt"
-
-	if err := ioutil.WriteFile(alarmRTFile, []byte(alarmRT), 0644); err != nil {
-		log.Println("ioutil.WriteFile failed with error: ", err)
-		return err
+// ReceiveMessage waits for an alarm message via RMR and passes it to the callback
+func (r *RICAlarm) ReceiveMessage(cb func(AlarmMessage)) error {
+	if r.rmr == nil {
+		return ErrNoRMRTransport
 	}
+	return r.rmr.receive(cb)
+}
 
-	os.Setenv("RMR_SEED_RT", alarmRTFile)
-	os.Setenv("RMR_RTG_SVC", "-1")
-
-	if ctx := C.rmrInit(); ctx != nil {
-		r.rmrCtx = ctx
-		r.rmrReady = true
-		return nil
+// InitRMR initializes the RMR transport of the alarm instance
+func InitRMR(r *RICAlarm) error {
+	if r.rmr == nil {
+		return ErrNoRMRTransport
 	}
-
-	return errors.New("rmrInit failed!")
+	return r.rmr.init()
 }
 
 func (r *RICAlarm) IsRMRReady() bool {
-	return r.rmrReady
+	return r.rmr != nil && r.rmr.isReady()
+}
+
+// Close sends the queued alarms without further retries, and releases the resources held by the transport
+func (r *RICAlarm) Close() error {
+	r.stopResync()
+	if s := r.async.Load(); s != nil {
+		s.close()
+	}
+	return r.transport.Close()
 }
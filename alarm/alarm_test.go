@@ -21,16 +21,25 @@
 package alarm_test
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/stretchr/testify/assert"
 	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"gerrit.o-ran-sc.org/r/ric-plt/alarm-go.git/alarm"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 var alarmer *alarm.RICAlarm
@@ -41,7 +50,7 @@ func TestAlarmInitSuccess(t *testing.T) {
 	os.Setenv("ALARM_MANAGER_URL", "http://localhost:8080")
 	managerSim = CreateAlarmManagerSim(t, "POST", "/ric/v1/alarms", http.StatusOK, nil)
 
-	a, err := alarm.InitAlarm("my-pod-lib", "my-app")
+	a, err := alarm.InitAlarm("my-pod", "my-app", alarm.WithRMREndpoint("127.0.0.1:4588"))
 	assert.Nil(t, err, "init failed")
 	assert.Equal(t, false, a == nil)
 
@@ -90,6 +99,47 @@ func TestAlarmReraiseSuccess(t *testing.T) {
 	assert.Nil(t, err, "re-raise failed")
 }
 
+func TestUpdateSeverity(t *testing.T) {
+	tr := alarm.NewMemoryTransport(nil)
+	a, err := alarm.InitAlarm("my-pod", "my-app", alarm.WithTransport(tr))
+	assert.Nil(t, err, "init failed")
+	defer a.Close()
+
+	b := a.NewAlarm(1234, alarm.SeverityMajor, "Some App data", "eth 0 1")
+	assert.Nil(t, a.Raise(b), "raise failed")
+	assert.Nil(t, a.UpdateSeverity(b, alarm.SeverityCritical), "update failed")
+
+	messages := tr.Messages()
+	assert.Equal(t, 2, len(messages))
+	assert.Equal(t, alarm.AlarmActionUpdate, messages[1].AlarmAction)
+	assert.Equal(t, alarm.SeverityCritical, messages[1].PerceivedSeverity)
+
+	outstanding := a.Outstanding()
+	assert.Equal(t, 1, len(outstanding))
+	assert.Equal(t, alarm.SeverityCritical, outstanding[0].PerceivedSeverity)
+}
+
+func TestStructuredAlarmJSON(t *testing.T) {
+	// Alarms without the optional attributes are encoded as before
+	a := alarmer.NewAlarm(1234, alarm.SeverityMajor, "Some App data", "eth 0 1")
+	b, err := json.Marshal(a)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"managedObjectId":"my-pod","applicationId":"my-app","specificProblem":1234,"perceivedSeverity":"MAJOR","identifyingInfo":"eth 0 1","additionalInfo":"Some App data"}`, string(b))
+
+	a.AdditionalAttributes = map[string]string{"interface": "eth0"}
+	a.ProbableCause = "LOSS_OF_SIGNAL"
+	a.ProposedRepairActions = []string{"Check the cable"}
+	a.TrendIndication = alarm.TrendMoreSevere
+	a.ThresholdInfo = &alarm.ThresholdInfo{TriggeredThreshold: "packetLoss", ObservedValue: 12.5, ThresholdLevel: 10}
+	a.CorrelatedNotifications = []alarm.CorrelatedNotification{{SourceObjectInstance: "RIC", NotificationIds: []int{17}}}
+	b, err = json.Marshal(alarmer.NewAlarmMessage(a, alarm.AlarmActionRaise))
+	assert.Nil(t, err)
+
+	var m alarm.AlarmMessage
+	assert.Nil(t, json.Unmarshal(b, &m))
+	assert.Equal(t, a, m.Alarm)
+}
+
 func TestAlarmClearAllSuccess(t *testing.T) {
 	err := alarmer.ClearAll()
 	assert.Nil(t, err, "clearAll failed")
@@ -129,6 +179,809 @@ func TestSetApplicationIdSuccess(t *testing.T) {
 	assert.Equal(t, a.ApplicationId, "new-app")
 }
 
+func TestMemoryTransport(t *testing.T) {
+	var handled []alarm.AlarmMessage
+	tr := alarm.NewMemoryTransport(func(m alarm.AlarmMessage) error {
+		handled = append(handled, m)
+		return nil
+	})
+
+	a, err := alarm.InitAlarm("my-pod", "my-app", alarm.WithTransport(tr))
+	assert.Nil(t, err, "init failed")
+	assert.False(t, a.IsRMRReady())
+
+	b := a.NewAlarm(1234, alarm.SeverityMajor, "Some App data", "eth 0 1")
+	assert.Nil(t, a.Raise(b), "raise failed")
+	assert.Nil(t, a.Clear(b), "clear failed")
+	assert.Nil(t, a.ClearAll(), "clearAll failed")
+
+	messages := tr.Messages()
+	assert.Equal(t, 3, len(messages))
+	assert.Equal(t, messages, handled)
+	assert.Equal(t, alarm.AlarmActionRaise, messages[0].AlarmAction)
+	assert.Equal(t, alarm.AlarmActionClear, messages[1].AlarmAction)
+	assert.Equal(t, alarm.AlarmActionClearAll, messages[2].AlarmAction)
+	assert.Equal(t, b, messages[0].Alarm)
+
+	tr.Reset()
+	assert.Equal(t, 0, len(tr.Messages()))
+	assert.Nil(t, a.Close())
+}
+
+func TestFallbackTransport(t *testing.T) {
+	failing := alarm.NewMemoryTransport(func(m alarm.AlarmMessage) error {
+		return errors.New("send failed")
+	})
+	working := alarm.NewMemoryTransport(nil)
+
+	a, _ := alarm.InitAlarm("my-pod", "my-app", alarm.WithTransport(alarm.NewFallbackTransport(failing, working)))
+	b := a.NewAlarm(1234, alarm.SeverityMajor, "Some App data", "eth 0 1")
+	assert.Nil(t, a.Raise(b), "raise failed")
+	assert.Equal(t, 1, len(failing.Messages()))
+	assert.Equal(t, 1, len(working.Messages()))
+
+	a, _ = alarm.InitAlarm("my-pod", "my-app", alarm.WithTransport(alarm.NewFallbackTransport(failing, failing)))
+	assert.NotNil(t, a.Raise(b), "raise should fail")
+}
+
+func TestAsyncDeliveryWithRetry(t *testing.T) {
+	var failures int32 = 2
+	tr := alarm.NewMemoryTransport(func(m alarm.AlarmMessage) error {
+		if atomic.AddInt32(&failures, -1) >= 0 {
+			return errors.New("manager not available")
+		}
+		return nil
+	})
+
+	a, _ := alarm.InitAlarm("my-pod", "my-app", alarm.WithTransport(tr))
+	a.EnableAsync(alarm.AsyncConfig{InitialBackoff: 10 * time.Millisecond})
+
+	b := a.NewAlarm(1234, alarm.SeverityMajor, "Some App data", "eth 0 1")
+	assert.Nil(t, a.Raise(b), "raise failed")
+	assert.Nil(t, a.Clear(b), "clear failed")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.Nil(t, a.Flush(ctx), "flush failed")
+
+	// Two failed attempts, then both alarms delivered in order
+	messages := tr.Messages()
+	assert.Equal(t, 4, len(messages))
+	assert.Equal(t, alarm.AlarmActionRaise, messages[2].AlarmAction)
+	assert.Equal(t, alarm.AlarmActionClear, messages[3].AlarmAction)
+	assert.Equal(t, 0, a.QueueLength())
+	assert.Equal(t, uint64(0), a.DroppedCount())
+
+	assert.Nil(t, a.Close())
+	assert.Equal(t, alarm.ErrAlarmerClosed, a.Raise(b))
+}
+
+func TestAsyncOverflow(t *testing.T) {
+	for _, policy := range []alarm.OverflowPolicy{alarm.OverflowDropNewest, alarm.OverflowDropOldest, alarm.OverflowBlock} {
+		release := make(chan struct{})
+		tr := alarm.NewMemoryTransport(func(m alarm.AlarmMessage) error {
+			<-release
+			return nil
+		})
+
+		a, _ := alarm.InitAlarm("my-pod", "my-app", alarm.WithTransport(tr))
+		a.EnableAsync(alarm.AsyncConfig{QueueSize: 1, Overflow: policy})
+
+		// First alarm is in-flight, second is queued
+		assert.Nil(t, a.Raise(a.NewAlarm(1, alarm.SeverityMajor, "", "")))
+		assert.Eventually(t, func() bool { return len(tr.Messages()) == 1 }, time.Second, 10*time.Millisecond)
+		assert.Nil(t, a.Raise(a.NewAlarm(2, alarm.SeverityMajor, "", "")))
+
+		result := make(chan error, 1)
+		go func() {
+			result <- a.Raise(a.NewAlarm(3, alarm.SeverityMajor, "", ""))
+		}()
+
+		switch policy {
+		case alarm.OverflowDropNewest:
+			assert.Equal(t, alarm.ErrQueueFull, <-result)
+		case alarm.OverflowDropOldest:
+			assert.Nil(t, <-result)
+		case alarm.OverflowBlock:
+			select {
+			case <-result:
+				t.Errorf("raise should block when the queue is full")
+			case <-time.After(100 * time.Millisecond):
+			}
+		}
+
+		close(release)
+		if policy == alarm.OverflowBlock {
+			assert.Nil(t, <-result)
+		}
+		assert.Nil(t, a.Flush(context.Background()))
+
+		var sps []int
+		for _, m := range tr.Messages() {
+			sps = append(sps, m.SpecificProblem)
+		}
+
+		switch policy {
+		case alarm.OverflowDropNewest:
+			assert.Equal(t, []int{1, 2}, sps)
+			assert.Equal(t, uint64(1), a.DroppedCount())
+		case alarm.OverflowDropOldest:
+			assert.Equal(t, []int{1, 3}, sps)
+			assert.Equal(t, uint64(1), a.DroppedCount())
+		case alarm.OverflowBlock:
+			assert.Equal(t, []int{1, 2, 3}, sps)
+			assert.Equal(t, uint64(0), a.DroppedCount())
+		}
+		a.Close()
+	}
+}
+
+func TestAsyncFlushTimeout(t *testing.T) {
+	tr := alarm.NewMemoryTransport(func(m alarm.AlarmMessage) error {
+		return errors.New("manager not available")
+	})
+
+	a, _ := alarm.InitAlarm("my-pod", "my-app", alarm.WithTransport(tr))
+	a.EnableAsync(alarm.AsyncConfig{MaxRetries: 100, InitialBackoff: 50 * time.Millisecond})
+	assert.Nil(t, a.Raise(a.NewAlarm(1234, alarm.SeverityMajor, "", "")))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, a.Flush(ctx))
+
+	// Timed out flushes leave no goroutines behind
+	goroutines := runtime.NumGoroutine()
+	for i := 0; i < 10; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		assert.Equal(t, context.DeadlineExceeded, a.Flush(ctx))
+		cancel()
+	}
+	for deadline := time.Now().Add(time.Second); runtime.NumGoroutine() > goroutines && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.LessOrEqual(t, runtime.NumGoroutine(), goroutines)
+
+	// Close gives up retrying and drops the alarm
+	assert.Nil(t, a.Close())
+	assert.Equal(t, uint64(1), a.DroppedCount())
+}
+
+func TestOutstandingResync(t *testing.T) {
+	tr := alarm.NewMemoryTransport(nil)
+	a, _ := alarm.InitAlarm("my-pod", "my-app", alarm.WithTransport(tr))
+
+	b := a.NewAlarm(1, alarm.SeverityMajor, "", "eth 0 1")
+	c := a.NewAlarm(2, alarm.SeverityMinor, "", "eth 0 2")
+	assert.Nil(t, a.Raise(b))
+	assert.Nil(t, a.Raise(c))
+	assert.Nil(t, a.Clear(b))
+	assert.Equal(t, []alarm.Alarm{c}, a.Outstanding())
+
+	tr.Reset()
+	assert.Nil(t, a.Resync(true))
+	messages := tr.Messages()
+	assert.Equal(t, 2, len(messages))
+	assert.Equal(t, alarm.AlarmActionClearAll, messages[0].AlarmAction)
+	assert.Equal(t, alarm.AlarmActionRaise, messages[1].AlarmAction)
+	assert.Equal(t, c, messages[1].Alarm)
+
+	assert.Nil(t, a.ClearAll())
+	assert.Equal(t, 0, len(a.Outstanding()))
+	a.Close()
+}
+
+func TestAutomaticResyncAfterManagerRestart(t *testing.T) {
+	var instance atomic.Value
+	instance.Store("1")
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(alarm.ALARM_MANAGER_INSTANCE_HEADER, instance.Load().(string))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	tr := alarm.NewMemoryTransport(nil)
+	a, _ := alarm.InitAlarm("my-pod", "my-app", alarm.WithTransport(tr), alarm.WithManagerURL(ts.URL),
+		alarm.WithResync(alarm.ResyncConfig{Interval: 20 * time.Millisecond}))
+
+	b := a.NewAlarm(1234, alarm.SeverityMajor, "Some App data", "eth 0 1")
+	assert.Nil(t, a.Raise(b))
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, 1, len(tr.Messages()), "no resync expected while manager is unchanged")
+
+	// Manager restarted with empty state, the outstanding alarm is raised again
+	instance.Store("2")
+	assert.Eventually(t, func() bool { return len(tr.Messages()) == 2 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, b, tr.Messages()[1].Alarm)
+	a.Close()
+}
+
+func TestResyncAfterTransportRecovery(t *testing.T) {
+	var failing int32 = 1
+	tr := alarm.NewMemoryTransport(func(m alarm.AlarmMessage) error {
+		if atomic.LoadInt32(&failing) == 1 {
+			return errors.New("manager not available")
+		}
+		return nil
+	})
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	a, _ := alarm.InitAlarm("my-pod", "my-app", alarm.WithTransport(tr), alarm.WithManagerURL(ts.URL),
+		alarm.WithResync(alarm.ResyncConfig{Interval: time.Hour}))
+
+	b := a.NewAlarm(1, alarm.SeverityMajor, "", "")
+	assert.NotNil(t, a.Raise(b))
+
+	// The lost raise is delivered as soon as the manager is reachable again
+	atomic.StoreInt32(&failing, 0)
+	assert.Nil(t, a.Raise(a.NewAlarm(2, alarm.SeverityMajor, "", "")))
+	assert.Eventually(t, func() bool {
+		for _, m := range tr.Messages()[2:] {
+			if m.SpecificProblem == 1 {
+				return true
+			}
+		}
+		return false
+	}, time.Second, 10*time.Millisecond)
+	a.Close()
+
+	// Closing again is harmless
+	assert.NotPanics(t, func() { a.Close() })
+}
+
+func TestContextCancellation(t *testing.T) {
+	tr := alarm.NewMemoryTransport(nil)
+	a, _ := alarm.InitAlarm("my-pod", "my-app", alarm.WithTransport(tr))
+	b := a.NewAlarm(1234, alarm.SeverityMajor, "Some App data", "eth 0 1")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, a.RaiseContext(ctx, b))
+	assert.Equal(t, context.Canceled, a.ClearContext(ctx, b))
+	assert.Equal(t, context.Canceled, a.ClearAllContext(ctx))
+	assert.NotNil(t, a.ReraiseContext(ctx, b))
+	assert.Equal(t, 0, len(tr.Messages()))
+	a.Close()
+}
+
+func TestHTTPTransportDeadline(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	a, _ := alarm.InitAlarm("my-pod", "my-app", alarm.WithTransport(alarm.NewHTTPTransport(ts.URL)))
+	b := a.NewAlarm(1234, alarm.SeverityMajor, "Some App data", "eth 0 1")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	assert.True(t, errors.Is(a.RaiseContext(ctx, b), context.DeadlineExceeded))
+	assert.True(t, time.Since(start) < time.Second, "raise should return when the deadline is exceeded")
+}
+
+func TestAsyncBlockedRaiseDeadline(t *testing.T) {
+	release := make(chan struct{})
+	tr := alarm.NewMemoryTransport(func(m alarm.AlarmMessage) error {
+		<-release
+		return nil
+	})
+
+	a, _ := alarm.InitAlarm("my-pod", "my-app", alarm.WithTransport(tr))
+	a.EnableAsync(alarm.AsyncConfig{QueueSize: 1, Overflow: alarm.OverflowBlock})
+
+	assert.Nil(t, a.Raise(a.NewAlarm(1, alarm.SeverityMajor, "", "")))
+	assert.Eventually(t, func() bool { return len(tr.Messages()) == 1 }, time.Second, 10*time.Millisecond)
+	assert.Nil(t, a.Raise(a.NewAlarm(2, alarm.SeverityMajor, "", "")))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, a.RaiseContext(ctx, a.NewAlarm(3, alarm.SeverityMajor, "", "")))
+
+	// A raise waiting for room in the queue does not block the other operations of the alarm instance
+	blocked := make(chan error, 1)
+	go func() {
+		blocked <- a.Raise(a.NewAlarm(4, alarm.SeverityMajor, "", ""))
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	outstanding := make(chan int, 1)
+	go func() {
+		outstanding <- len(a.Outstanding())
+	}()
+	select {
+	case n := <-outstanding:
+		assert.Equal(t, 4, n)
+	case <-time.After(time.Second):
+		t.Errorf("alarm instance locked while a raise is waiting for room in the queue")
+	}
+
+	close(release)
+	assert.Nil(t, <-blocked)
+	a.Close()
+}
+
+func TestQueryActiveViaHTTP(t *testing.T) {
+	b := alarm.Alarm{ManagedObjectId: "my-pod", ApplicationId: "my-app", SpecificProblem: 1234, PerceivedSeverity: alarm.SeverityMajor}
+	c := alarm.Alarm{ManagedObjectId: "my-pod", ApplicationId: "other-app", SpecificProblem: 1235, PerceivedSeverity: alarm.SeverityMinor}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "GET", r.Method)
+		assert.Equal(t, "/ric/v1/alarms/active", r.URL.Path)
+		json.NewEncoder(w).Encode([]alarm.AlarmMessage{{Alarm: b, AlarmAction: alarm.AlarmActionRaise}, {Alarm: c, AlarmAction: alarm.AlarmActionRaise}})
+	}))
+	defer ts.Close()
+
+	a, _ := alarm.InitAlarm("my-pod", "my-app", alarm.WithTransport(alarm.NewMemoryTransport(nil)), alarm.WithManagerURL(ts.URL))
+
+	alarms, err := a.QueryActive(alarm.AlarmFilter{ApplicationId: "my-app"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(alarms))
+	assert.Equal(t, b, alarms[0].Alarm)
+
+	alarms, err = a.QueryActive(alarm.AlarmFilter{})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(alarms))
+}
+
+func TestAlarmFilterMatch(t *testing.T) {
+	a := alarm.Alarm{ManagedObjectId: "my-pod", ApplicationId: "my-app", SpecificProblem: 1234, PerceivedSeverity: alarm.SeverityMajor}
+	assert.True(t, alarm.AlarmFilter{}.Match(a))
+	assert.True(t, alarm.AlarmFilter{ManagedObjectId: "my-pod", SpecificProblem: 1234}.Match(a))
+	assert.False(t, alarm.AlarmFilter{ApplicationId: "other-app"}.Match(a))
+	assert.False(t, alarm.AlarmFilter{PerceivedSeverity: alarm.SeverityMinor}.Match(a))
+}
+
+type testLogger struct {
+	lines int32
+}
+
+func (l *testLogger) Printf(format string, v ...interface{}) {
+	atomic.AddInt32(&l.lines, 1)
+}
+
+func TestInitOptions(t *testing.T) {
+	var posted1, posted2 int32
+	ts1 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { atomic.AddInt32(&posted1, 1) }))
+	defer ts1.Close()
+	ts2 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { atomic.AddInt32(&posted2, 1) }))
+	defer ts2.Close()
+
+	// Two differently configured alarm instances in the same process
+	logger := &testLogger{}
+	a1, _ := alarm.InitAlarm("my-pod", "app-1", alarm.WithRMREndpoint("127.0.0.1:4599"), alarm.WithListenPort(4599),
+		alarm.WithTransport(alarm.NewHTTPTransport(ts1.URL)), alarm.WithLogger(logger), alarm.WithTimeout(time.Second))
+	a2, _ := alarm.InitAlarm("my-pod", "app-2", alarm.WithTransport(alarm.NewHTTPTransport(ts2.URL)),
+		alarm.WithHTTPClient(&http.Client{Timeout: time.Second}), alarm.WithAsync(alarm.AsyncConfig{}))
+
+	assert.Nil(t, a1.Raise(a1.NewAlarm(1, alarm.SeverityMajor, "", "")))
+	assert.Nil(t, a2.Raise(a2.NewAlarm(2, alarm.SeverityMajor, "", "")))
+	assert.Nil(t, a2.Flush(context.Background()))
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&posted1))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&posted2))
+	assert.True(t, atomic.LoadInt32(&logger.lines) > 0)
+	a1.Close()
+	a2.Close()
+}
+
+func TestRMROptionsKeepEnvironment(t *testing.T) {
+	os.Setenv("RMR_SEED_RT", "/opt/app/uta_rtg.rt")
+	defer os.Unsetenv("RMR_SEED_RT")
+
+	// The RMR transport of the alarm instances must not change the RMR configuration of the application,
+	// not even while RMR is initialized
+	changed := make(chan string, 1)
+	stop := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			_, found := os.LookupEnv("RMR_RTG_SVC")
+			if seed := os.Getenv("RMR_SEED_RT"); seed != "/opt/app/uta_rtg.rt" || found {
+				changed <- seed
+				return
+			}
+		}
+	}()
+
+	a1, err := alarm.InitAlarm("my-pod", "my-app", alarm.WithRMREndpoint("127.0.0.1:4599"), alarm.WithListenPort(4598),
+		alarm.WithRMRRouting(alarm.RMRRoutingStatic), alarm.WithManagerURL("http://127.0.0.1:1"))
+	assert.Nil(t, err)
+	a2, err := alarm.InitAlarm("my-pod", "my-app", alarm.WithRMREndpoint("127.0.0.1:4599"), alarm.WithListenPort(4597),
+		alarm.WithRMRRouting(alarm.RMRRoutingDynamic), alarm.WithManagerURL("http://127.0.0.1:1"))
+	assert.Nil(t, err)
+	time.Sleep(300 * time.Millisecond)
+	close(stop)
+
+	select {
+	case seed := <-changed:
+		t.Errorf("RMR environment changed, RMR_SEED_RT=%s", seed)
+	default:
+	}
+	assert.Nil(t, a1.Close())
+	assert.Nil(t, a2.Close())
+}
+
+func TestMetrics(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	// Nothing listens on the RMR endpoint, so the alarms are posted via HTTP
+	rmr := alarm.NewRMRTransport("127.0.0.1:4599")
+	defer rmr.Close()
+	reg := prometheus.NewRegistry()
+	a, err := alarm.InitAlarm("my-pod", "my-app", alarm.WithMetrics(reg),
+		alarm.WithTransport(alarm.NewFallbackTransport(rmr, alarm.NewHTTPTransport(ts.URL))))
+	assert.Nil(t, err)
+	defer a.Close()
+
+	b := a.NewAlarm(1234, alarm.SeverityMajor, "Some App data", "eth 0 1")
+	assert.Nil(t, a.Raise(b))
+	assert.Nil(t, a.Clear(b))
+
+	// The collectors are shared by the alarm instances using the same registry
+	c, err := alarm.InitAlarm("my-pod", "other-app", alarm.WithMetrics(reg), alarm.WithTransport(alarm.NewHTTPTransport(ts.URL)))
+	assert.Nil(t, err)
+	defer c.Close()
+	assert.Nil(t, c.Raise(c.NewAlarm(1234, alarm.SeverityMajor, "", "eth 0 2")))
+
+	assert.Equal(t, 3.0, metricValue(t, reg, "alarm_client_attempts_total", nil))
+	assert.Equal(t, 1.0, metricValue(t, reg, "alarm_client_successes_total", map[string]string{"action": "clear", "transport": "http"}))
+	assert.Equal(t, 2.0, metricValue(t, reg, "alarm_client_successes_total", map[string]string{"action": "raise", "transport": "http"}))
+	assert.Equal(t, 2.0, metricValue(t, reg, "alarm_client_rmr_failures_total", map[string]string{"sp": "1234"}))
+	assert.Equal(t, 2.0, metricValue(t, reg, "alarm_client_http_fallbacks_total", map[string]string{"sp": "1234"}))
+	assert.Equal(t, 3.0, metricValue(t, reg, "alarm_client_send_duration_seconds", map[string]string{"transport": "http"}))
+	assert.Equal(t, 0.0, metricValue(t, reg, "alarm_client_failures_total", nil))
+}
+
+// Run with -race: async delivery and metrics are enabled while alarms are being sent
+func TestEnableAsyncAndMetricsWhileSending(t *testing.T) {
+	tr := alarm.NewMemoryTransport(nil)
+	a, _ := alarm.InitAlarm("my-pod", "my-app", alarm.WithTransport(tr))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				assert.Nil(t, a.Raise(a.NewAlarm(1234, alarm.SeverityMajor, "", fmt.Sprintf("eth %d %d", i, j))))
+			}
+		}(i)
+	}
+
+	reg := prometheus.NewRegistry()
+	a.EnableAsync(alarm.AsyncConfig{})
+	assert.Nil(t, a.EnableMetrics(reg))
+	wg.Wait()
+
+	assert.Nil(t, a.Flush(context.Background()))
+	assert.Equal(t, 200, len(tr.Messages()))
+	assert.True(t, metricValue(t, reg, "alarm_client_attempts_total", nil) <= 200)
+	a.Close()
+}
+
+// metricValue returns the sum of the counters, or the sample count of histograms, with matching labels
+func metricValue(t *testing.T, reg *prometheus.Registry, name string, labels map[string]string) float64 {
+	families, err := reg.Gather()
+	assert.Nil(t, err)
+
+	var value float64
+	for _, f := range families {
+		if f.GetName() != name {
+			continue
+		}
+	next:
+		for _, m := range f.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if v, ok := labels[l.GetName()]; ok && v != l.GetValue() {
+					continue next
+				}
+			}
+			value += m.GetCounter().GetValue() + m.GetGauge().GetValue() + float64(m.GetHistogram().GetSampleCount())
+		}
+	}
+	return value
+}
+
+func TestHTTPTransportStatusHandling(t *testing.T) {
+	var requests, status int32 = 0, http.StatusBadRequest
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(int(atomic.LoadInt32(&status)))
+		w.Write([]byte("invalid alarm"))
+	}))
+	defer ts.Close()
+
+	tr, err := alarm.NewHTTPTransportWithConfig(ts.URL, alarm.HTTPConfig{RetryBackoff: time.Millisecond})
+	assert.Nil(t, err)
+	a, _ := alarm.InitAlarm("my-pod", "my-app", alarm.WithTransport(tr))
+	b := a.NewAlarm(1234, alarm.SeverityMajor, "Some App data", "eth 0 1")
+
+	// Client errors are not retried
+	err = a.Raise(b)
+	var statusErr *alarm.HTTPStatusError
+	assert.True(t, errors.As(err, &statusErr))
+	assert.Equal(t, http.StatusBadRequest, statusErr.StatusCode)
+	assert.Equal(t, "invalid alarm", statusErr.Body)
+	assert.False(t, statusErr.Temporary())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+
+	// Temporary errors are retried
+	atomic.StoreInt32(&requests, 0)
+	atomic.StoreInt32(&status, http.StatusServiceUnavailable)
+	assert.NotNil(t, a.Raise(b))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&requests))
+
+	atomic.StoreInt32(&status, http.StatusOK)
+	assert.Nil(t, a.Raise(b))
+
+	// Refused connections are retried, until the alarm manager is up again
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := l.Addr().String()
+	l.Close()
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		l, _ := net.Listen("tcp", addr)
+		http.Serve(l, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	}()
+
+	tr, _ = alarm.NewHTTPTransportWithConfig("http://"+addr, alarm.HTTPConfig{RetryBackoff: 100 * time.Millisecond})
+	a, _ = alarm.InitAlarm("my-pod", "my-app", alarm.WithTransport(tr))
+	assert.Nil(t, a.Raise(b))
+}
+
+func TestFallbackErrors(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	rmr := alarm.NewMemoryTransport(func(m alarm.AlarmMessage) error {
+		return alarm.ErrRMRNotReady
+	})
+	a, _ := alarm.InitAlarm("my-pod", "my-app", alarm.WithTransport(alarm.NewFallbackTransport(rmr, alarm.NewHTTPTransport(ts.URL))))
+
+	err := a.Raise(a.NewAlarm(1234, alarm.SeverityMajor, "Some App data", "eth 0 1"))
+	var statusErr *alarm.HTTPStatusError
+	assert.True(t, errors.Is(err, alarm.ErrRMRNotReady))
+	assert.True(t, errors.As(err, &statusErr))
+	assert.Equal(t, http.StatusInternalServerError, statusErr.StatusCode)
+	assert.Contains(t, err.Error(), "RmrError=rmr not ready and  HttpError=POST")
+}
+
+func TestHTTPTransportTLS(t *testing.T) {
+	var connections int32
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ts.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&connections, 1)
+		}
+	}
+	ts.StartTLS()
+	defer ts.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ts.Certificate())
+	tr, err := alarm.NewHTTPTransportWithConfig(ts.URL, alarm.HTTPConfig{TLSConfig: &tls.Config{RootCAs: pool}, MaxIdleConns: 2})
+	assert.Nil(t, err)
+
+	a, _ := alarm.InitAlarm("my-pod", "my-app", alarm.WithTransport(tr))
+	assert.Nil(t, a.Raise(a.NewAlarm(1234, alarm.SeverityMajor, "Some App data", "eth 0 1")))
+
+	// Server certificate not trusted, the failure is not retried
+	atomic.StoreInt32(&connections, 0)
+	a, _ = alarm.InitAlarm("my-pod", "my-app", alarm.WithTransport(alarm.NewHTTPTransport(ts.URL)))
+	assert.NotNil(t, a.Raise(a.NewAlarm(1234, alarm.SeverityMajor, "Some App data", "eth 0 1")))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&connections))
+
+	_, err = alarm.InitAlarm("my-pod", "my-app", alarm.WithHTTPConfig(alarm.HTTPConfig{CAFile: "/nonexistent/ca.crt"}))
+	assert.NotNil(t, err)
+}
+
+func TestValidationWithDefinitionsFile(t *testing.T) {
+	f, _ := os.CreateTemp("", "alarm-definition-*.json")
+	defer os.Remove(f.Name())
+	f.WriteString(`{"alarmdefinitions": [{"alarmId": 72004, "alarmText": "E2 CONNECTION PROBLEM", "eventType": "communication"}]}`)
+	f.Close()
+
+	tr := alarm.NewMemoryTransport(nil)
+	a, err := alarm.InitAlarm("my-pod", "my-app", alarm.WithTransport(tr), alarm.WithDefinitionsFile(f.Name()))
+	assert.Nil(t, err)
+
+	assert.Nil(t, a.Raise(a.NewAlarm(alarm.E2_CONNECTION_PROBLEM, alarm.SeverityMajor, "Some App data", "eth 0 1")))
+
+	err = a.Raise(a.NewAlarm(1234, alarm.SeverityMajor, "Some App data", "eth 0 1"))
+	var validationErr *alarm.ValidationError
+	assert.True(t, errors.As(err, &validationErr))
+	assert.True(t, errors.Is(err, alarm.ErrInvalidAlarm))
+	assert.Contains(t, err.Error(), "specific problem 1234 not defined")
+
+	err = a.Raise(a.NewAlarm(alarm.E2_CONNECTION_PROBLEM, alarm.SeverityCleared, "Some App data", "eth 0 1"))
+	assert.Contains(t, err.Error(), "invalid severity 'CLEARED'")
+
+	err = a.Raise(a.NewAlarm(alarm.E2_CONNECTION_PROBLEM, alarm.SeverityMajor, "Some App data", ""))
+	assert.Contains(t, err.Error(), "identifying info missing")
+
+	b := a.NewAlarm(alarm.E2_CONNECTION_PROBLEM, alarm.SeverityMajor, "Some App data", "eth 0 1")
+	b.TrendIndication = "WORSE"
+	err = a.Raise(b)
+	assert.Contains(t, err.Error(), "invalid trend indication 'WORSE'")
+
+	// Severity is not relevant when clearing
+	assert.Nil(t, a.Clear(a.NewAlarm(alarm.E2_CONNECTION_PROBLEM, alarm.SeverityDefault, "", "eth 0 1")))
+	assert.Equal(t, 2, len(tr.Messages()), "invalid alarms must not be sent")
+
+	_, err = alarm.InitAlarm("my-pod", "my-app", alarm.WithDefinitionsFile("/nonexistent.json"))
+	assert.NotNil(t, err)
+}
+
+func TestValidationWithDefinitionsFromManager(t *testing.T) {
+	var fetched int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/ric/v1/alarms/define", r.URL.Path)
+		atomic.AddInt32(&fetched, 1)
+		json.NewEncoder(w).Encode(alarm.AlarmDefinitions{AlarmDefinitions: []*alarm.AlarmDefinition{{AlarmId: 1234}}})
+	}))
+	defer ts.Close()
+
+	tr := alarm.NewMemoryTransport(nil)
+	a, _ := alarm.InitAlarm("my-pod", "my-app", alarm.WithTransport(tr), alarm.WithManagerURL(ts.URL), alarm.WithDefinitionsFromManager())
+
+	assert.Nil(t, a.Raise(a.NewAlarm(1234, alarm.SeverityMajor, "", "eth 0 1")))
+	assert.True(t, errors.Is(a.Raise(a.NewAlarm(1235, alarm.SeverityMajor, "", "eth 0 1")), alarm.ErrInvalidAlarm))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fetched))
+	assert.Equal(t, 1, len(tr.Messages()))
+
+	// Without definitions nothing is validated
+	b, _ := alarm.InitAlarm("my-pod", "my-app", alarm.WithTransport(tr), alarm.WithManagerURL(ts.URL))
+	assert.Nil(t, b.Raise(b.NewAlarm(1235, alarm.SeverityMajor, "", "")))
+	assert.Nil(t, b.FetchDefinitions(context.Background()))
+	assert.NotNil(t, b.Raise(b.NewAlarm(1235, alarm.SeverityMajor, "", "")))
+}
+
+func TestAlarmsNotBlockedByDefinitionsFetch(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		json.NewEncoder(w).Encode(alarm.AlarmDefinitions{AlarmDefinitions: []*alarm.AlarmDefinition{{AlarmId: 1234}}})
+	}))
+	defer ts.Close()
+
+	tr := alarm.NewMemoryTransport(nil)
+	a, _ := alarm.InitAlarm("my-pod", "my-app", alarm.WithTransport(tr), alarm.WithManagerURL(ts.URL), alarm.WithDefinitionsFromManager())
+
+	// The alarms sent while the definitions are being fetched pass through without validation
+	done := make(chan error)
+	go func() { done <- a.Raise(a.NewAlarm(1234, alarm.SeverityMajor, "", "eth 0 1")) }()
+	<-started
+	assert.Nil(t, a.Raise(a.NewAlarm(1235, alarm.SeverityMajor, "", "eth 0 2")))
+	assert.Equal(t, 1, len(tr.Messages()))
+
+	close(release)
+	assert.Nil(t, <-done)
+	assert.True(t, errors.Is(a.Raise(a.NewAlarm(1235, alarm.SeverityMajor, "", "eth 0 3")), alarm.ErrInvalidAlarm))
+}
+
+func TestCollapseDuplicates(t *testing.T) {
+	tr := alarm.NewMemoryTransport(nil)
+	a, _ := alarm.InitAlarm("my-pod", "my-app", alarm.WithTransport(tr), alarm.WithRateLimit(alarm.RateLimitConfig{CollapseDuplicates: true}))
+
+	b := a.NewAlarm(1234, alarm.SeverityMajor, "Some App data", "eth 0 1")
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, a.Raise(b))
+	}
+	assert.Equal(t, 1, len(tr.Messages()))
+	assert.Equal(t, uint64(99), a.SuppressedCounts().Duplicates)
+
+	// Severity change is sent, and after clear the alarm can be raised again
+	b.PerceivedSeverity = alarm.SeverityCritical
+	assert.Nil(t, a.Raise(b))
+	assert.Nil(t, a.Clear(b))
+	assert.Nil(t, a.Raise(b))
+	assert.Equal(t, 4, len(tr.Messages()))
+}
+
+func TestCollapseDuplicatesAfterSendFailure(t *testing.T) {
+	var failing int32 = 1
+	tr := alarm.NewMemoryTransport(func(m alarm.AlarmMessage) error {
+		if atomic.LoadInt32(&failing) == 1 {
+			return errors.New("alarm manager not reachable")
+		}
+		return nil
+	})
+	a, _ := alarm.InitAlarm("my-pod", "my-app", alarm.WithTransport(tr), alarm.WithRateLimit(alarm.RateLimitConfig{CollapseDuplicates: true}))
+
+	// The retry of a failed raise is sent, only the raises after a successful one are collapsed
+	b := a.NewAlarm(1234, alarm.SeverityMajor, "Some App data", "eth 0 1")
+	assert.NotNil(t, a.Raise(b))
+	atomic.StoreInt32(&failing, 0)
+	assert.Nil(t, a.Raise(b))
+	assert.Nil(t, a.Raise(b))
+	assert.Equal(t, 2, len(tr.Messages()))
+	assert.Equal(t, uint64(1), a.SuppressedCounts().Duplicates)
+	assert.Equal(t, 1, len(a.Outstanding()))
+}
+
+func TestCollapseDuplicatesAsync(t *testing.T) {
+	release := make(chan struct{}, 10)
+	tr := alarm.NewMemoryTransport(func(m alarm.AlarmMessage) error {
+		<-release
+		return nil
+	})
+	a, _ := alarm.InitAlarm("my-pod", "my-app", alarm.WithTransport(tr), alarm.WithRateLimit(alarm.RateLimitConfig{CollapseDuplicates: true}))
+	a.EnableAsync(alarm.AsyncConfig{})
+
+	b := a.NewAlarm(1234, alarm.SeverityMajor, "Some App data", "eth 0 1")
+	release <- struct{}{}
+	assert.Nil(t, a.Raise(b))
+	assert.Nil(t, a.Flush(context.Background()))
+
+	// The raise following a clear still in the queue is not collapsed with the raise delivered before
+	for _, action := range []alarm.AlarmAction{alarm.AlarmActionClear, alarm.AlarmActionClearAll} {
+		if action == alarm.AlarmActionClear {
+			assert.Nil(t, a.Clear(b))
+		} else {
+			assert.Nil(t, a.ClearAll())
+		}
+		assert.Nil(t, a.Raise(b))
+
+		release <- struct{}{}
+		release <- struct{}{}
+		assert.Nil(t, a.Flush(context.Background()))
+	}
+
+	messages := tr.Messages()
+	assert.Equal(t, 5, len(messages))
+	assert.Equal(t, alarm.AlarmActionRaise, messages[4].AlarmAction)
+	assert.Equal(t, uint64(0), a.SuppressedCounts().Duplicates)
+
+	// Raising it again after delivery is collapsed
+	assert.Nil(t, a.Raise(b))
+	assert.Equal(t, uint64(1), a.SuppressedCounts().Duplicates)
+	a.Close()
+}
+
+func TestRateLimit(t *testing.T) {
+	tr := alarm.NewMemoryTransport(nil)
+	a, _ := alarm.InitAlarm("my-pod", "my-app", alarm.WithTransport(tr),
+		alarm.WithRateLimit(alarm.RateLimitConfig{Rate: 1, Burst: 5, PerAlarmRate: 1, PerAlarmBurst: 2}))
+
+	// Per-alarm limit
+	b := a.NewAlarm(1234, alarm.SeverityMajor, "Some App data", "eth 0 1")
+	assert.Nil(t, a.Raise(b))
+	assert.Nil(t, a.Reraise(b))
+	assert.Equal(t, alarm.ErrRateLimited, a.Raise(b))
+
+	// Global limit
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, a.Raise(a.NewAlarm(1234, alarm.SeverityMajor, "", fmt.Sprintf("eth %d", i))))
+	}
+	assert.Equal(t, alarm.ErrRateLimited, a.Raise(a.NewAlarm(1234, alarm.SeverityMajor, "", "eth 9")))
+	assert.Equal(t, 6, len(tr.Messages()))
+
+	// Clears are not limited, the alarms would stay active otherwise
+	assert.Nil(t, a.Clear(b))
+	assert.Nil(t, a.Clear(a.NewAlarm(1234, alarm.SeverityMajor, "", "eth 0")))
+	assert.Nil(t, a.ClearAll())
+	assert.Equal(t, 9, len(tr.Messages()))
+	assert.Equal(t, uint64(2), a.SuppressedCounts().RateLimited)
+
+	// Tokens are refilled over time
+	time.Sleep(1100 * time.Millisecond)
+	assert.Nil(t, a.Raise(b))
+}
+
 func TestTeardown(t *testing.T) {
 	managerSim.Close()
 }
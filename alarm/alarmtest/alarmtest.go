@@ -0,0 +1,253 @@
+/*
+ *  Copyright (c) 2020 AT&T Intellectual Property.
+ *  Copyright (c) 2020 Nokia.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ * This source code is part of the near-RT RIC (RAN Intelligent Controller)
+ * platform project (RICP).
+ */
+
+// Package alarmtest provides an in-memory alarm recorder and a fake alarm manager
+// for unit testing the alarm behaviour of applications.
+package alarmtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/alarm-go.git/alarm"
+)
+
+// Alarmer is the alarm API used by the applications, satisfied by *alarm.RICAlarm and *Recorder
+type Alarmer = alarm.Alarmer
+
+// TestingT is the subset of testing.TB used by the assertion helpers
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// alarmState keeps the received alarm messages and the resulting active alarms, like the alarm manager does
+type alarmState struct {
+	mutex    sync.Mutex
+	messages []alarm.AlarmMessage
+	active   []alarm.Alarm
+}
+
+func isSameAlarm(a, b alarm.Alarm) bool {
+	return a.ManagedObjectId == b.ManagedObjectId && a.ApplicationId == b.ApplicationId &&
+		a.SpecificProblem == b.SpecificProblem && a.IdentifyingInfo == b.IdentifyingInfo
+}
+
+func (s *alarmState) process(m alarm.AlarmMessage) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.messages = append(s.messages, m)
+	switch m.AlarmAction {
+	case alarm.AlarmActionRaise, alarm.AlarmActionUpdate:
+		for i, a := range s.active {
+			if isSameAlarm(a, m.Alarm) {
+				s.active[i] = m.Alarm
+				return
+			}
+		}
+		s.active = append(s.active, m.Alarm)
+	case alarm.AlarmActionClear:
+		s.clear(alarm.AlarmFilter{}, func(a alarm.Alarm) bool { return isSameAlarm(a, m.Alarm) })
+	case alarm.AlarmActionClearAll:
+		filter := alarm.AlarmFilter{ManagedObjectId: m.ManagedObjectId, ApplicationId: m.ApplicationId}
+		s.clear(filter, nil)
+	}
+}
+
+// clear removes the active alarms matching the filter and the optional match function. Must be called with the mutex held.
+func (s *alarmState) clear(filter alarm.AlarmFilter, match func(alarm.Alarm) bool) []alarm.Alarm {
+	var cleared []alarm.Alarm
+	active := s.active[:0]
+	for _, a := range s.active {
+		if filter.Match(a) && (match == nil || match(a)) {
+			cleared = append(cleared, a)
+		} else {
+			active = append(active, a)
+		}
+	}
+	s.active = active
+	return cleared
+}
+
+// Messages returns the alarm messages received so far
+func (s *alarmState) Messages() []alarm.AlarmMessage {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	messages := make([]alarm.AlarmMessage, len(s.messages))
+	copy(messages, s.messages)
+	return messages
+}
+
+// Active returns the currently active alarms
+func (s *alarmState) Active() []alarm.Alarm {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	active := make([]alarm.Alarm, len(s.active))
+	copy(active, s.active)
+	return active
+}
+
+// Reset discards the received alarm messages and the active alarms
+func (s *alarmState) Reset() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.messages = nil
+	s.active = nil
+}
+
+func (s *alarmState) findActive(sp int, iinfo string) (alarm.Alarm, bool) {
+	for _, a := range s.Active() {
+		if a.SpecificProblem == sp && a.IdentifyingInfo == iinfo {
+			return a, true
+		}
+	}
+	return alarm.Alarm{}, false
+}
+
+// AssertRaised checks that the alarm with the given specific problem and identifying info is active
+func (s *alarmState) AssertRaised(t TestingT, sp int, iinfo string) bool {
+	t.Helper()
+	if _, ok := s.findActive(sp, iinfo); !ok {
+		t.Errorf("alarm SP=%d IA=%s not active, active alarms: %+v", sp, iinfo, s.Active())
+		return false
+	}
+	return true
+}
+
+// AssertCleared checks that the alarm with the given specific problem and identifying info is not active
+func (s *alarmState) AssertCleared(t TestingT, sp int, iinfo string) bool {
+	t.Helper()
+	if a, ok := s.findActive(sp, iinfo); ok {
+		t.Errorf("alarm SP=%d IA=%s still active: %+v", sp, iinfo, a)
+		return false
+	}
+	return true
+}
+
+// AssertActiveCount checks the number of active alarms
+func (s *alarmState) AssertActiveCount(t TestingT, n int) bool {
+	t.Helper()
+	if active := s.Active(); len(active) != n {
+		t.Errorf("expected %d active alarms, got %d: %+v", n, len(active), active)
+		return false
+	}
+	return true
+}
+
+// Recorder is an in-memory Alarmer, which keeps track of the alarms raised and cleared by the application
+type Recorder struct {
+	alarmState
+	moId  string
+	appId string
+	err   error
+}
+
+var _ Alarmer = (*Recorder)(nil)
+
+// NewRecorder returns a new recorder with the given MO and application identities
+func NewRecorder(mo, id string) *Recorder {
+	return &Recorder{moId: mo, appId: id}
+}
+
+// SetError makes the following alarm calls fail with the given error, nil restores normal operation
+func (r *Recorder) SetError(err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.err = err
+}
+
+func (r *Recorder) NewAlarm(sp int, severity alarm.Severity, ainfo, iinfo string) alarm.Alarm {
+	return alarm.Alarm{
+		ManagedObjectId:   r.moId,
+		ApplicationId:     r.appId,
+		SpecificProblem:   sp,
+		PerceivedSeverity: severity,
+		IdentifyingInfo:   iinfo,
+		AdditionalInfo:    ainfo,
+	}
+}
+
+func (r *Recorder) Raise(a alarm.Alarm) error {
+	return r.RaiseContext(context.Background(), a)
+}
+
+func (r *Recorder) Clear(a alarm.Alarm) error {
+	return r.ClearContext(context.Background(), a)
+}
+
+func (r *Recorder) Reraise(a alarm.Alarm) error {
+	return r.ReraiseContext(context.Background(), a)
+}
+
+func (r *Recorder) UpdateSeverity(a alarm.Alarm, severity alarm.Severity) error {
+	return r.UpdateSeverityContext(context.Background(), a, severity)
+}
+
+func (r *Recorder) ClearAll() error {
+	return r.ClearAllContext(context.Background())
+}
+
+func (r *Recorder) RaiseContext(ctx context.Context, a alarm.Alarm) error {
+	return r.record(ctx, a, alarm.AlarmActionRaise)
+}
+
+func (r *Recorder) ClearContext(ctx context.Context, a alarm.Alarm) error {
+	return r.record(ctx, a, alarm.AlarmActionClear)
+}
+
+func (r *Recorder) ReraiseContext(ctx context.Context, a alarm.Alarm) error {
+	if err := r.record(ctx, a, alarm.AlarmActionClear); err != nil {
+		return errors.New(fmt.Sprintf("Reraise failed: %v", err))
+	}
+	return r.record(ctx, a, alarm.AlarmActionRaise)
+}
+
+func (r *Recorder) UpdateSeverityContext(ctx context.Context, a alarm.Alarm, severity alarm.Severity) error {
+	a.PerceivedSeverity = severity
+	return r.record(ctx, a, alarm.AlarmActionUpdate)
+}
+
+func (r *Recorder) ClearAllContext(ctx context.Context) error {
+	return r.record(ctx, r.NewAlarm(0, alarm.SeverityDefault, "", ""), alarm.AlarmActionClearAll)
+}
+
+func (r *Recorder) record(ctx context.Context, a alarm.Alarm, action alarm.AlarmAction) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	err := r.err
+	r.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	r.process(alarm.AlarmMessage{Alarm: a, AlarmAction: action, AlarmTime: time.Now().UnixNano()})
+	return nil
+}
@@ -0,0 +1,129 @@
+/*
+ *  Copyright (c) 2020 AT&T Intellectual Property.
+ *  Copyright (c) 2020 Nokia.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ * This source code is part of the near-RT RIC (RAN Intelligent Controller)
+ * platform project (RICP).
+ */
+
+package alarmtest_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/alarm-go.git/alarm"
+	"gerrit.o-ran-sc.org/r/ric-plt/alarm-go.git/alarm/alarmtest"
+)
+
+// raiseLinkDown is an example of application code under test
+func raiseLinkDown(a alarmtest.Alarmer, link string) error {
+	return a.Raise(a.NewAlarm(alarm.E2_CONNECTION_PROBLEM, alarm.SeverityMajor, "link down", link))
+}
+
+func TestRecorder(t *testing.T) {
+	r := alarmtest.NewRecorder("my-pod", "my-app")
+
+	assert.Nil(t, raiseLinkDown(r, "eth 0 1"))
+	assert.Nil(t, raiseLinkDown(r, "eth 0 2"))
+	assert.Nil(t, raiseLinkDown(r, "eth 0 2"))
+	r.AssertRaised(t, alarm.E2_CONNECTION_PROBLEM, "eth 0 1")
+	r.AssertActiveCount(t, 2)
+
+	assert.Nil(t, r.Clear(r.NewAlarm(alarm.E2_CONNECTION_PROBLEM, alarm.SeverityMajor, "", "eth 0 1")))
+	r.AssertCleared(t, alarm.E2_CONNECTION_PROBLEM, "eth 0 1")
+	r.AssertActiveCount(t, 1)
+
+	assert.Nil(t, r.ClearAll())
+	r.AssertActiveCount(t, 0)
+	assert.Equal(t, 5, len(r.Messages()))
+
+	r.SetError(errors.New("manager not available"))
+	assert.NotNil(t, raiseLinkDown(r, "eth 0 1"))
+	r.SetError(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, r.RaiseContext(ctx, r.NewAlarm(1, alarm.SeverityMajor, "", "")))
+
+	r.Reset()
+	assert.Equal(t, 0, len(r.Messages()))
+}
+
+type mockT struct {
+	errors int
+}
+
+func (m *mockT) Helper() {}
+
+func (m *mockT) Errorf(format string, args ...interface{}) {
+	m.errors++
+}
+
+func TestAssertionFailures(t *testing.T) {
+	r := alarmtest.NewRecorder("my-pod", "my-app")
+	r.Raise(r.NewAlarm(1, alarm.SeverityMajor, "", ""))
+
+	mt := &mockT{}
+	assert.False(t, r.AssertRaised(mt, 2, ""))
+	assert.False(t, r.AssertCleared(mt, 1, ""))
+	assert.False(t, r.AssertActiveCount(mt, 0))
+	assert.Equal(t, 3, mt.errors)
+}
+
+func TestFakeManager(t *testing.T) {
+	f := alarmtest.NewFakeManager()
+	defer f.Close()
+
+	a, err := f.NewAlarmer("my-pod", "my-app", alarm.WithResync(alarm.ResyncConfig{Interval: 20 * time.Millisecond}))
+	assert.Nil(t, err)
+	defer a.Close()
+
+	assert.Nil(t, raiseLinkDown(a, "eth 0 1"))
+	assert.Nil(t, raiseLinkDown(a, "eth 0 2"))
+	f.AssertRaised(t, alarm.E2_CONNECTION_PROBLEM, "eth 0 1")
+	f.AssertActiveCount(t, 2)
+
+	assert.Nil(t, a.Clear(a.NewAlarm(alarm.E2_CONNECTION_PROBLEM, alarm.SeverityMajor, "", "eth 0 1")))
+	f.AssertCleared(t, alarm.E2_CONNECTION_PROBLEM, "eth 0 1")
+
+	active, err := a.QueryActive(alarm.AlarmFilter{ApplicationId: "my-app"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(active))
+
+	// The outstanding alarm is raised again after the manager restart
+	f.Restart()
+	f.AssertActiveCount(t, 0)
+	assert.Eventually(t, func() bool { return len(f.Active()) == 1 }, time.Second, 10*time.Millisecond)
+	f.AssertRaised(t, alarm.E2_CONNECTION_PROBLEM, "eth 0 2")
+
+	assert.Nil(t, a.ClearAll())
+	f.AssertActiveCount(t, 0)
+}
+
+func TestFakeManagerDefinitions(t *testing.T) {
+	f := alarmtest.NewFakeManager()
+	defer f.Close()
+	f.SetDefinitions([]*alarm.AlarmDefinition{{AlarmId: alarm.E2_CONNECTION_PROBLEM}})
+
+	a, _ := f.NewAlarmer("my-pod", "my-app", alarm.WithDefinitionsFromManager())
+	assert.Nil(t, raiseLinkDown(a, "eth 0 1"))
+	assert.True(t, errors.Is(a.Raise(a.NewAlarm(1234, alarm.SeverityMajor, "", "eth 0 1")), alarm.ErrInvalidAlarm))
+	f.AssertActiveCount(t, 1)
+}
@@ -0,0 +1,155 @@
+/*
+ *  Copyright (c) 2020 AT&T Intellectual Property.
+ *  Copyright (c) 2020 Nokia.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ * This source code is part of the near-RT RIC (RAN Intelligent Controller)
+ * platform project (RICP).
+ */
+
+package alarmtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/alarm-go.git/alarm"
+)
+
+// FakeManager is an HTTP server speaking the REST interface of the alarm manager (/ric/v1/alarms),
+// which keeps the active alarms in memory
+type FakeManager struct {
+	alarmState
+	server      *httptest.Server
+	instance    string
+	definitions []*alarm.AlarmDefinition
+}
+
+// NewFakeManager starts a new fake alarm manager. Close must be called when the test is done.
+func NewFakeManager() *FakeManager {
+	f := &FakeManager{instance: fmt.Sprintf("%d", time.Now().UnixNano())}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ric/v1/alarms", f.handleAlarms)
+	mux.HandleFunc("/ric/v1/alarms/active", f.handleActiveAlarms)
+	mux.HandleFunc("/ric/v1/alarms/config", f.handleConfig)
+	mux.HandleFunc("/ric/v1/alarms/define", f.handleDefinitions)
+	f.server = httptest.NewServer(mux)
+	return f
+}
+
+// URL returns the base URL of the fake alarm manager
+func (f *FakeManager) URL() string {
+	return f.server.URL
+}
+
+// Close shuts down the fake alarm manager
+func (f *FakeManager) Close() {
+	f.server.Close()
+}
+
+// Restart simulates an alarm manager restart: the active alarms are lost and the instance identity changes
+func (f *FakeManager) Restart() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.active = nil
+	f.instance = fmt.Sprintf("%d", time.Now().UnixNano())
+}
+
+// SetDefinitions sets the alarm definitions returned by the fake alarm manager
+func (f *FakeManager) SetDefinitions(defs []*alarm.AlarmDefinition) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.definitions = defs
+}
+
+// NewAlarmer returns an alarm instance posting the alarms to the fake alarm manager via HTTP
+func (f *FakeManager) NewAlarmer(mo, id string, opts ...alarm.Option) (*alarm.RICAlarm, error) {
+	opts = append([]alarm.Option{alarm.WithManagerURL(f.URL()), alarm.WithTransport(alarm.NewHTTPTransport(f.URL()))}, opts...)
+	return alarm.InitAlarm(mo, id, opts...)
+}
+
+func (f *FakeManager) handleAlarms(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		f.respondWithJSON(w, http.StatusMethodNotAllowed, nil)
+		return
+	}
+
+	var m alarm.AlarmMessage
+	if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+		f.respondWithJSON(w, http.StatusOK, err)
+		return
+	}
+
+	// The alarm manager ignores alarms with mandatory parameters missing, the alarm action decides the operation
+	if m.ManagedObjectId != "" && m.ApplicationId != "" && m.AlarmAction != "" {
+		f.process(m)
+	}
+	f.respondWithJSON(w, http.StatusOK, nil)
+}
+
+func (f *FakeManager) handleActiveAlarms(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		messages := []alarm.AlarmMessage{}
+		for _, a := range f.Active() {
+			messages = append(messages, alarm.AlarmMessage{Alarm: a, AlarmAction: alarm.AlarmActionRaise})
+		}
+		f.respondWithJSON(w, http.StatusOK, messages)
+	case http.MethodDelete:
+		var filter alarm.AlarmFilter
+		if err := json.NewDecoder(r.Body).Decode(&filter); err != nil || filter == (alarm.AlarmFilter{}) {
+			f.respondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "Empty filter not allowed"})
+			return
+		}
+
+		f.mutex.Lock()
+		cleared := f.clear(filter, nil)
+		f.mutex.Unlock()
+		f.respondWithJSON(w, http.StatusOK, cleared)
+	default:
+		f.respondWithJSON(w, http.StatusMethodNotAllowed, nil)
+	}
+}
+
+func (f *FakeManager) handleConfig(w http.ResponseWriter, r *http.Request) {
+	f.respondWithJSON(w, http.StatusOK, alarm.AlarmConfigParams{MaxActiveAlarms: 5000, MaxAlarmHistory: 20000})
+}
+
+func (f *FakeManager) handleDefinitions(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	defs := alarm.AlarmDefinitions{AlarmDefinitions: f.definitions}
+	f.mutex.Unlock()
+
+	f.respondWithJSON(w, http.StatusOK, defs)
+}
+
+func (f *FakeManager) respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
+	f.mutex.Lock()
+	instance := f.instance
+	f.mutex.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set(alarm.ALARM_MANAGER_INSTANCE_HEADER, instance)
+	w.WriteHeader(code)
+	if payload != nil {
+		response, _ := json.Marshal(payload)
+		w.Write(response)
+	}
+}
@@ -0,0 +1,281 @@
+/*
+ *  Copyright (c) 2020 AT&T Intellectual Property.
+ *  Copyright (c) 2020 Nokia.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ * This source code is part of the near-RT RIC (RAN Intelligent Controller)
+ * platform project (RICP).
+ */
+
+package alarm
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// OverflowPolicy defines what happens when an alarm is sent and the outbound queue is full
+type OverflowPolicy int
+
+const (
+	// OverflowDropOldest discards the oldest queued alarm to make room for the new one
+	OverflowDropOldest OverflowPolicy = iota
+	// OverflowDropNewest discards the new alarm, and ErrQueueFull is returned
+	OverflowDropNewest
+	// OverflowBlock blocks the caller until there is room in the queue
+	OverflowBlock
+)
+
+// Default values for the asynchronous delivery
+const (
+	DefaultAsyncQueueSize      = 1000
+	DefaultAsyncMaxRetries     = 5
+	DefaultAsyncInitialBackoff = 100 * time.Millisecond
+	DefaultAsyncMaxBackoff     = 10 * time.Second
+)
+
+var (
+	ErrQueueFull     = errors.New("alarm queue is full")
+	ErrAlarmerClosed = errors.New("alarm instance is closed")
+)
+
+// AsyncConfig holds the parameters of the asynchronous alarm delivery. Zero values are replaced with defaults.
+type AsyncConfig struct {
+	QueueSize      int            // Maximum number of queued alarms
+	Overflow       OverflowPolicy // What to do when the queue is full
+	MaxRetries     int            // Number of retries per alarm, negative value disables retries
+	InitialBackoff time.Duration  // Delay before the first retry, doubled on each retry
+	MaxBackoff     time.Duration  // Upper limit for the delay between retries
+}
+
+// asyncSender delivers the queued alarms in order in a background goroutine
+type asyncSender struct {
+	cfg      AsyncConfig
+	send     func(AlarmMessage) error
+	logger   Logger
+	mutex    sync.Mutex
+	cond     *sync.Cond
+	queue    []AlarmMessage
+	inflight bool
+	closed   bool
+	dropped  uint64
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+func newAsyncSender(cfg AsyncConfig, send func(AlarmMessage) error, logger Logger) *asyncSender {
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = DefaultAsyncQueueSize
+	}
+	if cfg.MaxRetries == 0 {
+		cfg.MaxRetries = DefaultAsyncMaxRetries
+	}
+	if cfg.InitialBackoff <= 0 {
+		cfg.InitialBackoff = DefaultAsyncInitialBackoff
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = DefaultAsyncMaxBackoff
+	}
+
+	s := &asyncSender{
+		cfg:    cfg,
+		send:   send,
+		logger: logger,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	s.cond = sync.NewCond(&s.mutex)
+
+	go s.run()
+	return s
+}
+
+// errQueueBlocked is returned by enqueue when the queue is full and the overflow policy is OverflowBlock.
+// The caller releases its locks, waits for room with waitForRoom, and tries again.
+var errQueueBlocked = errors.New("alarm queue is full, waiting for room")
+
+func (s *asyncSender) enqueue(ctx context.Context, m AlarmMessage) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	for !s.closed && len(s.queue) >= s.cfg.QueueSize {
+		switch s.cfg.Overflow {
+		case OverflowDropNewest:
+			s.dropped++
+			s.logger.Printf("Alarm queue full, dropping new alarm: SP=%d action=%s", m.SpecificProblem, m.AlarmAction)
+			return ErrQueueFull
+		case OverflowBlock:
+			return errQueueBlocked
+		default:
+			s.dropped++
+			s.logger.Printf("Alarm queue full, dropping oldest alarm: SP=%d action=%s", s.queue[0].SpecificProblem, s.queue[0].AlarmAction)
+			s.queue = s.queue[1:]
+		}
+	}
+
+	if s.closed {
+		return ErrAlarmerClosed
+	}
+
+	s.queue = append(s.queue, m)
+	s.cond.Broadcast()
+	return nil
+}
+
+// waitForRoom blocks until there is room in the queue, the sender is closed or the context is done
+func (s *asyncSender) waitForRoom(ctx context.Context) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for !s.closed && len(s.queue) >= s.cfg.QueueSize {
+		if err := s.wait(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// wait blocks until the state of the queue changes or the context is done. Must be called with the mutex held.
+func (s *asyncSender) wait(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	woken := make(chan struct{})
+	defer close(woken)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.mutex.Lock()
+			s.cond.Broadcast()
+			s.mutex.Unlock()
+		case <-woken:
+		}
+	}()
+
+	s.cond.Wait()
+	return ctx.Err()
+}
+
+func (s *asyncSender) run() {
+	defer close(s.done)
+
+	for {
+		s.mutex.Lock()
+		for len(s.queue) == 0 && !s.closed {
+			s.cond.Wait()
+		}
+		if len(s.queue) == 0 {
+			s.mutex.Unlock()
+			return
+		}
+
+		m := s.queue[0]
+		s.queue = s.queue[1:]
+		s.inflight = true
+		s.cond.Broadcast()
+		s.mutex.Unlock()
+
+		s.deliver(m)
+
+		s.mutex.Lock()
+		s.inflight = false
+		s.cond.Broadcast()
+		s.mutex.Unlock()
+	}
+}
+
+// deliver sends the alarm, and retries with exponential backoff in case of failure. After close only one attempt is made.
+func (s *asyncSender) deliver(m AlarmMessage) {
+	backoff := s.cfg.InitialBackoff
+	for retries := 0; ; retries++ {
+		err := s.send(m)
+		if err == nil {
+			return
+		}
+
+		if s.cfg.MaxRetries < 0 || retries >= s.cfg.MaxRetries {
+			s.drop(m, err)
+			return
+		}
+
+		select {
+		case <-s.stop:
+			s.drop(m, err)
+			return
+		case <-time.After(backoff):
+		}
+
+		if backoff *= 2; backoff > s.cfg.MaxBackoff {
+			backoff = s.cfg.MaxBackoff
+		}
+	}
+}
+
+func (s *asyncSender) drop(m AlarmMessage, err error) {
+	s.mutex.Lock()
+	s.dropped++
+	s.mutex.Unlock()
+	s.logger.Printf("Alarm delivery failed, dropping alarm: SP=%d action=%s error=%v", m.SpecificProblem, m.AlarmAction, err)
+}
+
+// flush waits until all queued alarms are processed or the context is done
+func (s *asyncSender) flush(ctx context.Context) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for len(s.queue) > 0 || s.inflight {
+		if err := s.wait(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// close stops accepting new alarms, and waits until the queued alarms are processed without further retries
+func (s *asyncSender) close() {
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		<-s.done
+		return
+	}
+	s.closed = true
+	close(s.stop)
+	s.cond.Broadcast()
+	s.mutex.Unlock()
+
+	<-s.done
+}
+
+func (s *asyncSender) length() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return len(s.queue)
+}
+
+func (s *asyncSender) droppedCount() uint64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.dropped
+}
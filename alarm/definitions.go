@@ -0,0 +1,204 @@
+/*
+ *  Copyright (c) 2020 AT&T Intellectual Property.
+ *  Copyright (c) 2020 Nokia.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ * This source code is part of the near-RT RIC (RAN Intelligent Controller)
+ * platform project (RICP).
+ */
+
+package alarm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// How long to wait before fetching the alarm definitions again after a failure
+const definitionsFetchInterval = time.Minute
+
+// ErrInvalidAlarm is matched by all validation errors, see ValidationError
+var ErrInvalidAlarm = errors.New("invalid alarm")
+
+// ValidationError is returned when an alarm doesn't conform to the alarm definitions. Nothing is sent in that case.
+type ValidationError struct {
+	Alarm  Alarm
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("Invalid alarm (SP=%d IA=%s): %s", e.Alarm.SpecificProblem, e.Alarm.IdentifyingInfo, e.Reason)
+}
+
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrInvalidAlarm
+}
+
+// AlarmDefinitions is the format of the alarm definition file, and of the alarm manager /ric/v1/alarms/define response
+type AlarmDefinitions struct {
+	AlarmDefinitions []*AlarmDefinition `json:"alarmdefinitions"`
+}
+
+// LoadDefinitionsFile reads the alarm definitions from a JSON file, e.g. definitions/alarm-definition.json
+func LoadDefinitionsFile(path string) ([]*AlarmDefinition, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Reading alarm definitions failed: %w", err)
+	}
+
+	var defs AlarmDefinitions
+	if err := json.Unmarshal(data, &defs); err != nil {
+		return nil, fmt.Errorf("Parsing alarm definitions %s failed: %w", path, err)
+	}
+	return defs.AlarmDefinitions, nil
+}
+
+// SetDefinitions enables the validation of the alarms against the given alarm definitions
+func (r *RICAlarm) SetDefinitions(defs []*AlarmDefinition) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.definitions = make(map[int]*AlarmDefinition, len(defs))
+	for _, d := range defs {
+		r.definitions[d.AlarmId] = d
+	}
+}
+
+// LoadDefinitions enables the validation of the alarms against the alarm definitions read from a JSON file
+func (r *RICAlarm) LoadDefinitions(path string) error {
+	defs, err := LoadDefinitionsFile(path)
+	if err != nil {
+		return err
+	}
+	r.SetDefinitions(defs)
+	return nil
+}
+
+// FetchDefinitions enables the validation of the alarms against the alarm definitions of the alarm manager
+func (r *RICAlarm) FetchDefinitions(ctx context.Context) error {
+	defs, err := r.fetchDefinitions(ctx)
+	if err != nil {
+		return err
+	}
+	r.SetDefinitions(defs)
+	return nil
+}
+
+func (r *RICAlarm) fetchDefinitions(ctx context.Context) ([]*AlarmDefinition, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	url := fmt.Sprintf("%s/%s", r.managerUrl, "ric/v1/alarms/define")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("HttpError=Get failed with error: %w", err)
+	}
+
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("HttpError=Get failed with error: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if err := checkHTTPStatus(resp); err != nil {
+		return nil, err
+	}
+
+	var defs AlarmDefinitions
+	err = json.NewDecoder(resp.Body).Decode(&defs)
+	io.Copy(ioutil.Discard, resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("HttpError=Decoding alarm definitions failed with error: %w", err)
+	}
+	return defs.AlarmDefinitions, nil
+}
+
+// ensureDefinitions fetches the alarm definitions of the alarm manager before the first alarm is validated.
+// The fetch is done without the mutex held, so that the alarms sent meanwhile are not blocked, and only one
+// fetch is done at a time; the alarms sent during the fetch, or after it has failed, are not validated.
+func (r *RICAlarm) ensureDefinitions(ctx context.Context) {
+	if !r.definitionsNeeded() || !r.defsMutex.TryLock() {
+		return
+	}
+	defer r.defsMutex.Unlock()
+
+	// The definitions may have been fetched while the mutex was released
+	if !r.definitionsNeeded() {
+		return
+	}
+	defs, err := r.fetchDefinitions(ctx)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if err != nil {
+		r.fetchDefsNext = time.Now().Add(definitionsFetchInterval)
+		r.logger.Printf("Fetching alarm definitions failed, alarms not validated: %v", err)
+		return
+	}
+	r.definitions = make(map[int]*AlarmDefinition, len(defs))
+	for _, d := range defs {
+		r.definitions[d.AlarmId] = d
+	}
+}
+
+func (r *RICAlarm) definitionsNeeded() bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.definitions == nil && r.fetchDefs && time.Now().After(r.fetchDefsNext)
+}
+
+// validate checks the alarm against the alarm definitions. Nothing is checked until the definitions are
+// given. Must be called with the mutex held.
+func (r *RICAlarm) validate(a Alarm, action AlarmAction) error {
+	if r.definitions == nil {
+		return nil
+	}
+
+	if a.ManagedObjectId == "" || a.ApplicationId == "" {
+		return &ValidationError{Alarm: a, Reason: "managed object or application identity missing"}
+	}
+
+	if _, ok := r.definitions[a.SpecificProblem]; !ok {
+		return &ValidationError{Alarm: a, Reason: fmt.Sprintf("specific problem %d not defined", a.SpecificProblem)}
+	}
+
+	if a.IdentifyingInfo == "" {
+		return &ValidationError{Alarm: a, Reason: "identifying info missing"}
+	}
+
+	if action == AlarmActionRaise {
+		switch a.PerceivedSeverity {
+		case SeverityCritical, SeverityMajor, SeverityMinor, SeverityWarning, SeverityUnspecified:
+		default:
+			return &ValidationError{Alarm: a, Reason: fmt.Sprintf("invalid severity '%s'", a.PerceivedSeverity)}
+		}
+	}
+
+	switch a.TrendIndication {
+	case "", TrendMoreSevere, TrendNoChange, TrendLessSevere:
+	default:
+		return &ValidationError{Alarm: a, Reason: fmt.Sprintf("invalid trend indication '%s'", a.TrendIndication)}
+	}
+
+	if a.ThresholdInfo != nil && a.ThresholdInfo.TriggeredThreshold == "" {
+		return &ValidationError{Alarm: a, Reason: "triggered threshold missing from threshold info"}
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+/*
+ *  Copyright (c) 2020 AT&T Intellectual Property.
+ *  Copyright (c) 2020 Nokia.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ * This source code is part of the near-RT RIC (RAN Intelligent Controller)
+ * platform project (RICP).
+ */
+
+package alarm
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+var (
+	// ErrRMRNotReady is returned when sending via RMR before RMR is initialized
+	ErrRMRNotReady = errors.New("RmrError=rmr not ready")
+	// ErrRMRNotSupported is returned by the RMR transport when the library is built without cgo or with the normr build tag
+	ErrRMRNotSupported = errors.New("RmrError=rmr not supported, library built without cgo or with normr tag")
+	// ErrNoRMRTransport is returned by the RMR specific calls when the alarm instance doesn't use RMR
+	ErrNoRMRTransport = errors.New("rmr transport not in use")
+)
+
+// HTTPStatusError is returned when the alarm manager responds with a non-2xx status code
+type HTTPStatusError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Body       string
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("HttpError=%s %s failed with status: %d", e.Method, e.URL, e.StatusCode)
+}
+
+// Temporary returns true if the request may succeed when retried, i.e. for server errors, timeouts and throttling
+func (e *HTTPStatusError) Temporary() bool {
+	switch e.StatusCode {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return true
+	}
+	return e.StatusCode >= http.StatusInternalServerError
+}
+
+// RMRError is returned when an RMR operation fails. State is the RMR state code, or -1 if not available.
+type RMRError struct {
+	Op       string
+	Endpoint string
+	State    int
+}
+
+func (e *RMRError) Error() string {
+	if e.State < 0 {
+		return fmt.Sprintf("RmrError=%s via %s failed", e.Op, e.Endpoint)
+	}
+	return fmt.Sprintf("RmrError=%s via %s failed with error: %d", e.Op, e.Endpoint, e.State)
+}
+
+// FallbackError holds the errors of all transports tried by FallbackTransport.
+// errors.Is and errors.As match any of the errors.
+type FallbackError struct {
+	Errors []error
+}
+
+func (e *FallbackError) Error() string {
+	s := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		s[i] = err.Error()
+	}
+	return strings.Join(s, " and  ")
+}
+
+func (e *FallbackError) Is(target error) bool {
+	for _, err := range e.Errors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *FallbackError) As(target interface{}) bool {
+	for _, err := range e.Errors {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
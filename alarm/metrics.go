@@ -0,0 +1,217 @@
+/*
+ *  Copyright (c) 2020 AT&T Intellectual Property.
+ *  Copyright (c) 2020 Nokia.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ * This source code is part of the near-RT RIC (RAN Intelligent Controller)
+ * platform project (RICP).
+ */
+
+package alarm
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Namespace of the Prometheus metrics of the alarm library
+const metricsNamespace = "alarm_client"
+
+// metrics holds the Prometheus collectors of the alarm library. The collectors are shared by the alarm
+// instances registered to the same registerer.
+type metrics struct {
+	attempts      *prometheus.CounterVec
+	successes     *prometheus.CounterVec
+	failures      *prometheus.CounterVec
+	rmrFailures   *prometheus.CounterVec
+	httpFallbacks *prometheus.CounterVec
+	queueDepth    *prometheus.GaugeVec
+	sendLatency   *prometheus.HistogramVec
+}
+
+func newMetrics(reg prometheus.Registerer) (*metrics, error) {
+	if reg == nil {
+		reg = prometheus.DefaultRegisterer
+	}
+
+	m := &metrics{
+		attempts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "attempts_total",
+			Help:      "The total number of alarm delivery attempts",
+		}, []string{"action", "sp"}),
+		successes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "successes_total",
+			Help:      "The total number of alarms delivered to the alarm manager",
+		}, []string{"action", "sp", "transport"}),
+		failures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "failures_total",
+			Help:      "The total number of alarms not delivered to the alarm manager",
+		}, []string{"action", "sp"}),
+		rmrFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "rmr_failures_total",
+			Help:      "The total number of alarms not sent via RMR",
+		}, []string{"sp"}),
+		httpFallbacks: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_fallbacks_total",
+			Help:      "The total number of alarms posted via HTTP after a failure of the preceding transport",
+		}, []string{"sp"}),
+		queueDepth: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "queue_depth",
+			Help:      "The number of alarms waiting for asynchronous delivery",
+		}, []string{"application"}),
+		sendLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "send_duration_seconds",
+			Help:      "The time taken to send an alarm",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"sp", "transport"}),
+	}
+
+	var err error
+	if m.attempts, err = registerCounterVec(reg, m.attempts); err != nil {
+		return nil, err
+	}
+	if m.successes, err = registerCounterVec(reg, m.successes); err != nil {
+		return nil, err
+	}
+	if m.failures, err = registerCounterVec(reg, m.failures); err != nil {
+		return nil, err
+	}
+	if m.rmrFailures, err = registerCounterVec(reg, m.rmrFailures); err != nil {
+		return nil, err
+	}
+	if m.httpFallbacks, err = registerCounterVec(reg, m.httpFallbacks); err != nil {
+		return nil, err
+	}
+	c, err := register(reg, m.queueDepth)
+	if err != nil {
+		return nil, err
+	}
+	m.queueDepth = c.(*prometheus.GaugeVec)
+
+	if c, err = register(reg, m.sendLatency); err != nil {
+		return nil, err
+	}
+	m.sendLatency = c.(*prometheus.HistogramVec)
+	return m, nil
+}
+
+// register registers the collector, or returns the collector already registered by another alarm instance
+func register(reg prometheus.Registerer, c prometheus.Collector) (prometheus.Collector, error) {
+	if err := reg.Register(c); err != nil {
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			return are.ExistingCollector, nil
+		}
+		return nil, err
+	}
+	return c, nil
+}
+
+func registerCounterVec(reg prometheus.Registerer, c *prometheus.CounterVec) (*prometheus.CounterVec, error) {
+	existing, err := register(reg, c)
+	if err != nil {
+		return nil, err
+	}
+	return existing.(*prometheus.CounterVec), nil
+}
+
+// transportName returns the value of the transport label
+func transportName(t Transport) string {
+	switch t.(type) {
+	case *rmrTransport:
+		return "rmr"
+	case *HTTPTransport:
+		return "http"
+	case *MemoryTransport:
+		return "memory"
+	case *FallbackTransport:
+		return "fallback"
+	}
+	return "other"
+}
+
+// sendObserver is called for each transport tried by the fallback transport
+type sendObserver func(idx int, t Transport, err error, d time.Duration)
+
+type sendObserverKey struct{}
+
+func withSendObserver(ctx context.Context, o sendObserver) context.Context {
+	return context.WithValue(ctx, sendObserverKey{}, o)
+}
+
+func sendObserverFrom(ctx context.Context) sendObserver {
+	o, _ := ctx.Value(sendObserverKey{}).(sendObserver)
+	return o
+}
+
+// send sends the alarm message with the transport and updates the metrics
+func (m *metrics) send(ctx context.Context, t Transport, a AlarmMessage) error {
+	action := strings.ToLower(string(a.AlarmAction))
+	sp := strconv.Itoa(a.SpecificProblem)
+	m.attempts.WithLabelValues(action, sp).Inc()
+
+	// The fallback transport reports each transport tried, other transports are observed as a whole
+	observed := false
+	observe := func(idx int, tr Transport, err error, d time.Duration) {
+		observed = true
+		name := transportName(tr)
+		m.sendLatency.WithLabelValues(sp, name).Observe(d.Seconds())
+		if idx > 0 && name == "http" {
+			m.httpFallbacks.WithLabelValues(sp).Inc()
+		}
+		if err == nil {
+			m.successes.WithLabelValues(action, sp, name).Inc()
+		} else if name == "rmr" {
+			m.rmrFailures.WithLabelValues(sp).Inc()
+		}
+	}
+
+	start := time.Now()
+	err := t.Send(withSendObserver(ctx, observe), a)
+	if !observed {
+		observe(0, t, err, time.Since(start))
+	}
+
+	if err != nil {
+		m.failures.WithLabelValues(action, sp).Inc()
+	}
+	return err
+}
+
+func (m *metrics) setQueueDepth(app string, n int) {
+	m.queueDepth.WithLabelValues(app).Set(float64(n))
+}
+
+// EnableMetrics registers the Prometheus collectors of the alarm library to the registerer, or to the
+// default registerer if nil. The alarm delivery attempts, successes and failures, RMR failures, HTTP
+// fallbacks, queue depth and send latency are labelled by specific problem and transport.
+func (r *RICAlarm) EnableMetrics(reg prometheus.Registerer) error {
+	m, err := newMetrics(reg)
+	if err != nil {
+		return err
+	}
+
+	r.metrics.Store(m)
+	return nil
+}
@@ -0,0 +1,239 @@
+/*
+ *  Copyright (c) 2020 AT&T Intellectual Property.
+ *  Copyright (c) 2020 Nokia.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ * This source code is part of the near-RT RIC (RAN Intelligent Controller)
+ * platform project (RICP).
+ */
+
+package alarm
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+	"unsafe"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Default RMR port the alarm library listens on
+const DefaultRMRListenPort = 4588
+
+// RMRRouting selects how the RMR transport routes the alarm messages to the alarm manager
+type RMRRouting int
+
+const (
+	// RMRRoutingStatic sends the alarm messages directly to the alarm manager RMR endpoint over an RMR wormhole,
+	// without a route table. This is the default.
+	RMRRoutingStatic RMRRouting = iota
+	// RMRRoutingDynamic gets the route table from the routing manager, as configured by the RMR environment
+	// variables of the application.
+	RMRRoutingDynamic
+)
+
+// Logger is the interface used for logging by the alarm library. The standard *log.Logger satisfies it.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// Option configures an alarm instance created with InitAlarm
+type Option func(*options)
+
+type options struct {
+	managerUrl      string
+	rmrEndpoint     string
+	listenPort      int
+	rmrRouting      RMRRouting
+	rmrContext      unsafe.Pointer
+	transport       Transport
+	logger          Logger
+	httpClient      *http.Client
+	httpConfig      HTTPConfig
+	timeout         time.Duration
+	async           *AsyncConfig
+	rateLimit       *RateLimitConfig
+	definitionsFile string
+	fetchDefs       bool
+	resync          *ResyncConfig
+	metrics         bool
+	registerer      prometheus.Registerer
+}
+
+// WithManagerURL sets the URL of the alarm manager REST interface. Default is ALARM_MANAGER_URL environment variable.
+func WithManagerURL(url string) Option {
+	return func(o *options) {
+		o.managerUrl = url
+	}
+}
+
+// WithRMREndpoint sets the RMR endpoint of the alarm manager.
+// Default is ALARM_MANAGER_SERVICE_NAME:ALARM_MANAGER_SERVICE_PORT environment variables.
+func WithRMREndpoint(endpoint string) Option {
+	return func(o *options) {
+		o.rmrEndpoint = endpoint
+	}
+}
+
+// WithListenPort sets the port the RMR transport listens on. Default is DefaultRMRListenPort.
+func WithListenPort(port int) Option {
+	return func(o *options) {
+		o.listenPort = port
+	}
+}
+
+// WithRMRRouting sets how the RMR transport routes the alarm messages. Default is RMRRoutingStatic.
+func WithRMRRouting(mode RMRRouting) Option {
+	return func(o *options) {
+		o.rmrRouting = mode
+	}
+}
+
+// WithRMRContext shares an RMR context already initialized by the application, e.g. the context of
+// the xapp-frame RMR client, instead of initializing a new one. The context of the application is not
+// detected, i.e. it's shared only when given with this option. The alarms are sent with the route table
+// of the application, which must route RIC_ALARM_UPDATE messages to the alarm manager. The queries are
+// not sent with the shared context, but over a wormhole to the alarm manager RMR endpoint, from a context
+// of the alarm instance listening on the listen port. The shared context is not closed by the alarm
+// instance, and ReceiveMessage must not be used with a shared context.
+func WithRMRContext(ctx unsafe.Pointer) Option {
+	return func(o *options) {
+		o.rmrContext = ctx
+	}
+}
+
+// WithTransport sets the transport for delivering the alarms. By default, alarms are sent via RMR
+// and posted via HTTP in case RMR is not available.
+func WithTransport(t Transport) Option {
+	return func(o *options) {
+		o.transport = t
+	}
+}
+
+// WithLogger sets the logger of the alarm instance. Default is the standard logger.
+func WithLogger(l Logger) Option {
+	return func(o *options) {
+		o.logger = l
+	}
+}
+
+// WithHTTPClient sets the HTTP client used for the alarm manager REST interface
+func WithHTTPClient(c *http.Client) Option {
+	return func(o *options) {
+		o.httpClient = c
+	}
+}
+
+// WithHTTPConfig sets the parameters of the HTTP client used for the alarm manager REST interface,
+// e.g. TLS and retries. The retry parameters apply also if the client is given with WithHTTPClient.
+func WithHTTPConfig(cfg HTTPConfig) Option {
+	return func(o *options) {
+		o.httpConfig = cfg
+	}
+}
+
+// WithTimeout limits the time a single alarm delivery or query may take, regardless of the context given
+func WithTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.timeout = d
+	}
+}
+
+// WithDefinitionsFile enables the validation of the alarms against the alarm definitions read from
+// a JSON file, e.g. definitions/alarm-definition.json
+func WithDefinitionsFile(path string) Option {
+	return func(o *options) {
+		o.definitionsFile = path
+	}
+}
+
+// WithDefinitionsFromManager enables the validation of the alarms against the alarm definitions of
+// the alarm manager. The definitions are fetched when the first alarm is sent, and the alarms sent while
+// fetching, or after the fetch has failed, are not validated.
+func WithDefinitionsFromManager() Option {
+	return func(o *options) {
+		o.fetchDefs = true
+	}
+}
+
+// WithRateLimit enables the client-side flood protection, see EnableRateLimit
+func WithRateLimit(cfg RateLimitConfig) Option {
+	return func(o *options) {
+		o.rateLimit = &cfg
+	}
+}
+
+// WithAsync enables the asynchronous delivery, see EnableAsync
+func WithAsync(cfg AsyncConfig) Option {
+	return func(o *options) {
+		o.async = &cfg
+	}
+}
+
+// WithResync enables the automatic resynchronization with the alarm manager, see EnableResync
+func WithResync(cfg ResyncConfig) Option {
+	return func(o *options) {
+		o.resync = &cfg
+	}
+}
+
+// WithMetrics registers the Prometheus collectors of the alarm library, see EnableMetrics
+func WithMetrics(reg prometheus.Registerer) Option {
+	return func(o *options) {
+		o.metrics = true
+		o.registerer = reg
+	}
+}
+
+// defaultOptions returns the options given by the environment
+func defaultOptions() options {
+	o := options{
+		managerUrl:  ALARM_MANAGER_HTTP_URL,
+		rmrEndpoint: ALARM_MANAGER_RMR_URL,
+		listenPort:  DefaultRMRListenPort,
+	}
+
+	//
+	// http service information (used in case of no rmr connectivity)
+	//
+	if os.Getenv("ALARM_MANAGER_URL") != "" {
+		o.managerUrl = os.Getenv("ALARM_MANAGER_URL")
+	}
+
+	if os.Getenv("ALARM_MANAGER_SERVICE_NAME") != "" && os.Getenv("ALARM_MANAGER_SERVICE_PORT") != "" {
+		o.rmrEndpoint = fmt.Sprintf("%s:%s", os.Getenv("ALARM_MANAGER_SERVICE_NAME"), os.Getenv("ALARM_MANAGER_SERVICE_PORT"))
+	}
+	return o
+}
+
+// rmrConfig holds the parameters of the RMR transport
+type rmrConfig struct {
+	endpoint string
+	port     int
+	routing  RMRRouting
+	shared   unsafe.Pointer
+	logger   Logger
+}
+
+func (o options) rmrConfig() rmrConfig {
+	return rmrConfig{
+		endpoint: o.rmrEndpoint,
+		port:     o.listenPort,
+		routing:  o.rmrRouting,
+		shared:   o.rmrContext,
+		logger:   o.logger,
+	}
+}
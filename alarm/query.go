@@ -0,0 +1,105 @@
+/*
+ *  Copyright (c) 2020 AT&T Intellectual Property.
+ *  Copyright (c) 2020 Nokia.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ * This source code is part of the near-RT RIC (RAN Intelligent Controller)
+ * platform project (RICP).
+ */
+
+package alarm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// Match returns true if the alarm matches all non-empty fields of the filter
+func (f AlarmFilter) Match(a Alarm) bool {
+	if f.ManagedObjectId != "" && f.ManagedObjectId != a.ManagedObjectId {
+		return false
+	}
+	if f.ApplicationId != "" && f.ApplicationId != a.ApplicationId {
+		return false
+	}
+	if f.SpecificProblem != 0 && f.SpecificProblem != a.SpecificProblem {
+		return false
+	}
+	if f.PerceivedSeverity != "" && f.PerceivedSeverity != a.PerceivedSeverity {
+		return false
+	}
+	return true
+}
+
+// QueryActive returns the alarms the alarm manager currently considers active and matching the filter
+func (r *RICAlarm) QueryActive(filter AlarmFilter) ([]AlarmMessage, error) {
+	return r.QueryActiveContext(context.Background(), filter)
+}
+
+// QueryActiveContext queries the active alarms via RMR, or via the REST interface of the alarm manager
+// if RMR is not available, and gives up when the context is done
+func (r *RICAlarm) QueryActiveContext(ctx context.Context, filter AlarmFilter) ([]AlarmMessage, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	if r.rmr != nil && r.rmr.isReady() {
+		resp, err := r.rmr.query(ctx, filter)
+		if err == nil && !resp.Truncated {
+			return resp.Alarms, nil
+		}
+
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		r.logger.Printf("Alarm query via rmr failed or truncated, querying via http: %v", err)
+	}
+	return r.queryActiveHTTP(ctx, filter)
+}
+
+func (r *RICAlarm) queryActiveHTTP(ctx context.Context, filter AlarmFilter) ([]AlarmMessage, error) {
+	url := fmt.Sprintf("%s/%s", r.managerUrl, "ric/v1/alarms/active")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("HttpError=Get failed with error: %w", err)
+	}
+
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("HttpError=Get failed with error: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if err := checkHTTPStatus(resp); err != nil {
+		return nil, err
+	}
+
+	var active []AlarmMessage
+	err = json.NewDecoder(resp.Body).Decode(&active)
+	io.Copy(ioutil.Discard, resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("HttpError=Decoding active alarms failed with error: %w", err)
+	}
+
+	alarms := make([]AlarmMessage, 0, len(active))
+	for _, m := range active {
+		if filter.Match(m.Alarm) {
+			alarms = append(alarms, m)
+		}
+	}
+	return alarms, nil
+}
@@ -0,0 +1,206 @@
+/*
+ *  Copyright (c) 2020 AT&T Intellectual Property.
+ *  Copyright (c) 2020 Nokia.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ * This source code is part of the near-RT RIC (RAN Intelligent Controller)
+ * platform project (RICP).
+ */
+
+package alarm
+
+import (
+	"errors"
+	"reflect"
+	"time"
+)
+
+// ErrRateLimited is returned when an alarm is suppressed by the rate limits. Nothing is sent in that case.
+var ErrRateLimited = errors.New("alarm rate limit exceeded")
+
+// Maximum number of per-alarm token buckets kept, idle buckets are discarded above this
+const maxRateLimitBuckets = 10000
+
+// RateLimitConfig holds the parameters of the client-side flood protection. Zero rates are unlimited.
+type RateLimitConfig struct {
+	Rate               float64 // Alarms per second allowed for the whole alarm instance
+	Burst              int     // Number of alarms allowed in a burst, 0 = Rate rounded up
+	PerAlarmRate       float64 // Alarms per second allowed per specific problem and identifying info
+	PerAlarmBurst      int     // Number of alarms allowed in a burst per alarm, 0 = PerAlarmRate rounded up
+	CollapseDuplicates bool    // Raising an alarm already raised with same severity and additional info is not sent again
+}
+
+// SuppressionStats holds the number of alarms suppressed locally
+type SuppressionStats struct {
+	Duplicates  uint64 // Repeated raises of an identical, already raised alarm
+	RateLimited uint64 // Alarms exceeding the rate limits
+}
+
+// tokenBucket allows rate events per second on average, and burst events at once
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int, now time.Time) *tokenBucket {
+	if burst <= 0 {
+		burst = int(rate)
+		if float64(burst) < rate {
+			burst++
+		}
+	}
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: now}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	if b.tokens += now.Sub(b.last).Seconds() * b.rate; b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+}
+
+func (b *tokenBucket) allow(now time.Time) bool {
+	b.refill(now)
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+type rateLimitKey struct {
+	sp    int
+	iinfo string
+}
+
+type rateLimiter struct {
+	cfg      RateLimitConfig
+	global   *tokenBucket
+	perAlarm map[rateLimitKey]*tokenBucket
+	stats    SuppressionStats
+}
+
+func newRateLimiter(cfg RateLimitConfig) *rateLimiter {
+	l := &rateLimiter{cfg: cfg, perAlarm: make(map[rateLimitKey]*tokenBucket)}
+	if cfg.Rate > 0 {
+		l.global = newTokenBucket(cfg.Rate, cfg.Burst, time.Now())
+	}
+	return l
+}
+
+// allow takes a token from the per-alarm and the global bucket, if both have one
+func (l *rateLimiter) allow(a Alarm) bool {
+	now := time.Now()
+
+	var bucket *tokenBucket
+	if l.cfg.PerAlarmRate > 0 {
+		key := rateLimitKey{a.SpecificProblem, a.IdentifyingInfo}
+		if bucket = l.perAlarm[key]; bucket == nil {
+			l.prune(now)
+			bucket = newTokenBucket(l.cfg.PerAlarmRate, l.cfg.PerAlarmBurst, now)
+			l.perAlarm[key] = bucket
+		}
+
+		if bucket.refill(now); bucket.tokens < 1 {
+			return false
+		}
+	}
+
+	if l.global != nil && !l.global.allow(now) {
+		return false
+	}
+
+	if bucket != nil {
+		bucket.tokens--
+	}
+	return true
+}
+
+// prune discards the per-alarm buckets which are full, i.e. idle, when there are too many of them
+func (l *rateLimiter) prune(now time.Time) {
+	if len(l.perAlarm) < maxRateLimitBuckets {
+		return
+	}
+
+	for key, b := range l.perAlarm {
+		if b.refill(now); b.tokens >= b.burst {
+			delete(l.perAlarm, key)
+		}
+	}
+}
+
+// EnableRateLimit enables the client-side flood protection. Raises exceeding the limits are not sent and
+// ErrRateLimited is returned. Clears are always sent, so that no alarm is left active. Repeated raises of an identical alarm are optionally collapsed locally.
+func (r *RICAlarm) EnableRateLimit(cfg RateLimitConfig) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.limiter = newRateLimiter(cfg)
+}
+
+// SuppressedCounts returns the number of alarms suppressed by the flood protection
+func (r *RICAlarm) SuppressedCounts() SuppressionStats {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.limiter == nil {
+		return SuppressionStats{}
+	}
+	return r.limiter.stats
+}
+
+// isDuplicate returns true if an identical alarm has already been delivered to the alarm manager.
+// Must be called with the mutex held.
+func (r *RICAlarm) isDuplicate(a Alarm) bool {
+	if r.limiter == nil || !r.limiter.cfg.CollapseDuplicates {
+		return false
+	}
+
+	r.deliveredMutex.Lock()
+	prev, ok := r.delivered[newAlarmKey(a)]
+	r.deliveredMutex.Unlock()
+
+	if ok && reflect.DeepEqual(prev, a) {
+		r.limiter.stats.Duplicates++
+		return true
+	}
+	return false
+}
+
+// updateDelivered keeps track of the alarms successfully sent to the alarm manager. Unlike the outstanding
+// alarms, an alarm whose raise failed is not included, so that raising it again is not collapsed. Clears are
+// applied already when dispatched, i.e. before they are sent in async mode.
+// It is called also by the async sender, without the mutex held.
+func (r *RICAlarm) updateDelivered(m AlarmMessage) {
+	r.deliveredMutex.Lock()
+	defer r.deliveredMutex.Unlock()
+
+	if r.delivered == nil {
+		r.delivered = make(map[alarmKey]Alarm)
+	}
+	applyAlarmAction(r.delivered, m)
+}
+
+// isRateLimited returns true if the alarm exceeds the rate limits. Must be called with the mutex held.
+func (r *RICAlarm) isRateLimited(a Alarm) bool {
+	if r.limiter == nil || r.limiter.allow(a) {
+		return false
+	}
+
+	r.limiter.stats.RateLimited++
+	r.logger.Printf("Alarm rate limit exceeded, alarm suppressed: %s", r.AlarmString(AlarmMessage{Alarm: a}))
+	return true
+}
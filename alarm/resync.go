@@ -0,0 +1,243 @@
+/*
+ *  Copyright (c) 2020 AT&T Intellectual Property.
+ *  Copyright (c) 2020 Nokia.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ * This source code is part of the near-RT RIC (RAN Intelligent Controller)
+ * platform project (RICP).
+ */
+
+package alarm
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const DefaultResyncInterval = 30 * time.Second
+
+// ResyncConfig holds the parameters of the automatic resynchronization with the alarm manager
+type ResyncConfig struct {
+	Interval   time.Duration // How often the alarm manager is checked for restart, 0 = DefaultResyncInterval
+	ClearFirst bool          // Clear all alarms of the application before re-raising the outstanding alarms
+}
+
+// alarmKey is the identity of an alarm, see IsMatchFound() in the alarm manager
+type alarmKey struct {
+	mo    string
+	app   string
+	sp    int
+	iinfo string
+}
+
+func newAlarmKey(a Alarm) alarmKey {
+	return alarmKey{a.ManagedObjectId, a.ApplicationId, a.SpecificProblem, a.IdentifyingInfo}
+}
+
+type resyncer struct {
+	cfg      ResyncConfig
+	trigger  chan struct{}
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// updateOutstanding keeps track of the alarms raised and not yet cleared. Must be called with the mutex held.
+func (r *RICAlarm) updateOutstanding(m AlarmMessage) {
+	if r.outstanding == nil {
+		r.outstanding = make(map[alarmKey]Alarm)
+	}
+	applyAlarmAction(r.outstanding, m)
+}
+
+// applyAlarmAction updates the set of raised alarms according to the action of the alarm message
+func applyAlarmAction(alarms map[alarmKey]Alarm, m AlarmMessage) {
+	switch m.AlarmAction {
+	case AlarmActionRaise, AlarmActionUpdate:
+		alarms[newAlarmKey(m.Alarm)] = m.Alarm
+	case AlarmActionClear:
+		delete(alarms, newAlarmKey(m.Alarm))
+	case AlarmActionClearAll:
+		for k := range alarms {
+			if k.mo == m.ManagedObjectId && k.app == m.ApplicationId {
+				delete(alarms, k)
+			}
+		}
+	}
+}
+
+// Outstanding returns the alarms raised by this instance and not yet cleared
+func (r *RICAlarm) Outstanding() []Alarm {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	alarms := make([]Alarm, 0, len(r.outstanding))
+	for _, a := range r.outstanding {
+		alarms = append(alarms, a)
+	}
+	return alarms
+}
+
+// Resync re-raises all outstanding alarms, so that the alarm manager state converges with the application state.
+// If clearFirst is set, all alarms of the application are cleared before re-raising.
+func (r *RICAlarm) Resync(clearFirst bool) error {
+	return r.ResyncContext(context.Background(), clearFirst)
+}
+
+// ResyncContext re-raises all outstanding alarms, and gives up when the context is done
+func (r *RICAlarm) ResyncContext(ctx context.Context, clearFirst bool) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.logger.Printf("Resyncing %d outstanding alarms with alarm manager", len(r.outstanding))
+	if clearFirst {
+		a := r.NewAlarm(0, SeverityDefault, "", "")
+		if err := r.dispatch(ctx, r.NewAlarmMessage(a, AlarmActionClearAll)); err != nil {
+			return fmt.Errorf("Resync failed: %v", err)
+		}
+	}
+
+	// The mutex may be released while dispatching, so the outstanding alarms are copied first
+	alarms := make([]Alarm, 0, len(r.outstanding))
+	for _, a := range r.outstanding {
+		alarms = append(alarms, a)
+	}
+	for _, a := range alarms {
+		if err := r.dispatch(ctx, r.NewAlarmMessage(a, AlarmActionRaise)); err != nil {
+			return fmt.Errorf("Resync failed: %v", err)
+		}
+	}
+	return nil
+}
+
+// EnableResync starts checking the alarm manager periodically. If the alarm manager has been restarted, or
+// it becomes reachable again after a failure, the outstanding alarms are re-raised.
+func (r *RICAlarm) EnableResync(cfg ResyncConfig) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.resync.Load() != nil {
+		return
+	}
+
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultResyncInterval
+	}
+	rs := &resyncer{
+		cfg:     cfg,
+		trigger: make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	r.resync.Store(rs)
+	go r.runResync(rs)
+}
+
+// triggerResync requests a resync in background, e.g. after the transport has recovered from a failure
+func (r *RICAlarm) triggerResync() {
+	rs := r.resync.Load()
+	if rs == nil {
+		return
+	}
+
+	select {
+	case rs.trigger <- struct{}{}:
+	default:
+	}
+}
+
+func (r *RICAlarm) runResync(rs *resyncer) {
+	defer close(rs.done)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-rs.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	ticker := time.NewTicker(rs.cfg.Interval)
+	defer ticker.Stop()
+
+	instance, err := r.getManagerInstance(ctx)
+	failed := err != nil
+	for {
+		select {
+		case <-rs.stop:
+			return
+		case <-rs.trigger:
+			r.logger.Printf("Alarm manager reachable again, resyncing alarms")
+			r.ResyncContext(ctx, rs.cfg.ClearFirst)
+		case <-ticker.C:
+			current, err := r.getManagerInstance(ctx)
+			if err != nil {
+				failed = true
+				continue
+			}
+
+			if failed {
+				r.logger.Printf("Alarm manager reachable again, resyncing alarms")
+				r.ResyncContext(ctx, rs.cfg.ClearFirst)
+			} else if instance != "" && current != "" && current != instance {
+				r.logger.Printf("Alarm manager restarted (instance %s -> %s), resyncing alarms", instance, current)
+				r.ResyncContext(ctx, rs.cfg.ClearFirst)
+			}
+			failed = false
+			instance = current
+		}
+	}
+}
+
+// stopResync stops the resync goroutine and waits until it has finished. It can be called several times.
+func (r *RICAlarm) stopResync() {
+	rs := r.resync.Load()
+	if rs == nil {
+		return
+	}
+	rs.stopOnce.Do(func() { close(rs.stop) })
+	<-rs.done
+}
+
+// getManagerInstance returns the instance identity of the alarm manager, which changes when the alarm manager restarts
+func (r *RICAlarm) getManagerInstance(ctx context.Context) (string, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	url := fmt.Sprintf("%s/%s", r.managerUrl, "ric/v1/alarms/config")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", fmt.Errorf("HttpError=Get failed with error: %w", err)
+	}
+
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("HttpError=Get failed with error: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if err := checkHTTPStatus(resp); err != nil {
+		return "", err
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+
+	return resp.Header.Get(ALARM_MANAGER_INSTANCE_HEADER), nil
+}
@@ -0,0 +1,384 @@
+//go:build cgo && !normr
+
+/*
+ *  Copyright (c) 2020 AT&T Intellectual Property.
+ *  Copyright (c) 2020 Nokia.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ * This source code is part of the near-RT RIC (RAN Intelligent Controller)
+ * platform project (RICP).
+ */
+
+package alarm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+/*
+#cgo CFLAGS: -I../
+#cgo LDFLAGS: -lrmr_si
+
+#include "utils.h"
+*/
+import "C"
+
+const (
+	rmrMaxRetries        = 10
+	rmrRetryDelay        = 10 * time.Millisecond
+	rmrReadyPollInterval = 100 * time.Millisecond
+	rmrCallMaxWait       = 5000 // milliseconds
+)
+
+// rmrTransport sends the alarm messages to the alarm manager via RMR
+type rmrTransport struct {
+	cfg      rmrConfig
+	endpoint string
+	logger   Logger
+	mutex    sync.Mutex
+	ctx      unsafe.Pointer
+	whid     C.rmr_whid_t   // Wormhole to the alarm manager with the static routing, -1 otherwise
+	callCtx  unsafe.Pointer // Context of the queries with a shared context, opened on the first query
+	callWh   C.rmr_whid_t   // Wormhole of the queries with a shared context
+	ready    bool
+	callId   uint32
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func newRMRTransport(cfg rmrConfig) *rmrTransport {
+	return &rmrTransport{cfg: cfg, endpoint: cfg.endpoint, logger: cfg.logger, whid: -1, callWh: -1, stop: make(chan struct{})}
+}
+
+// NewRMRTransport returns a transport which sends alarms via RMR to the given endpoint.
+// RMR is initialized in background, and sending fails until RMR is ready.
+func NewRMRTransport(endpoint string) Transport {
+	o := defaultOptions()
+	o.rmrEndpoint = endpoint
+	o.logger = log.Default()
+
+	t := newRMRTransport(o.rmrConfig())
+	go t.init()
+	return t
+}
+
+// init initializes the RMR context, unless shared by the application, and waits until RMR is ready
+// or the transport is closed
+func (t *rmrTransport) init() error {
+	ctx := t.cfg.shared
+	if ctx == nil {
+		flags := C.int(C.RMRFL_MTCALL)
+		if t.useWormhole() {
+			flags |= C.RMRFL_NOTHREAD
+		}
+
+		var err error
+		if ctx, err = t.open(flags); err != nil {
+			t.logger.Printf("RMR initialization failed: %v", err)
+			return err
+		}
+	}
+
+	whid := C.rmr_whid_t(-1)
+	ticker := time.NewTicker(rmrReadyPollInterval)
+	defer ticker.Stop()
+	for !t.connect(ctx, &whid) {
+		select {
+		case <-t.stop:
+			return ErrRMRNotReady
+		case <-ticker.C:
+		}
+	}
+
+	t.mutex.Lock()
+	t.ctx = ctx
+	t.whid = whid
+	t.ready = true
+	t.mutex.Unlock()
+	t.logger.Printf("RMR is ready now, listening on port %d", t.cfg.port)
+	return nil
+}
+
+// useWormhole tells if the alarm messages are sent over a wormhole to the alarm manager endpoint
+// instead of being routed with a route table
+func (t *rmrTransport) useWormhole() bool {
+	return t.cfg.shared == nil && t.cfg.routing == RMRRoutingStatic
+}
+
+// open initializes a new RMR context with the given flags.
+//
+// The route table collector of RMR reads the route table file and the routing mode from the environment,
+// which belongs to the application. With the static routing the collector is not started at all: the alarm
+// messages are sent over a wormhole, i.e. a direct connection, to the alarm manager endpoint, and the query
+// replies come back over the same connection. With the dynamic routing the collector uses the RMR
+// configuration of the application as such. The environment is never changed.
+//
+// The contexts are always initialized with MTCALL flag, so that the queries waiting for a reply don't
+// consume the messages received in the meantime.
+func (t *rmrTransport) open(flags C.int) (unsafe.Pointer, error) {
+	port := C.CString(fmt.Sprintf("tcp:%d", t.cfg.port))
+	defer C.free(unsafe.Pointer(port))
+
+	ctx := C.rmrInit(port, flags)
+	if ctx == nil {
+		return nil, &RMRError{Op: "rmrInit", Endpoint: t.endpoint, State: -1}
+	}
+	return ctx, nil
+}
+
+// connect returns true when the alarm messages can be sent, i.e. the wormhole to the alarm manager is open,
+// or the route table has been received
+func (t *rmrTransport) connect(ctx unsafe.Pointer, whid *C.rmr_whid_t) bool {
+	if !t.useWormhole() {
+		return C.rmr_ready(ctx) != 0
+	}
+
+	_, err := t.wormhole(ctx, whid)
+	return err == nil
+}
+
+// wormhole returns the wormhole to the alarm manager. The wormhole is reopened if the connection has been
+// lost, e.g. when the alarm manager has been restarted; until the alarm manager is reachable again, an error
+// is returned, and the alarms are posted via HTTP.
+func (t *rmrTransport) wormhole(ctx unsafe.Pointer, whid *C.rmr_whid_t) (C.rmr_whid_t, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if *whid >= 0 {
+		if C.rmr_wh_state(ctx, *whid) == C.RMR_OK {
+			return *whid, nil
+		}
+		C.rmr_wh_close(ctx, *whid)
+		t.logger.Printf("RMR connection to %s lost, reconnecting", t.endpoint)
+	}
+
+	endpoint := C.CString(t.endpoint)
+	defer C.free(unsafe.Pointer(endpoint))
+
+	if *whid = C.rmr_wh_open(ctx, endpoint); *whid < 0 {
+		return -1, &RMRError{Op: "rmrWhOpen", Endpoint: t.endpoint, State: -1}
+	}
+	return *whid, nil
+}
+
+func (t *rmrTransport) isReady() bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.ready
+}
+
+// context returns the RMR context, or nil if RMR is not ready
+func (t *rmrTransport) context() unsafe.Pointer {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if !t.ready {
+		return nil
+	}
+	return t.ctx
+}
+
+// caller returns the RMR context and the wormhole the queries are sent with, or -1 if the queries are routed.
+// rmr_call is never used, since it would consume the messages received by the application while waiting for
+// the reply. A context shared by the application may lack MTCALL flag, so the queries are not sent with it:
+// a context of the transport is opened for the queries instead, and they are sent over a wormhole to the
+// alarm manager.
+func (t *rmrTransport) caller() (unsafe.Pointer, C.rmr_whid_t, error) {
+	rmrCtx := t.context()
+	if rmrCtx == nil {
+		return nil, -1, ErrRMRNotReady
+	}
+
+	switch {
+	case t.useWormhole():
+		whid, err := t.wormhole(rmrCtx, &t.whid)
+		return rmrCtx, whid, err
+	case t.cfg.shared == nil:
+		return rmrCtx, -1, nil
+	}
+
+	t.mutex.Lock()
+	if t.callCtx == nil {
+		callCtx, err := t.open(C.RMRFL_NOTHREAD | C.RMRFL_MTCALL)
+		if err != nil {
+			t.mutex.Unlock()
+			return nil, -1, err
+		}
+		t.callCtx = callCtx
+	}
+	callCtx := t.callCtx
+	t.mutex.Unlock()
+
+	whid, err := t.wormhole(callCtx, &t.callWh)
+	return callCtx, whid, err
+}
+
+func (t *rmrTransport) Send(ctx context.Context, m AlarmMessage) error {
+	rmrCtx := t.context()
+	if rmrCtx == nil {
+		return ErrRMRNotReady
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	whid := C.rmr_whid_t(-1)
+	if t.useWormhole() {
+		var err error
+		if whid, err = t.wormhole(rmrCtx, &t.whid); err != nil {
+			return err
+		}
+	}
+
+	payload, err := json.Marshal(m)
+	if err != nil {
+		t.logger.Printf("json.Marshal failed with error: %v", err)
+		return err
+	}
+
+	datap := C.CBytes(payload)
+	defer C.free(datap)
+	meid := C.CString("ric")
+	defer C.free(unsafe.Pointer(meid))
+
+	sbuf := C.rmrAllocMsg(rmrCtx, 1024, RIC_ALARM_UPDATE, datap, C.int(len(payload)), meid)
+	if sbuf == nil {
+		return &RMRError{Op: "rmrAllocMsg", Endpoint: t.endpoint, State: -1}
+	}
+
+	// Retry transient failures until the context is done
+	for retries := 0; ; retries++ {
+		if whid >= 0 {
+			sbuf = C.rmr_wh_send_msg(rmrCtx, whid, sbuf)
+		} else {
+			sbuf = C.rmr_send_msg(rmrCtx, sbuf)
+		}
+		if sbuf == nil {
+			return &RMRError{Op: "rmrSend", Endpoint: t.endpoint, State: -1}
+		}
+
+		state := sbuf.state
+		if state == C.RMR_OK {
+			C.rmr_free_msg(sbuf)
+			t.logger.Printf("Alarm sent via rmr to %s", t.endpoint)
+			return nil
+		}
+
+		if state != C.RMR_ERR_RETRY || retries >= rmrMaxRetries {
+			C.rmr_free_msg(sbuf)
+			return &RMRError{Op: "rmrSend", Endpoint: t.endpoint, State: int(state)}
+		}
+
+		select {
+		case <-ctx.Done():
+			C.rmr_free_msg(sbuf)
+			return ctx.Err()
+		case <-time.After(rmrRetryDelay):
+		}
+	}
+}
+
+// Close stops waiting for RMR to become ready. The RMR contexts are left open, since a receiver or a query
+// may still use them.
+func (t *rmrTransport) Close() error {
+	t.stopOnce.Do(func() { close(t.stop) })
+	return nil
+}
+
+// query sends the filter to the alarm manager and waits for the reply. The buffer is allocated big enough
+// for the alarm manager to return the reply in the same buffer.
+func (t *rmrTransport) query(ctx context.Context, filter AlarmFilter) (AlarmQueryResponse, error) {
+	rmrCtx, whid, err := t.caller()
+	if err != nil {
+		return AlarmQueryResponse{}, err
+	}
+
+	payload, err := json.Marshal(filter)
+	if err != nil {
+		t.logger.Printf("json.Marshal failed with error: %v", err)
+		return AlarmQueryResponse{}, err
+	}
+
+	datap := C.CBytes(payload)
+	defer C.free(datap)
+	meid := C.CString("ric")
+	defer C.free(unsafe.Pointer(meid))
+
+	sbuf := C.rmrAllocMsg(rmrCtx, RIC_ALARM_QUERY_MAX_PAYLOAD, RIC_ALARM_QUERY, datap, C.int(len(payload)), meid)
+	if sbuf == nil {
+		return AlarmQueryResponse{}, &RMRError{Op: "rmrAllocMsg", Endpoint: t.endpoint, State: -1}
+	}
+
+	type result struct {
+		resp AlarmQueryResponse
+		err  error
+	}
+	done := make(chan result, 1)
+
+	// The call blocks until the reply is received or RMR times out. The concurrent calls are told apart
+	// by the call ID, which RMR allows between 2 and 255.
+	callId := C.int(2 + atomic.AddUint32(&t.callId, 1)%254)
+	go func() {
+		var res result
+		var rbuf *C.rmr_mbuf_t
+		if whid >= 0 {
+			rbuf = C.rmr_wh_call(rmrCtx, whid, sbuf, callId, rmrCallMaxWait)
+		} else {
+			rbuf = C.rmr_mt_call(rmrCtx, sbuf, callId, rmrCallMaxWait)
+		}
+		if rbuf == nil {
+			res.err = &RMRError{Op: "rmrCall", Endpoint: t.endpoint, State: -1}
+		} else {
+			if rbuf.state != C.RMR_OK || rbuf.mtype != RIC_ALARM_QUERY {
+				res.err = &RMRError{Op: "rmrCall", Endpoint: t.endpoint, State: int(rbuf.state)}
+			} else {
+				data := C.GoBytes(unsafe.Pointer(rbuf.payload), C.int(rbuf.len))
+				res.err = json.Unmarshal(data, &res.resp)
+			}
+			C.rmr_free_msg(rbuf)
+		}
+		done <- res
+	}()
+
+	select {
+	case res := <-done:
+		return res.resp, res.err
+	case <-ctx.Done():
+		return AlarmQueryResponse{}, ctx.Err()
+	}
+}
+
+func (t *rmrTransport) receive(cb func(AlarmMessage)) error {
+	rmrCtx := t.context()
+	if rmrCtx == nil {
+		return ErrRMRNotReady
+	}
+
+	if rbuf := C.rmrRcv(rmrCtx); rbuf != nil {
+		payload := C.GoBytes(unsafe.Pointer(rbuf.payload), C.int(rbuf.len))
+		a := AlarmMessage{}
+		if err := json.Unmarshal(payload, &a); err == nil {
+			cb(a)
+		}
+	}
+	return errors.New("rmrRcv failed!")
+}
@@ -0,0 +1,67 @@
+//go:build !cgo || normr
+
+/*
+ *  Copyright (c) 2020 AT&T Intellectual Property.
+ *  Copyright (c) 2020 Nokia.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ * This source code is part of the near-RT RIC (RAN Intelligent Controller)
+ * platform project (RICP).
+ */
+
+package alarm
+
+import (
+	"context"
+)
+
+// rmrTransport is a placeholder for builds without cgo or with the normr build tag. Sending always fails, so
+// that the fallback transport posts the alarms via HTTP.
+type rmrTransport struct {
+	endpoint string
+}
+
+func newRMRTransport(cfg rmrConfig) *rmrTransport {
+	return &rmrTransport{endpoint: cfg.endpoint}
+}
+
+// NewRMRTransport returns a transport which sends alarms via RMR to the given endpoint.
+// RMR is not supported in builds without cgo or with the normr build tag, and sending always fails.
+func NewRMRTransport(endpoint string) Transport {
+	return newRMRTransport(rmrConfig{endpoint: endpoint, port: DefaultRMRListenPort})
+}
+
+func (t *rmrTransport) init() error {
+	return ErrRMRNotSupported
+}
+
+func (t *rmrTransport) isReady() bool {
+	return false
+}
+
+func (t *rmrTransport) Send(ctx context.Context, m AlarmMessage) error {
+	return ErrRMRNotSupported
+}
+
+func (t *rmrTransport) Close() error {
+	return nil
+}
+
+func (t *rmrTransport) receive(cb func(AlarmMessage)) error {
+	return ErrRMRNotSupported
+}
+
+func (t *rmrTransport) query(ctx context.Context, filter AlarmFilter) (AlarmQueryResponse, error) {
+	return AlarmQueryResponse{}, ErrRMRNotSupported
+}
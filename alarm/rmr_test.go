@@ -0,0 +1,115 @@
+//go:build cgo && !normr
+
+/*
+ *  Copyright (c) 2020 AT&T Intellectual Property.
+ *  Copyright (c) 2020 Nokia.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ * This source code is part of the near-RT RIC (RAN Intelligent Controller)
+ * platform project (RICP).
+ */
+
+package alarm
+
+import (
+	"context"
+	"log"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// managerSim accepts the RMR connections on behalf of the alarm manager
+type managerSim struct {
+	listener net.Listener
+	accepted chan net.Conn
+}
+
+func newManagerSim(t *testing.T, addr string) *managerSim {
+	ln, err := net.Listen("tcp", addr)
+	assert.Nil(t, err)
+
+	m := &managerSim{listener: ln, accepted: make(chan net.Conn, 8)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			m.accepted <- conn
+		}
+	}()
+	return m
+}
+
+func (m *managerSim) close() {
+	m.listener.Close()
+	for {
+		select {
+		case conn := <-m.accepted:
+			conn.Close()
+		default:
+			return
+		}
+	}
+}
+
+func TestRMRWormholeReconnect(t *testing.T) {
+	sim := newManagerSim(t, "127.0.0.1:0")
+	addr := sim.listener.Addr().String()
+
+	tr := newRMRTransport(rmrConfig{endpoint: addr, port: 4593, routing: RMRRoutingStatic, logger: log.Default()})
+	go tr.init()
+	defer tr.Close()
+
+	m := AlarmMessage{Alarm: Alarm{ManagedObjectId: "my-pod", ApplicationId: "my-app", SpecificProblem: 1234}, AlarmAction: AlarmActionRaise}
+	assert.Eventually(t, func() bool { return tr.Send(context.Background(), m) == nil }, 5*time.Second, 100*time.Millisecond)
+	assert.Equal(t, 1, len(sim.accepted))
+
+	// The alarm manager is restarted: the wormhole is reopened to the new alarm manager
+	sim.close()
+	sim = newManagerSim(t, addr)
+	defer sim.close()
+
+	assert.Eventually(t, func() bool {
+		tr.Send(context.Background(), m)
+		return len(sim.accepted) == 1
+	}, 5*time.Second, 100*time.Millisecond)
+}
+
+func TestRMRQuerySharedContext(t *testing.T) {
+	sim := newManagerSim(t, "127.0.0.1:0")
+	defer sim.close()
+	addr := sim.listener.Addr().String()
+
+	// The context of the application
+	app := newRMRTransport(rmrConfig{endpoint: addr, port: 4592, routing: RMRRoutingStatic, logger: log.Default()})
+	assert.Nil(t, app.init())
+	assert.Equal(t, 1, len(sim.accepted))
+
+	tr := newRMRTransport(rmrConfig{endpoint: addr, port: 4591, routing: RMRRoutingDynamic, shared: app.ctx, logger: log.Default()})
+	tr.ctx = app.ctx
+	tr.ready = true
+
+	// The query is sent over a wormhole of a context of its own, never with the context of the application
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	_, err := tr.query(ctx, AlarmFilter{})
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.NotNil(t, tr.callCtx)
+	assert.True(t, tr.callCtx != app.ctx)
+	assert.Equal(t, 2, len(sim.accepted))
+}
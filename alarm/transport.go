@@ -0,0 +1,348 @@
+/*
+ *  Copyright (c) 2020 AT&T Intellectual Property.
+ *  Copyright (c) 2020 Nokia.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ * This source code is part of the near-RT RIC (RAN Intelligent Controller)
+ * platform project (RICP).
+ */
+
+package alarm
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Default values for the HTTP client
+const (
+	DefaultHTTPTimeout      = 5 * time.Second // Upper limit for a single HTTP request to the alarm manager
+	DefaultHTTPMaxRetries   = 2
+	DefaultHTTPRetryBackoff = 100 * time.Millisecond
+)
+
+// Transport delivers alarm messages to the alarm manager
+type Transport interface {
+	// Send delivers the alarm message, or returns an error if the delivery failed or the context is done
+	Send(ctx context.Context, m AlarmMessage) error
+	// Close releases the resources held by the transport
+	Close() error
+}
+
+// HTTPConfig holds the parameters of the HTTP client used for the alarm manager REST interface.
+// Zero values are replaced with defaults.
+type HTTPConfig struct {
+	Timeout           time.Duration // Upper limit for a single request
+	TLSConfig         *tls.Config   // TLS configuration, e.g. client certificates for mTLS
+	CAFile            string        // CA certificate for verifying the alarm manager, used if TLSConfig is not given
+	CertFile          string        // Client certificate for mTLS, used if TLSConfig is not given
+	KeyFile           string        // Client key for mTLS, used if TLSConfig is not given
+	MaxIdleConns      int           // Maximum number of idle keep-alive connections
+	IdleConnTimeout   time.Duration // How long an idle keep-alive connection is kept open
+	DisableKeepAlives bool          // Use a new connection for each request
+	MaxRetries        int           // Retries of a failed request, negative value disables retries
+	RetryBackoff      time.Duration // Delay before the first retry, doubled on each retry
+}
+
+// NewHTTPClient returns an HTTP client configured according to the given parameters
+func NewHTTPClient(cfg HTTPConfig) (*http.Client, error) {
+	tlsConfig := cfg.TLSConfig
+	if tlsConfig == nil && (cfg.CAFile != "" || cfg.CertFile != "") {
+		tlsConfig = &tls.Config{}
+		if cfg.CAFile != "" {
+			pem, err := ioutil.ReadFile(cfg.CAFile)
+			if err != nil {
+				return nil, fmt.Errorf("Reading CA certificate failed: %w", err)
+			}
+
+			tlsConfig.RootCAs = x509.NewCertPool()
+			if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("No CA certificates found in %s", cfg.CAFile)
+			}
+		}
+
+		if cfg.CertFile != "" {
+			cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+			if err != nil {
+				return nil, fmt.Errorf("Loading client certificate failed: %w", err)
+			}
+			tlsConfig.Certificates = []tls.Certificate{cert}
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	transport.DisableKeepAlives = cfg.DisableKeepAlives
+	if cfg.MaxIdleConns > 0 {
+		transport.MaxIdleConns = cfg.MaxIdleConns
+		transport.MaxIdleConnsPerHost = cfg.MaxIdleConns
+	}
+	if cfg.IdleConnTimeout > 0 {
+		transport.IdleConnTimeout = cfg.IdleConnTimeout
+	}
+
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = DefaultHTTPTimeout
+	}
+	return &http.Client{Timeout: timeout, Transport: transport}, nil
+}
+
+// HTTPTransport posts the alarm messages to the REST interface of the alarm manager
+type HTTPTransport struct {
+	managerUrl string
+	client     *http.Client
+	logger     Logger
+	maxRetries int
+	backoff    time.Duration
+}
+
+// NewHTTPTransport returns a transport which posts alarms to the alarm manager at the given URL
+func NewHTTPTransport(managerUrl string) *HTTPTransport {
+	client, _ := NewHTTPClient(HTTPConfig{})
+	return newHTTPTransport(managerUrl, client, HTTPConfig{}, log.Default())
+}
+
+// NewHTTPTransportWithConfig returns a transport which posts alarms to the alarm manager at the given URL,
+// using an HTTP client configured according to the given parameters
+func NewHTTPTransportWithConfig(managerUrl string, cfg HTTPConfig) (*HTTPTransport, error) {
+	client, err := NewHTTPClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return newHTTPTransport(managerUrl, client, cfg, log.Default()), nil
+}
+
+func newHTTPTransport(managerUrl string, client *http.Client, cfg HTTPConfig, logger Logger) *HTTPTransport {
+	if cfg.MaxRetries == 0 {
+		cfg.MaxRetries = DefaultHTTPMaxRetries
+	}
+	if cfg.RetryBackoff <= 0 {
+		cfg.RetryBackoff = DefaultHTTPRetryBackoff
+	}
+	return &HTTPTransport{managerUrl: managerUrl, client: client, logger: logger, maxRetries: cfg.MaxRetries, backoff: cfg.RetryBackoff}
+}
+
+// Send posts the alarm message. Connection failures and temporary errors of the alarm manager are retried,
+// since raising and clearing alarms is idempotent.
+func (t *HTTPTransport) Send(ctx context.Context, m AlarmMessage) error {
+	payload, err := json.Marshal(m)
+	if err != nil {
+		t.logger.Printf("json.Marshal failed with error: %v", err)
+		return err
+	}
+
+	url := fmt.Sprintf("%s/%s", t.managerUrl, "ric/v1/alarms")
+	backoff := t.backoff
+	for retries := 0; ; retries++ {
+		err := t.post(ctx, url, payload)
+		if err == nil || !isRetryable(ctx, err) || retries >= t.maxRetries {
+			return err
+		}
+
+		t.logger.Printf("Alarm post to %s failed, retrying: %v", url, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (t *HTTPTransport) post(ctx context.Context, url string, payload []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("HttpError=Post failed with error: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("HttpError=Post failed with error: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if err := checkHTTPStatus(resp); err != nil {
+		return err
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+
+	t.logger.Printf("Alarm posted to %s [status=%d]", url, resp.StatusCode)
+	return nil
+}
+
+// checkHTTPStatus returns *HTTPStatusError if the status code is not 2xx. In that case the body is consumed.
+func checkHTTPStatus(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	io.Copy(ioutil.Discard, resp.Body)
+	return &HTTPStatusError{Method: resp.Request.Method, URL: resp.Request.URL.String(), StatusCode: resp.StatusCode, Body: string(body)}
+}
+
+// isRetryable returns true for timeouts, refused or reset connections and temporary errors of the alarm manager.
+// Other failures, e.g. TLS handshake or certificate errors, fail the same way when retried.
+func isRetryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	var statusErr *HTTPStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Temporary()
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET)
+}
+
+func (t *HTTPTransport) Close() error {
+	return nil
+}
+
+// FallbackTransport tries the transports in the given order until one of them succeeds
+type FallbackTransport struct {
+	transports []Transport
+}
+
+// NewFallbackTransport returns a transport which tries the given transports in order
+func NewFallbackTransport(transports ...Transport) *FallbackTransport {
+	return &FallbackTransport{transports: transports}
+}
+
+// Send returns *FallbackError holding the errors of all transports, if none of them succeeds
+func (t *FallbackTransport) Send(ctx context.Context, m AlarmMessage) error {
+	var errs []error
+	observe := sendObserverFrom(ctx)
+	for i, tr := range t.transports {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		start := time.Now()
+		err := tr.Send(ctx, m)
+		if observe != nil {
+			observe(i, tr, err, time.Since(start))
+		}
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, err)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	}
+	return &FallbackError{Errors: errs}
+}
+
+func (t *FallbackTransport) Close() error {
+	var errs error
+	for _, tr := range t.transports {
+		if err := tr.Close(); err != nil && errs == nil {
+			errs = err
+		}
+	}
+	return errs
+}
+
+// MemoryTransport keeps the sent alarm messages in memory and optionally passes them to a handler
+// within the same process. It is meant for unit tests and for applications embedding the alarm manager.
+type MemoryTransport struct {
+	mutex    sync.Mutex
+	messages []AlarmMessage
+	handler  func(AlarmMessage) error
+}
+
+// NewMemoryTransport returns a new in-memory transport. The handler is optional.
+func NewMemoryTransport(handler func(AlarmMessage) error) *MemoryTransport {
+	return &MemoryTransport{handler: handler}
+}
+
+func (t *MemoryTransport) Send(ctx context.Context, m AlarmMessage) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	t.mutex.Lock()
+	t.messages = append(t.messages, m)
+	t.mutex.Unlock()
+
+	if t.handler != nil {
+		return t.handler(m)
+	}
+	return nil
+}
+
+func (t *MemoryTransport) Close() error {
+	return nil
+}
+
+// Messages returns a copy of the alarm messages sent so far
+func (t *MemoryTransport) Messages() []AlarmMessage {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	messages := make([]AlarmMessage, len(t.messages))
+	copy(messages, t.messages)
+	return messages
+}
+
+// Reset discards the alarm messages sent so far
+func (t *MemoryTransport) Reset() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.messages = nil
+}
+
+// findRMRTransport returns the RMR transport, if the given transport is or contains one
+func findRMRTransport(t Transport) *rmrTransport {
+	switch tr := t.(type) {
+	case *rmrTransport:
+		return tr
+	case *FallbackTransport:
+		for _, c := range tr.transports {
+			if r := findRMRTransport(c); r != nil {
+				return r
+			}
+		}
+	}
+	return nil
+}
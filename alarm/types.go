@@ -21,14 +21,15 @@
 package alarm
 
 import (
+	"context"
 	"fmt"
+	"net/http"
 	"os"
 	"sync"
-	"unsafe"
+	"sync/atomic"
+	"time"
 )
 
-import "C"
-
 // Severity for alarms
 type Severity string
 
@@ -43,14 +44,45 @@ const (
 	SeverityDefault     Severity = "DEFAULT"
 )
 
-// Alarm object - see README for more information
+// Alarm object - see README for more information. The structured additional info and the ITU-T X.733
+// attributes are optional, and omitted from the JSON encoding if not set.
 type Alarm struct {
-	ManagedObjectId   string   `json:"managedObjectId"`
-	ApplicationId     string   `json:"applicationId"`
-	SpecificProblem   int      `json:"specificProblem"`
-	PerceivedSeverity Severity `json:"perceivedSeverity"`
-	IdentifyingInfo   string   `json:"identifyingInfo"`
-	AdditionalInfo    string   `json:"additionalInfo"`
+	ManagedObjectId         string                   `json:"managedObjectId"`
+	ApplicationId           string                   `json:"applicationId"`
+	SpecificProblem         int                      `json:"specificProblem"`
+	PerceivedSeverity       Severity                 `json:"perceivedSeverity"`
+	IdentifyingInfo         string                   `json:"identifyingInfo"`
+	AdditionalInfo          string                   `json:"additionalInfo"`
+	AdditionalAttributes    map[string]string        `json:"additionalAttributes,omitempty"`
+	ProbableCause           string                   `json:"probableCause,omitempty"`
+	ProposedRepairActions   []string                 `json:"proposedRepairActions,omitempty"`
+	TrendIndication         TrendIndication          `json:"trendIndication,omitempty"`
+	ThresholdInfo           *ThresholdInfo           `json:"thresholdInfo,omitempty"`
+	CorrelatedNotifications []CorrelatedNotification `json:"correlatedNotifications,omitempty"`
+}
+
+// Trend indication of ITU-T X.733
+type TrendIndication string
+
+// Possible values for TrendIndication
+const (
+	TrendMoreSevere TrendIndication = "MORE_SEVERE"
+	TrendNoChange   TrendIndication = "NO_CHANGE"
+	TrendLessSevere TrendIndication = "LESS_SEVERE"
+)
+
+// ThresholdInfo of ITU-T X.733 tells which threshold was crossed and the value observed
+type ThresholdInfo struct {
+	TriggeredThreshold string  `json:"triggeredThreshold"`
+	ObservedValue      float64 `json:"observedValue"`
+	ThresholdLevel     float64 `json:"thresholdLevel"`
+	ArmTime            int64   `json:"armTime,omitempty"`
+}
+
+// CorrelatedNotification of ITU-T X.733 refers to the notifications, e.g. alarm IDs, related to the alarm
+type CorrelatedNotification struct {
+	SourceObjectInstance string `json:"sourceObjectInstance,omitempty"`
+	NotificationIds      []int  `json:"notificationIds"`
 }
 
 // Alarm actions
@@ -61,6 +93,7 @@ const (
 	AlarmActionRaise    AlarmAction = "RAISE"
 	AlarmActionClear    AlarmAction = "CLEAR"
 	AlarmActionClearAll AlarmAction = "CLEARALL"
+	AlarmActionUpdate   AlarmAction = "UPDATE"
 )
 
 type AlarmMessage struct {
@@ -69,20 +102,88 @@ type AlarmMessage struct {
 	AlarmTime int64
 }
 
+// AlarmFilter selects a subset of alarms. Empty fields match any value.
+type AlarmFilter struct {
+	ManagedObjectId   string   `json:"managedObjectId,omitempty"`
+	ApplicationId     string   `json:"applicationId,omitempty"`
+	SpecificProblem   int      `json:"specificProblem,omitempty"`
+	PerceivedSeverity Severity `json:"perceivedSeverity,omitempty"`
+}
+
+// AlarmQueryResponse is the reply of the alarm manager to a RIC_ALARM_QUERY message. If the active alarms
+// don't fit into the reply, Truncated is set and the alarms have to be queried via the REST interface.
+type AlarmQueryResponse struct {
+	Alarms    []AlarmMessage `json:"alarms"`
+	Truncated bool           `json:"truncated,omitempty"`
+}
+
+// AlarmAck is the operator acknowledgement of an active alarm, i.e. someone is handling the alarm
+type AlarmAck struct {
+	User    string `json:"user"`
+	Time    int64  `json:"time"`
+	Comment string `json:"comment,omitempty"`
+}
+
+// AlarmSilence mutes the Alert Manager alerts of the matching alarms between StartsAt and EndsAt. The alarm terms
+// are translated into Alert Manager matchers; Matchers shows the resulting matchers of an existing silence.
+type AlarmSilence struct {
+	Id string `json:"id,omitempty"`
+	AlarmFilter
+	IdentifyingInfo string   `json:"identifyingInfo,omitempty"`
+	StartsAt        int64    `json:"startsAt,omitempty"`
+	EndsAt          int64    `json:"endsAt"`
+	CreatedBy       string   `json:"createdBy"`
+	Comment         string   `json:"comment"`
+	State           string   `json:"state,omitempty"`
+	Matchers        []string `json:"matchers,omitempty"`
+}
+
 type AlarmConfigParams struct {
 	MaxActiveAlarms int `json:"maxactivealarms"`
 	MaxAlarmHistory int `json:"maxalarmhistory"`
 }
 
+// Alarmer is the alarm API used by the applications. It is satisfied by *RICAlarm, and by
+// the recorder of the alarmtest package in unit tests.
+type Alarmer interface {
+	NewAlarm(sp int, severity Severity, ainfo, iinfo string) Alarm
+	Raise(a Alarm) error
+	Clear(a Alarm) error
+	Reraise(a Alarm) error
+	UpdateSeverity(a Alarm, severity Severity) error
+	ClearAll() error
+	RaiseContext(ctx context.Context, a Alarm) error
+	ClearContext(ctx context.Context, a Alarm) error
+	ReraiseContext(ctx context.Context, a Alarm) error
+	UpdateSeverityContext(ctx context.Context, a Alarm, severity Severity) error
+	ClearAllContext(ctx context.Context) error
+}
+
 // RICAlarm is an alarm instance
 type RICAlarm struct {
-	moId        string
-	appId       string
-	managerUrl  string
-	rmrEndpoint string
-	rmrCtx      unsafe.Pointer
-	rmrReady    bool
-	mutex       sync.Mutex
+	moId           string
+	appId          string
+	managerUrl     string
+	rmrEndpoint    string
+	listenPort     int
+	logger         Logger
+	httpClient     *http.Client
+	timeout        time.Duration
+	transport      Transport
+	rmr            *rmrTransport
+	async          atomic.Pointer[asyncSender]
+	resync         atomic.Pointer[resyncer]
+	outstanding    map[alarmKey]Alarm
+	delivered      map[alarmKey]Alarm
+	deliveredMutex sync.Mutex
+	sendFailed     atomic.Bool
+	definitions    map[int]*AlarmDefinition
+	fetchDefs      bool
+	fetchDefsNext  time.Time
+	defsMutex      sync.Mutex
+	limiter        *rateLimiter
+	metrics        atomic.Pointer[metrics]
+	mutex          sync.Mutex
 }
 
 const (
@@ -90,6 +191,12 @@ const (
 	RIC_ALARM_QUERY  = 13112
 )
 
+// Maximum size of the RIC_ALARM_QUERY reply payload
+const RIC_ALARM_QUERY_MAX_PAYLOAD = 65536
+
+// HTTP response header carrying the instance identity of the alarm manager
+const ALARM_MANAGER_INSTANCE_HEADER = "X-Alarm-Manager-Instance"
+
 // Temp alarm constants & definitions
 const (
 	E2_CONNECTION_PROBLEM              int = 72004
@@ -1,3 +1,5 @@
+//go:build cgo && !normr
+
 /*
 ==================================================================================
   Copyright (c) 2020 AT&T Intellectual Property.
@@ -20,32 +22,29 @@
 #include <string.h>
 #include "utils.h"
 
-void * rmrInit(void) {
+void * rmrInit(char *proto_port, int flags) {
     void* mrc;  // msg router context
 
-    if( (mrc = rmr_init("tcp:4588", 1024, RMRFL_NONE)) == NULL ) {
+    // The readiness is polled by the caller, so that the initialization doesn't block until a route table is received
+    if( (mrc = rmr_init(proto_port, 1024, flags)) == NULL ) {
         fprintf(stderr, "Unable to initialize RMR\n");
         return NULL;
     }
 
-    // Must have a route table before we can send, so wait til RMR is ready
-    while(!rmr_ready(mrc)) {
-        //fprintf(stderr, "Waiting for RMR to be ready ...\n");
-        sleep(2);
-    }
-    fprintf(stderr, "RMR is ready now ...\n");
-
     return mrc;
 }
 
-int rmrSend(void *mrc, int mtype, void *payload, int payload_len, char *meid) {
-    int retry_count = 0;
+rmr_mbuf_t * rmrAllocMsg(void *mrc, int size, int mtype, void *payload, int payload_len, char *meid) {
     rmr_mbuf_t *sbuf = 0;
 
-    if (payload_len > 1024) {
+    if (payload_len > size) {
         sbuf = rmr_alloc_msg(mrc, payload_len);
     } else {
-        sbuf = rmr_alloc_msg(mrc, 1024);
+        sbuf = rmr_alloc_msg(mrc, size);
+    }
+
+    if (sbuf == NULL) {
+        return NULL;
     }
 
     sbuf->mtype = mtype;
@@ -55,19 +54,7 @@ int rmrSend(void *mrc, int mtype, void *payload, int payload_len, char *meid) {
     memcpy(sbuf->payload, payload, payload_len);
     rmr_str2meid(sbuf, meid);
 
-    do {
-        sbuf = rmr_send_msg(mrc, sbuf);
-        if (sbuf == NULL) {
-            return -1;
-        }
-
-        if (sbuf->state == RMR_OK) {
-            fprintf(stderr, "RMR message sent successfully!\n");
-            break;
-        }
-    } while(sbuf->state == RMR_ERR_RETRY && ++retry_count < 10);
-
-    return sbuf->state;
+    return sbuf;
 }
 
 rmr_mbuf_t * rmrRcv(void *mrc) {
@@ -27,8 +27,8 @@
 #include <unistd.h>
 #include <rmr/rmr.h>
 
-void * rmrInit(void);
-int rmrSend(void *mrc, int mtype, void *payload, int payload_len, char *meid);
+void * rmrInit(char *proto_port, int flags);
+rmr_mbuf_t * rmrAllocMsg(void *mrc, int size, int mtype, void *payload, int payload_len, char *meid);
 rmr_mbuf_t * rmrRcv(void *mrc);
 
 #endif
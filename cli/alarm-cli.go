@@ -36,6 +36,7 @@ type RicPerfAlarmObjects struct {
 type AlarmNotification struct {
 	alarm.AlarmMessage
 	alarm.AlarmDefinition
+	Ack *alarm.AlarmAck `json:"ack,omitempty"`
 }
 
 var CLIPerfAlarmObjects map[int]*alarm.Alarm
@@ -73,11 +74,14 @@ func main() {
 	registerHistoryCmd(alarmManagerHost)
 	registerRaiseCmd(alarmManagerHost)
 	registerClearCmd(alarmManagerHost)
+	registerAckCmd(alarmManagerHost)
+	registerUnackCmd(alarmManagerHost)
 	registerDefineCmd(alarmManagerHost)
 	registerUndefineCmd(alarmManagerHost)
 	registerConfigureCmd(alarmManagerHost)
 	registerPerfCmd(alarmManagerHost)
 	registerAlertCmd(alertManagerHost)
+	registerSilenceCmd(alarmManagerHost)
 
 	// parse command-line arguments
 	commando.Parse(nil)
@@ -146,6 +150,34 @@ func registerClearCmd(alarmManagerHost string) {
 
 }
 
+func registerAckCmd(alarmManagerHost string) {
+	// Acknowledge an active alarm
+	commando.
+		Register("ack").
+		SetShortDescription("Acknowledges active alarm with given alarm id").
+		AddFlag("aid", "alarm identifier", commando.Int, nil).
+		AddFlag("user", "Acknowledging user", commando.String, os.Getenv("USER")).
+		AddFlag("comment", "Acknowledgement comment", commando.String, "-").
+		AddFlag("host", "Alarm manager host address", commando.String, alarmManagerHost).
+		AddFlag("port", "Alarm manager host address", commando.String, "8080").
+		SetAction(func(args map[string]commando.ArgValue, flags map[string]commando.FlagValue) {
+			postAlarmAck(flags, true)
+		})
+}
+
+func registerUnackCmd(alarmManagerHost string) {
+	// Remove acknowledgement of an active alarm
+	commando.
+		Register("unack").
+		SetShortDescription("Removes acknowledgement of active alarm with given alarm id").
+		AddFlag("aid", "alarm identifier", commando.Int, nil).
+		AddFlag("host", "Alarm manager host address", commando.String, alarmManagerHost).
+		AddFlag("port", "Alarm manager host address", commando.String, "8080").
+		SetAction(func(args map[string]commando.ArgValue, flags map[string]commando.FlagValue) {
+			postAlarmAck(flags, false)
+		})
+}
+
 func registerConfigureCmd(alarmManagerHost string) {
 	// Configure an alarm manager
 	commando.
@@ -224,6 +256,39 @@ func registerAlertCmd(alertManagerHost string) {
 		})
 }
 
+func registerSilenceCmd(alarmManagerHost string) {
+	// Manage Prometheus Alert Manager silences of alarms
+	commando.
+		Register("silence").
+		SetShortDescription("Creates, lists or expires silences of alarms in Prometheus Alert Manager").
+		SetDescription("This command manages Alert Manager silences. The alarms to silence are given with the alarm terms, "+
+			"which are translated into Alert Manager matchers").
+		AddArgument("action", "create, list or expire", "list").
+		AddFlag("sp", "Specific problem Id", commando.Int, 0).
+		AddFlag("moid", "Managed object Id", commando.String, "-").
+		AddFlag("apid", "Application Id", commando.String, "-").
+		AddFlag("iinfo", "Application identifying info", commando.String, "-").
+		AddFlag("severity", "Perceived severity", commando.String, "-").
+		AddFlag("duration", "Silence duration, e.g. 30m or 2h", commando.String, "1h").
+		AddFlag("user", "Silence creator", commando.String, os.Getenv("USER")).
+		AddFlag("comment", "Silence comment", commando.String, "-").
+		AddFlag("id", "Silence identifier", commando.String, "-").
+		AddFlag("host", "Alarm manager host address", commando.String, alarmManagerHost).
+		AddFlag("port", "Alarm manager host address", commando.String, "8080").
+		SetAction(func(args map[string]commando.ArgValue, flags map[string]commando.FlagValue) {
+			switch args["action"].Value {
+			case "create":
+				postSilence(flags)
+			case "list":
+				displaySilences(getSilences(flags))
+			case "expire":
+				deleteSilence(flags)
+			default:
+				fmt.Println("Unknown action: ", args["action"].Value)
+			}
+		})
+}
+
 func readAlarmParams(flags map[string]commando.FlagValue, clear bool) (a alarm.Alarm) {
 	a.ManagedObjectId, _ = flags["moid"].GetString()
 	a.ApplicationId, _ = flags["apid"].GetString()
@@ -316,13 +381,69 @@ func postAlarm(flags map[string]commando.FlagValue, a alarm.Alarm, action alarm.
 	fmt.Println("command executed successfully!")
 }
 
+func postAlarmAck(flags map[string]commando.FlagValue, ack bool) {
+	host, _ := flags["host"].GetString()
+	port, _ := flags["port"].GetString()
+	alarmid, _ := flags["aid"].GetInt()
+	targetUrl := fmt.Sprintf("http://%s:%s/ric/v1/alarms/ack/%d", host, port, alarmid)
+
+	var req *http.Request
+	var err error
+	if ack {
+		m := alarm.AlarmAck{}
+		m.User, _ = flags["user"].GetString()
+		if comment, _ := flags["comment"].GetString(); comment != "-" {
+			m.Comment = comment
+		}
+		var jsonData []byte
+		jsonData, err = json.Marshal(m)
+		if err != nil {
+			fmt.Println("json.Marshal failed: ", err)
+			return
+		}
+		req, err = http.NewRequest("POST", targetUrl, bytes.NewBuffer(jsonData))
+	} else {
+		req, err = http.NewRequest("DELETE", targetUrl, nil)
+	}
+	if err != nil || req == nil {
+		fmt.Println("Couldn't make acknowledgement request due to error: ", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil || resp == nil {
+		fmt.Println("Couldn't send acknowledgement request due to error: ", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		fmt.Printf("Acknowledgement failed: %s %s\n", resp.Status, string(body))
+		return
+	}
+	fmt.Println("command executed successfully!")
+}
+
+func ackString(ack *alarm.AlarmAck) string {
+	if ack == nil {
+		return "-"
+	}
+	ackTime := time.Unix(0, ack.Time).Format("02/01/2006, 15:04:05")
+	if ack.Comment != "" {
+		return fmt.Sprintf("%s (%s): %s", ack.User, ackTime, ack.Comment)
+	}
+	return fmt.Sprintf("%s (%s)", ack.User, ackTime)
+}
+
 func displayAlarms(alarms []AlarmNotification, isHistory bool) {
 	t := table.NewWriter()
 	t.SetOutputMirror(os.Stdout)
 	if isHistory {
 		t.AppendHeader(table.Row{"ID", "SP", "MOID", "APPID", "IINFO", "SEVERITY", "AAI", "ACTION", "TIME"})
 	} else {
-		t.AppendHeader(table.Row{"ID", "SP", "MOID", "APPID", "IINFO", "SEVERITY", "AAI", "TIME"})
+		t.AppendHeader(table.Row{"ID", "SP", "MOID", "APPID", "IINFO", "SEVERITY", "AAI", "ACK", "TIME"})
 	}
 
 	for _, a := range alarms {
@@ -335,7 +456,7 @@ func displayAlarms(alarms []AlarmNotification, isHistory bool) {
 		} else {
 			if a.AlarmDefinition.RaiseDelay == 0 {
 				t.AppendRows([]table.Row{
-					{a.AlarmId, a.SpecificProblem, a.ManagedObjectId, a.ApplicationId, a.IdentifyingInfo, a.PerceivedSeverity, a.AdditionalInfo, alarmTime},
+					{a.AlarmId, a.SpecificProblem, a.ManagedObjectId, a.ApplicationId, a.IdentifyingInfo, a.PerceivedSeverity, a.AdditionalInfo, ackString(a.Ack), alarmTime},
 				})
 			}
 		}
@@ -420,9 +541,14 @@ func deleteAlarmDefinition(flags map[string]commando.FlagValue) {
 	}
 }
 
-// NewAlarmClient returns a new AlarmClient.
+// NewAlarmClient returns a new AlarmClient. The alarms are sent to the local alarm manager, unless ALARM_IF_RMR is set.
 func NewAlarmClient(moId, appId string) *AlarmClient {
-	alarmInstance, err := alarm.InitAlarm(moId, appId)
+	var opts []alarm.Option
+	if os.Getenv("ALARM_IF_RMR") == "" {
+		opts = append(opts, alarm.WithRMREndpoint("127.0.0.1:4560"))
+	}
+
+	alarmInstance, err := alarm.InitAlarm(moId, appId, opts...)
 	if err == nil {
 		return &AlarmClient{
 			alarmer: alarmInstance,
@@ -648,6 +774,133 @@ func raiseClearAlarmOverPeriod(alarmobject *alarm.Alarm, flags map[string]comman
 	}
 }
 
+func silenceFlag(flags map[string]commando.FlagValue, name string) string {
+	if v, _ := flags[name].GetString(); v != "-" {
+		return v
+	}
+	return ""
+}
+
+func postSilence(flags map[string]commando.FlagValue) {
+	host, _ := flags["host"].GetString()
+	port, _ := flags["port"].GetString()
+	targetUrl := fmt.Sprintf("http://%s:%s/ric/v1/silences", host, port)
+
+	duration, err := time.ParseDuration(silenceFlag(flags, "duration"))
+	if err != nil || duration <= 0 {
+		fmt.Println("Invalid silence duration: ", silenceFlag(flags, "duration"))
+		return
+	}
+
+	s := alarm.AlarmSilence{}
+	s.SpecificProblem, _ = flags["sp"].GetInt()
+	s.ManagedObjectId = silenceFlag(flags, "moid")
+	s.ApplicationId = silenceFlag(flags, "apid")
+	s.IdentifyingInfo = silenceFlag(flags, "iinfo")
+	s.PerceivedSeverity = alarm.Severity(silenceFlag(flags, "severity"))
+	s.EndsAt = time.Now().Add(duration).UnixNano()
+	s.CreatedBy, _ = flags["user"].GetString()
+	s.Comment = silenceFlag(flags, "comment")
+	if s.Comment == "" {
+		s.Comment = "Silenced with alarm-cli"
+	}
+
+	jsonData, err := json.Marshal(s)
+	if err != nil {
+		fmt.Println("json.Marshal failed: ", err)
+		return
+	}
+
+	resp, err := http.Post(targetUrl, "application/json", bytes.NewBuffer(jsonData))
+	if err != nil || resp == nil {
+		fmt.Println("Couldn't create silence due to error: ", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		fmt.Printf("Creating silence failed: %s %s\n", resp.Status, string(body))
+		return
+	}
+
+	var created map[string]string
+	json.Unmarshal(body, &created)
+	fmt.Println("Silence created: ", created["id"])
+}
+
+func getSilences(flags map[string]commando.FlagValue) (silences []alarm.AlarmSilence) {
+	host, _ := flags["host"].GetString()
+	port, _ := flags["port"].GetString()
+	targetUrl := fmt.Sprintf("http://%s:%s/ric/v1/silences", host, port)
+	resp, err := http.Get(targetUrl)
+	if err != nil || resp == nil || resp.Body == nil {
+		fmt.Println("Couldn't fetch silences due to error: ", err)
+		return silences
+	}
+
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		fmt.Println("ioutil.ReadAll failed: ", err)
+		return silences
+	}
+	if resp.StatusCode != http.StatusOK {
+		fmt.Printf("Fetching silences failed: %s %s\n", resp.Status, string(body))
+		return silences
+	}
+
+	json.Unmarshal([]byte(body), &silences)
+	return silences
+}
+
+func displaySilences(silences []alarm.AlarmSilence) {
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(table.Row{"ID", "STATE", "SP", "MOID", "APPID", "IINFO", "SEVERITY", "STARTS", "ENDS", "CREATED BY", "COMMENT"})
+	for _, s := range silences {
+		startsAt := time.Unix(0, s.StartsAt).Format("02/01/2006, 15:04:05")
+		endsAt := time.Unix(0, s.EndsAt).Format("02/01/2006, 15:04:05")
+		t.AppendRows([]table.Row{
+			{s.Id, s.State, s.SpecificProblem, s.ManagedObjectId, s.ApplicationId, s.IdentifyingInfo, s.PerceivedSeverity, startsAt, endsAt, s.CreatedBy, s.Comment},
+		})
+	}
+	t.SetStyle(table.StyleColoredBright)
+	t.Render()
+}
+
+func deleteSilence(flags map[string]commando.FlagValue) {
+	host, _ := flags["host"].GetString()
+	port, _ := flags["port"].GetString()
+	id := silenceFlag(flags, "id")
+	if id == "" {
+		fmt.Println("Silence identifier not given")
+		return
+	}
+	targetUrl := fmt.Sprintf("http://%s:%s/ric/v1/silences/%s", host, port, id)
+
+	req, err := http.NewRequest("DELETE", targetUrl, nil)
+	if err != nil || req == nil {
+		fmt.Println("Couldn't make delete request due to error: ", err)
+		return
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil || resp == nil {
+		fmt.Println("Couldn't expire silence due to error: ", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		fmt.Printf("Expiring silence failed: %s %s\n", resp.Status, string(body))
+		return
+	}
+	fmt.Println("command executed successfully!")
+}
+
 func dispalyAlertAnnotations(t table.Writer, gettableAlert *models.GettableAlert) {
 	var annotationmap map[string]string
 	annotationmap = make(map[string]string)
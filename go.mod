@@ -22,8 +22,10 @@ require (
 	github.com/go-openapi/runtime v0.26.0
 	github.com/go-openapi/strfmt v0.21.7
 	github.com/gorilla/mux v1.8.0
+	github.com/gosnmp/gosnmp v1.36.0
 	github.com/jedib0t/go-pretty v4.3.0+incompatible
 	github.com/prometheus/alertmanager v0.25.0
+	github.com/prometheus/client_golang v1.15.1
 	github.com/spf13/viper v1.16.0
 	github.com/stretchr/testify v1.8.4
 	github.com/thatisuday/commando v1.0.4
@@ -65,7 +67,6 @@ require (
 	github.com/opentracing/opentracing-go v1.2.0 // indirect
 	github.com/pelletier/go-toml/v2 v2.0.8 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	github.com/prometheus/client_golang v1.15.1 // indirect
 	github.com/prometheus/client_model v0.4.0 // indirect
 	github.com/prometheus/common v0.43.0 // indirect
 	github.com/prometheus/procfs v0.9.0 // indirect
@@ -0,0 +1,212 @@
+/*
+ *  Copyright (c) 2020 AT&T Intellectual Property.
+ *  Copyright (c) 2020 Nokia.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ * This source code is part of the near-RT RIC (RAN Intelligent Controller)
+ * platform project (RICP).
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	app "gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/xapp"
+	clientruntime "github.com/go-openapi/runtime/client"
+	"github.com/go-openapi/strfmt"
+	"github.com/prometheus/alertmanager/api/v2/client"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/viper"
+)
+
+var (
+	alertmanagerUp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "alarm_manager",
+		Name:      "alertmanager_up",
+		Help:      "Whether the last request to the Alert Manager replica succeeded (1) or not (0)",
+	}, []string{"endpoint"})
+	alertmanagerFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "alarm_manager",
+		Name:      "alertmanager_failures_total",
+		Help:      "Number of failed requests to the Alert Manager replica",
+	}, []string{"endpoint"})
+)
+
+func init() {
+	alertmanagerUp = registerMetric(alertmanagerUp)
+	alertmanagerFailures = registerMetric(alertmanagerFailures)
+}
+
+// registerMetric registers the collector in the default registry. If an identical collector is registered
+// already, e.g. by another package, the existing one is returned and used instead.
+func registerMetric[T prometheus.Collector](c T) T {
+	err := prometheus.Register(c)
+	if err == nil {
+		return c
+	}
+
+	var are prometheus.AlreadyRegisteredError
+	if errors.As(err, &are) {
+		if existing, ok := are.ExistingCollector.(T); ok {
+			return existing
+		}
+	}
+	app.Logger.Error("Registering metric failed: %v", err)
+	return c
+}
+
+// AlertmanagerEndpoint is an Alert Manager replica of the cluster. The replica is unhealthy after a request to it
+// has failed, and healthy again after a request has succeeded. Alerts are posted to all replicas regardless of
+// their health, and queries go to the healthy replicas first.
+type AlertmanagerEndpoint struct {
+	Host                string `json:"host"`
+	Healthy             bool   `json:"healthy"`
+	ConsecutiveFailures int    `json:"consecutiveFailures"`
+	LastError           string `json:"lastError,omitempty"`
+	LastSuccess         int64  `json:"lastSuccess,omitempty"`
+	LastFailure         int64  `json:"lastFailure,omitempty"`
+}
+
+// ReadAlertmanagerHosts returns the Alert Manager replicas configured. The replicas are given as a list in
+// controls.promAlertManager.addresses, or as a comma separated controls.promAlertManager.address.
+func ReadAlertmanagerHosts() []string {
+	if hosts := viper.GetStringSlice("controls.promAlertManager.addresses"); len(hosts) > 0 {
+		return hosts
+	}
+	return SplitAlertmanagerHosts(viper.GetString("controls.promAlertManager.address"))
+}
+
+// SplitAlertmanagerHosts splits the comma separated Alert Manager addresses
+func SplitAlertmanagerHosts(addresses string) []string {
+	hosts := make([]string, 0)
+	for _, h := range strings.Split(addresses, ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			hosts = append(hosts, h)
+		}
+	}
+	return hosts
+}
+
+// SetAlertmanagerHosts sets the Alert Manager replicas. The health of the replicas already known is kept.
+func (a *AlarmManager) SetAlertmanagerHosts(hosts []string) {
+	a.amMutex.Lock()
+	defer a.amMutex.Unlock()
+
+	endpoints := make([]*AlertmanagerEndpoint, 0, len(hosts))
+	for _, host := range hosts {
+		e := &AlertmanagerEndpoint{Host: host, Healthy: true}
+		for _, old := range a.amEndpoints {
+			if old.Host == host {
+				e = old
+			}
+		}
+		endpoints = append(endpoints, e)
+	}
+	a.amEndpoints = endpoints
+}
+
+// AlertmanagerEndpoints returns the Alert Manager replicas and their health
+func (a *AlarmManager) AlertmanagerEndpoints() []AlertmanagerEndpoint {
+	a.amMutex.Lock()
+	defer a.amMutex.Unlock()
+
+	endpoints := make([]AlertmanagerEndpoint, 0, len(a.amEndpoints))
+	for _, e := range a.amEndpoints {
+		endpoints = append(endpoints, *e)
+	}
+	return endpoints
+}
+
+// alertmanagerHosts returns the hosts of the Alert Manager replicas, healthy ones first
+func (a *AlarmManager) alertmanagerHosts() []string {
+	a.amMutex.Lock()
+	defer a.amMutex.Unlock()
+
+	healthy, unhealthy := make([]string, 0), make([]string, 0)
+	for _, e := range a.amEndpoints {
+		if e.Healthy {
+			healthy = append(healthy, e.Host)
+		} else {
+			unhealthy = append(unhealthy, e.Host)
+		}
+	}
+	return append(healthy, unhealthy...)
+}
+
+func (a *AlarmManager) NewAlertmanagerClient(host string) *client.AlertmanagerAPI {
+	cr := clientruntime.New(host, a.amBaseUrl, a.amSchemes)
+	return client.New(cr, strfmt.Default)
+}
+
+// updateAlertmanagerHealth records the result of a request to the Alert Manager replica
+func (a *AlarmManager) updateAlertmanagerHealth(host string, err error) {
+	a.amMutex.Lock()
+	defer a.amMutex.Unlock()
+
+	for _, e := range a.amEndpoints {
+		if e.Host != host {
+			continue
+		}
+
+		if err == nil || !alertmanagerUnavailable(err) {
+			if !e.Healthy {
+				app.Logger.Info("Alert Manager '%s' is healthy again", host)
+			}
+			e.Healthy, e.ConsecutiveFailures, e.LastSuccess = true, 0, time.Now().UnixNano()
+			alertmanagerUp.WithLabelValues(host).Set(1)
+			return
+		}
+
+		if e.Healthy {
+			app.Logger.Warn("Alert Manager '%s' is unhealthy: %v", host, err)
+		}
+		e.Healthy, e.LastError, e.LastFailure = false, err.Error(), time.Now().UnixNano()
+		e.ConsecutiveFailures++
+		alertmanagerUp.WithLabelValues(host).Set(0)
+		alertmanagerFailures.WithLabelValues(host).Inc()
+	}
+}
+
+// alertmanagerUnavailable tells whether the error is due to the Alert Manager replica, i.e. the request may succeed
+// with another replica. Client errors, e.g. invalid request or unknown silence, are not.
+func alertmanagerUnavailable(err error) bool {
+	var clientErr interface{ IsClientError() bool }
+	if errors.As(err, &clientErr) && clientErr.IsClientError() {
+		return false
+	}
+	return true
+}
+
+// withAlertmanager calls the Alert Manager API with the healthy replicas first, until the call succeeds
+func (a *AlarmManager) withAlertmanager(f func(c *client.AlertmanagerAPI) error) error {
+	err := fmt.Errorf("no Alert Manager configured")
+	for _, host := range a.alertmanagerHosts() {
+		err = f(a.NewAlertmanagerClient(host))
+		a.updateAlertmanagerHealth(host, err)
+		if err == nil || !alertmanagerUnavailable(err) {
+			return err
+		}
+		app.Logger.Warn("Request to Alert Manager '%s/%s' failed, trying next replica: %v", host, a.amBaseUrl, err)
+	}
+	return err
+}
+
+func (a *AlarmManager) GetAlertmanagers(w http.ResponseWriter, r *http.Request) {
+	a.respondWithJSON(w, http.StatusOK, a.AlertmanagerEndpoints())
+}
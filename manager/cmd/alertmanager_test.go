@@ -0,0 +1,129 @@
+/*
+ *  Copyright (c) 2020 AT&T Intellectual Property.
+ *  Copyright (c) 2020 Nokia.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ * This source code is part of the near-RT RIC (RAN Intelligent Controller)
+ * platform project (RICP).
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/alertmanager/api/v2/models"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// alertmanagerSim is an Alert Manager replica returning the given alerts, and recording the alerts posted to it
+type alertmanagerSim struct {
+	*recordingServer
+	alertsMutex sync.Mutex
+	alerts      models.GettableAlerts
+}
+
+func newAlertmanagerSim() *alertmanagerSim {
+	f := &alertmanagerSim{alerts: models.GettableAlerts{}}
+	f.recordingServer = newRecordingServer(func(w http.ResponseWriter, r recordedRequest) {
+		f.alertsMutex.Lock()
+		defer f.alertsMutex.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == "GET" {
+			json.NewEncoder(w).Encode(f.alerts)
+		}
+	})
+	return f
+}
+
+func (f *alertmanagerSim) setAlerts(alerts ...*models.GettableAlert) {
+	f.alertsMutex.Lock()
+	defer f.alertsMutex.Unlock()
+	f.alerts = alerts
+}
+
+func TestSplitAlertmanagerHosts(t *testing.T) {
+	assert.Equal(t, []string{"am-0:9093", "am-1:9093"}, SplitAlertmanagerHosts(" am-0:9093, am-1:9093,"))
+	assert.Equal(t, []string{}, SplitAlertmanagerHosts(""))
+}
+
+func TestAlertmanagerReplicas(t *testing.T) {
+	r1, r2 := newAlertmanagerSim(), newAlertmanagerSim()
+	defer r1.close()
+	defer r2.close()
+	amHosts := alarmManager.alertmanagerHosts()
+	alarmManager.SetAlertmanagerHosts([]string{r1.host(), r2.host()})
+	defer alarmManager.SetAlertmanagerHosts(amHosts)
+
+	labels := models.LabelSet{"alertname": "TEST"}
+	annotations := models.LabelSet{"summary": "test"}
+
+	// Alerts are posted to every replica
+	_, err := alarmManager.PostAlert(labels, annotations)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(r1.received("POST")))
+	assert.Equal(t, 1, len(r2.received("POST")))
+
+	// Losing one replica doesn't fail the post, and the replica is unhealthy
+	r1.setFail(true)
+	_, err = alarmManager.PostAlert(labels, annotations)
+	assert.Nil(t, err)
+	endpoints := alarmManager.AlertmanagerEndpoints()
+	assert.False(t, endpoints[0].Healthy)
+	assert.Equal(t, 1, endpoints[0].ConsecutiveFailures)
+	assert.NotEmpty(t, endpoints[0].LastError)
+	assert.True(t, endpoints[1].Healthy)
+	assert.Equal(t, float64(0), testutil.ToFloat64(alertmanagerUp.WithLabelValues(r1.host())))
+	assert.Equal(t, []string{r2.host(), r1.host()}, alarmManager.alertmanagerHosts())
+
+	// Alerts are queried from the healthy replica
+	resp, err := alarmManager.GetAlerts()
+	assert.Nil(t, err)
+	assert.NotNil(t, resp)
+	assert.Equal(t, 0, len(r1.received("GET")))
+	assert.Equal(t, 1, len(r2.received("GET")))
+
+	// Failover to the other replica when the healthy one fails
+	r1.setFail(false)
+	r2.setFail(true)
+	resp, err = alarmManager.GetAlerts()
+	assert.Nil(t, err)
+	assert.NotNil(t, resp)
+	assert.Equal(t, 1, len(r1.received("GET")))
+	endpoints = alarmManager.AlertmanagerEndpoints()
+	assert.True(t, endpoints[0].Healthy)
+	assert.False(t, endpoints[1].Healthy)
+
+	// Post fails only when all replicas fail
+	r1.setFail(true)
+	_, err = alarmManager.PostAlert(labels, annotations)
+	assert.NotNil(t, err)
+
+	// Health is kept when the replicas are reconfigured
+	alarmManager.SetAlertmanagerHosts([]string{r2.host()})
+	endpoints = alarmManager.AlertmanagerEndpoints()
+	assert.Equal(t, 1, len(endpoints))
+	assert.Equal(t, 2, endpoints[0].ConsecutiveFailures)
+
+	req, _ := http.NewRequest("GET", "/ric/v1/alertmanagers", nil)
+	rr := executeRequest(req, alarmManager.GetAlertmanagers)
+	checkResponseCode(t, http.StatusOK, rr.Code)
+	var status []AlertmanagerEndpoint
+	json.NewDecoder(rr.Body).Decode(&status)
+	assert.Equal(t, endpoints, status)
+}
@@ -0,0 +1,259 @@
+/*
+ *  Copyright (c) 2020 AT&T Intellectual Property.
+ *  Copyright (c) 2020 Nokia.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ * This source code is part of the near-RT RIC (RAN Intelligent Controller)
+ * platform project (RICP).
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/alarm-go.git/alarm"
+	app "gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/xapp"
+	"github.com/prometheus/alertmanager/api/v2/models"
+	"github.com/spf13/viper"
+)
+
+const (
+	DefaultAlertTimeFormat   = "02/01/2006, 15:04:05"
+	DefaultAlertGeneratorUrl = "http://service-ricplt-alarmmanager-http.ricplt:8080/ric/v1/alarms"
+)
+
+var alertLabelName = regexp.MustCompile("^[a-zA-Z_][a-zA-Z0-9_]*$")
+
+// AlertMappingConfig is the configurable mapping of the alarms to Alert Manager alerts. The labels, annotations and
+// generator URL are Go templates executed with AlertTemplateData. The labels and annotations are added to the default
+// ones, or replace them, and a template resulting in an empty string removes the label or annotation. The mapping can
+// be overridden per alarm definition, the key being the specific problem. The labels matched by the alarm silences,
+// see SilenceMatchers, can't be changed.
+type AlertMappingConfig struct {
+	Labels       map[string]string               `mapstructure:"labels"`
+	Annotations  map[string]string               `mapstructure:"annotations"`
+	TimeFormat   string                          `mapstructure:"timeFormat"`
+	GeneratorUrl string                          `mapstructure:"generatorUrl"`
+	Definitions  map[string]AlertMappingOverride `mapstructure:"definitions"`
+}
+
+// AlertMappingOverride is the mapping of the alarms of an alarm definition, applied on top of the common mapping
+type AlertMappingOverride struct {
+	Labels       map[string]string `mapstructure:"labels"`
+	Annotations  map[string]string `mapstructure:"annotations"`
+	GeneratorUrl string            `mapstructure:"generatorUrl"`
+}
+
+// AlertTemplateData is given to the templates of the alert mapping. The alarm and definition fields are promoted,
+// e.g. {{.ManagedObjectId}} and {{.AlarmText}}, and AlarmId is the alarm ID given by the Alarm Manager.
+type AlertTemplateData struct {
+	AlarmId   int
+	AlarmTime int64
+	Status    AlertStatus
+	alarm.Alarm
+	alarm.AlarmDefinition
+}
+
+// alertTemplateData returns the template data of the alarm. The alarm definition is empty if not found.
+func alertTemplateData(alarmId int, a alarm.Alarm, status AlertStatus, alarmTime int64) AlertTemplateData {
+	data := AlertTemplateData{AlarmId: alarmId, AlarmTime: alarmTime, Status: status, Alarm: a}
+	if alarmDef, ok := alarm.RICAlarmDefinitions[a.SpecificProblem]; ok && alarmDef != nil {
+		data.AlarmDefinition = *alarmDef
+	}
+	return data
+}
+
+// AlertMapping returns the alert mapping in use, by default the mapping giving the default labels and annotations
+func (a *AlarmManager) AlertMapping() *AlertMapping {
+	if m := a.alertMapping.Load(); m != nil {
+		return m
+	}
+	a.alertMapping.CompareAndSwap(nil, DefaultAlertMapping())
+	return a.alertMapping.Load()
+}
+
+// AlertMapping is the compiled alert mapping
+type AlertMapping struct {
+	timeFormat  string
+	common      alertTemplates
+	definitions map[int]alertTemplates
+}
+
+type alertTemplates struct {
+	labels       map[string]*template.Template
+	annotations  map[string]*template.Template
+	generatorUrl *template.Template
+}
+
+// ReadAlertMapping reads the alert mapping. The default mapping is used if the configuration is invalid.
+func ReadAlertMapping() *AlertMapping {
+	var cfg AlertMappingConfig
+	if err := viper.UnmarshalKey("controls.alertMapping", &cfg); err != nil {
+		app.Logger.Error("Invalid alert mapping configuration: %v", err)
+		return DefaultAlertMapping()
+	}
+
+	m, err := NewAlertMapping(cfg)
+	if err != nil {
+		app.Logger.Error("Invalid alert mapping configuration: %v", err)
+		return DefaultAlertMapping()
+	}
+	return m
+}
+
+// DefaultAlertMapping returns the mapping giving the default labels and annotations
+func DefaultAlertMapping() *AlertMapping {
+	m, _ := NewAlertMapping(AlertMappingConfig{})
+	return m
+}
+
+// NewAlertMapping compiles the templates of the alert mapping
+func NewAlertMapping(cfg AlertMappingConfig) (*AlertMapping, error) {
+	m := &AlertMapping{timeFormat: cfg.TimeFormat, definitions: make(map[int]alertTemplates)}
+	if m.timeFormat == "" {
+		m.timeFormat = DefaultAlertTimeFormat
+	}
+	if cfg.GeneratorUrl == "" {
+		cfg.GeneratorUrl = DefaultAlertGeneratorUrl
+	}
+
+	var err error
+	if m.common, err = m.compile("", cfg.Labels, cfg.Annotations, cfg.GeneratorUrl); err != nil {
+		return nil, err
+	}
+
+	for key, o := range cfg.Definitions {
+		sp, err := strconv.Atoi(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid specific problem '%s' in alert mapping", key)
+		}
+		if m.definitions[sp], err = m.compile(key+".", o.Labels, o.Annotations, o.GeneratorUrl); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func (m *AlertMapping) compile(prefix string, labels, annotations map[string]string, generatorUrl string) (alertTemplates, error) {
+	t := alertTemplates{labels: make(map[string]*template.Template), annotations: make(map[string]*template.Template)}
+	for _, c := range []struct {
+		kind      string
+		texts     map[string]string
+		templates map[string]*template.Template
+	}{{"label", labels, t.labels}, {"annotation", annotations, t.annotations}} {
+		for name, text := range c.texts {
+			if !alertLabelName.MatchString(name) {
+				return t, fmt.Errorf("invalid %s name '%s' in alert mapping", c.kind, name)
+			}
+			if c.kind == "label" && isSilenceLabel(name) {
+				return t, fmt.Errorf("label '%s' matched by the alarm silences can't be changed in alert mapping", name)
+			}
+			tmpl, err := m.parse(prefix+name, text)
+			if err != nil {
+				return t, fmt.Errorf("invalid template of %s '%s' in alert mapping: %v", c.kind, name, err)
+			}
+			c.templates[name] = tmpl
+		}
+	}
+
+	if generatorUrl != "" {
+		tmpl, err := m.parse(prefix+"generatorUrl", generatorUrl)
+		if err != nil {
+			return t, fmt.Errorf("invalid template of generator URL in alert mapping: %v", err)
+		}
+		t.generatorUrl = tmpl
+	}
+	return t, nil
+}
+
+func (m *AlertMapping) parse(name, text string) (*template.Template, error) {
+	return template.New(name).Funcs(template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+		"time":  m.FormatTime,
+		"lower": strings.ToLower,
+		"upper": strings.ToUpper,
+	}).Parse(text)
+}
+
+// FormatTime formats the alarm time with the time format of the mapping
+func (m *AlertMapping) FormatTime(t int64) string {
+	return time.Unix(0, t).Format(m.timeFormat)
+}
+
+// Apply executes the label and annotation templates of the mapping, first the common ones and then the ones of
+// the alarm definition. A template failing is logged, and the label or annotation is left as it is.
+func (m *AlertMapping) Apply(data AlertTemplateData, amLabels, amAnnotations models.LabelSet) {
+	for _, t := range m.templates(data.SpecificProblem) {
+		apply(data, t.labels, amLabels)
+		apply(data, t.annotations, amAnnotations)
+	}
+}
+
+func apply(data AlertTemplateData, templates map[string]*template.Template, set models.LabelSet) {
+	for name, tmpl := range templates {
+		value, err := execute(tmpl, data)
+		if err != nil {
+			app.Logger.Error("Alert mapping '%s' failed for alarm (sp=%d id=%d): %v", tmpl.Name(), data.SpecificProblem, data.AlarmId, err)
+			continue
+		}
+		if value == "" {
+			delete(set, name)
+		} else {
+			set[name] = value
+		}
+	}
+}
+
+// GeneratorURL returns the generator URL of the alert, i.e. the link to the alarm details
+func (m *AlertMapping) GeneratorURL(data AlertTemplateData) string {
+	url := DefaultAlertGeneratorUrl
+	for _, t := range m.templates(data.SpecificProblem) {
+		if t.generatorUrl == nil {
+			continue
+		}
+		value, err := execute(t.generatorUrl, data)
+		if err != nil {
+			app.Logger.Error("Alert mapping '%s' failed for alarm (sp=%d id=%d): %v", t.generatorUrl.Name(), data.SpecificProblem, data.AlarmId, err)
+			continue
+		}
+		url = value
+	}
+	return url
+}
+
+func (m *AlertMapping) templates(specificProblem int) []alertTemplates {
+	if o, ok := m.definitions[specificProblem]; ok {
+		return []alertTemplates{m.common, o}
+	}
+	return []alertTemplates{m.common}
+}
+
+func execute(tmpl *template.Template, data AlertTemplateData) (string, error) {
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(b.String()), nil
+}
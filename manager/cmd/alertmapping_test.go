@@ -0,0 +1,107 @@
+/*
+ *  Copyright (c) 2020 AT&T Intellectual Property.
+ *  Copyright (c) 2020 Nokia.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ * This source code is part of the near-RT RIC (RAN Intelligent Controller)
+ * platform project (RICP).
+ */
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/alarm-go.git/alarm"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAlertMapping(t *testing.T) {
+	viper.Set("controls.alertMapping", map[string]interface{}{
+		"labels": map[string]interface{}{
+			"cluster":  "ric-1",
+			"team":     "{{if eq .PerceivedSeverity \"CRITICAL\"}}ric-oncall{{else}}ric-ops{{end}}",
+			"instance": "{{.ManagedObjectId}}",
+			"status":   "",
+		},
+		"annotations": map[string]interface{}{
+			"runbook": "https://runbooks.example.com/{{.SpecificProblem}}",
+		},
+		"timeFormat":   time.RFC3339,
+		"generatorUrl": "http://alarm-ui.example.com/alarms/{{.AlarmId}}",
+		"definitions": map[string]interface{}{
+			"72004": map[string]interface{}{
+				"labels":       map[string]interface{}{"team": "e2-team", "summary": "{{lower .AlarmText}}"},
+				"generatorUrl": "http://e2-ui.example.com/{{.IdentifyingInfo}}",
+			},
+		},
+	})
+	defer viper.Set("controls.alertMapping", nil)
+	alarmManager.alertMapping.Store(ReadAlertMapping())
+	defer alarmManager.alertMapping.Store(DefaultAlertMapping())
+
+	alarmTime := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC).UnixNano()
+	a := alarmer.NewAlarm(alarm.ACTIVE_ALARM_EXCEED_MAX_THRESHOLD, alarm.SeverityCritical, "Some App data", "eth 0 1")
+	amLabels, amAnnotations := alarmManager.GenerateAlertLabels(7, a, AlertStatusActive, alarmTime)
+	assert.Equal(t, "ric-1", amLabels["cluster"])
+	assert.Equal(t, "ric-oncall", amLabels["team"])
+	assert.Equal(t, a.ManagedObjectId, amLabels["instance"])
+	assert.NotContains(t, amLabels, "status")
+	assert.Equal(t, alarm.RICAlarmDefinitions[alarm.ACTIVE_ALARM_EXCEED_MAX_THRESHOLD].AlarmText, amLabels["alertname"])
+	assert.Equal(t, "https://runbooks.example.com/72007", amAnnotations["runbook"])
+	assert.Equal(t, time.Unix(0, alarmTime).Format(time.RFC3339), amAnnotations["timestamp"])
+	n := AlarmNotification{AlarmMessage: alarm.AlarmMessage{Alarm: a, AlarmTime: alarmTime}}
+	n.AlarmId = 7
+	assert.Equal(t, "http://alarm-ui.example.com/alarms/7", alarmManager.generatorURL(&n))
+
+	// Definition specific mapping is applied on top of the common one
+	a = alarmer.NewAlarm(alarm.E2_CONNECTION_PROBLEM, alarm.SeverityMajor, "Some App data", "eth 0 1")
+	amLabels, _ = alarmManager.GenerateAlertLabels(8, a, AlertStatusActive, alarmTime)
+	assert.Equal(t, "ric-1", amLabels["cluster"])
+	assert.Equal(t, "e2-team", amLabels["team"])
+	assert.Equal(t, strings.ToLower(alarm.RICAlarmDefinitions[alarm.E2_CONNECTION_PROBLEM].AlarmText), amLabels["summary"])
+	n = AlarmNotification{AlarmMessage: alarm.AlarmMessage{Alarm: a, AlarmTime: alarmTime}}
+	assert.Equal(t, "http://e2-ui.example.com/eth 0 1", alarmManager.generatorURL(&n))
+}
+
+func TestDefaultAlertMapping(t *testing.T) {
+	a := alarmer.NewAlarm(alarm.E2_CONNECTION_PROBLEM, alarm.SeverityMajor, "Some App data", "eth 0 1")
+	alarmTime := time.Now().UnixNano()
+	amLabels, amAnnotations := alarmManager.GenerateAlertLabels(1, a, AlertStatusActive, alarmTime)
+	assert.Equal(t, "RIC", amLabels["system_name"])
+	assert.Equal(t, a.ManagedObjectId+"/"+a.ApplicationId, amLabels["service"])
+	assert.Equal(t, time.Unix(0, alarmTime).Format(DefaultAlertTimeFormat), amAnnotations["timestamp"])
+	n := AlarmNotification{AlarmMessage: alarm.AlarmMessage{Alarm: a, AlarmTime: alarmTime}}
+	assert.Equal(t, DefaultAlertGeneratorUrl, alarmManager.generatorURL(&n))
+
+	_, err := NewAlertMapping(AlertMappingConfig{Labels: map[string]string{"invalid-name": "x"}})
+	assert.NotNil(t, err)
+	_, err = NewAlertMapping(AlertMappingConfig{Annotations: map[string]string{"summary": "{{.Foo"}})
+	assert.NotNil(t, err)
+	_, err = NewAlertMapping(AlertMappingConfig{Definitions: map[string]AlertMappingOverride{"foo": {}}})
+	assert.NotNil(t, err)
+
+	// The labels matched by the alarm silences can't be changed nor removed
+	for _, name := range []string{"system_name", "alertname", "service", "info", "severity"} {
+		_, err = NewAlertMapping(AlertMappingConfig{Labels: map[string]string{name: ""}})
+		assert.NotNil(t, err, name)
+		_, err = NewAlertMapping(AlertMappingConfig{Definitions: map[string]AlertMappingOverride{"72004": {Labels: map[string]string{name: "x"}}}})
+		assert.NotNil(t, err, name)
+	}
+	_, err = NewAlertMapping(AlertMappingConfig{Annotations: map[string]string{"service": "{{.ManagedObjectId}}"}})
+	assert.Nil(t, err)
+}
@@ -0,0 +1,366 @@
+/*
+ *  Copyright (c) 2020 AT&T Intellectual Property.
+ *  Copyright (c) 2020 Nokia.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ * This source code is part of the near-RT RIC (RAN Intelligent Controller)
+ * platform project (RICP).
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/alarm-go.git/alarm"
+	app "gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/xapp"
+	"github.com/spf13/viper"
+)
+
+const (
+	DefaultFMManagedObjectId   = "SEP"
+	DefaultFMApplicationId     = "FM"
+	DefaultFMServiceRegex      = ".*FM.*"
+	DefaultReconcileInterval   = 300000
+	alertmanagerStatusFiring   = "firing"
+	alertmanagerStatusResolved = "resolved"
+)
+
+// AlertReceiverConfig maps the FM alerts, i.e. the Alert Manager alerts not originated from the alarms, to alarms.
+// The alerts are selected by the labels having the values of Selector, and matching the regular expressions of
+// SelectorRegex, if given. The alarm fields are taken from the named
+// labels, or annotations if there is no such label, and the managed object and application fall back to the
+// defaults if not given. The alerts are pushed to the webhook receiver, and the FM alarms are reconciled with the
+// alerts of Alert Manager every ReconcileInterval milliseconds in case a notification is lost, negative disabling it.
+type AlertReceiverConfig struct {
+	Selector          map[string]string `mapstructure:"selector"`
+	SelectorRegex     map[string]string `mapstructure:"selectorRegex"`
+	SpecificProblem   string            `mapstructure:"specificProblem"`
+	ManagedObjectId   string            `mapstructure:"managedObjectId"`
+	ApplicationId     string            `mapstructure:"applicationId"`
+	IdentifyingInfo   string            `mapstructure:"identifyingInfo"`
+	AdditionalInfo    string            `mapstructure:"additionalInfo"`
+	PerceivedSeverity string            `mapstructure:"perceivedSeverity"`
+	ReconcileInterval int               `mapstructure:"reconcileInterval"`
+	selectorRegex     map[string]*regexp.Regexp
+}
+
+// AlertmanagerWebhookMessage is the notification posted by the webhook receiver of Alert Manager
+type AlertmanagerWebhookMessage struct {
+	Version     string                     `json:"version"`
+	GroupKey    string                     `json:"groupKey"`
+	Status      string                     `json:"status"`
+	Receiver    string                     `json:"receiver"`
+	ExternalURL string                     `json:"externalURL"`
+	Alerts      []AlertmanagerWebhookAlert `json:"alerts"`
+}
+
+// AlertmanagerWebhookAlert is an alert of the webhook notification
+type AlertmanagerWebhookAlert struct {
+	Status       string            `json:"status"`
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt"`
+	GeneratorURL string            `json:"generatorURL"`
+	Fingerprint  string            `json:"fingerprint"`
+}
+
+// DefaultAlertReceiverConfig returns the default mapping of the FM alerts, selecting the alerts of a service
+// containing FM
+func DefaultAlertReceiverConfig() *AlertReceiverConfig {
+	cfg := &AlertReceiverConfig{
+		SelectorRegex:     map[string]string{"service": DefaultFMServiceRegex},
+		SpecificProblem:   "specific_problem",
+		IdentifyingInfo:   "description",
+		AdditionalInfo:    "name",
+		PerceivedSeverity: "severity",
+		ReconcileInterval: DefaultReconcileInterval,
+	}
+	cfg.CompileSelector()
+	return cfg
+}
+
+// ReadAlertReceiverConfig reads the mapping of the FM alerts. The fields not configured keep their defaults.
+func ReadAlertReceiverConfig() *AlertReceiverConfig {
+	cfg := DefaultAlertReceiverConfig()
+	if !viper.IsSet("controls.alertReceiver") {
+		return cfg
+	}
+
+	// The configured selector replaces the default one instead of being merged with it
+	if viper.IsSet("controls.alertReceiver.selector") || viper.IsSet("controls.alertReceiver.selectorRegex") {
+		cfg.Selector, cfg.SelectorRegex = nil, nil
+	}
+	if err := viper.UnmarshalKey("controls.alertReceiver", cfg); err != nil {
+		app.Logger.Error("Invalid alert receiver configuration: %v", err)
+		return DefaultAlertReceiverConfig()
+	}
+	if err := cfg.CompileSelector(); err != nil {
+		app.Logger.Error("Invalid alert receiver configuration: %v", err)
+		return DefaultAlertReceiverConfig()
+	}
+	return cfg
+}
+
+// CompileSelector compiles the regular expressions of the selector. The expressions match the whole label value.
+func (c *AlertReceiverConfig) CompileSelector() error {
+	c.selectorRegex = make(map[string]*regexp.Regexp, len(c.SelectorRegex))
+	for k, v := range c.SelectorRegex {
+		re, err := regexp.Compile("^(?:" + v + ")$")
+		if err != nil {
+			return fmt.Errorf("invalid selector regex of label '%s': %v", k, err)
+		}
+		c.selectorRegex[k] = re
+	}
+	return nil
+}
+
+// AlertReceiver returns the mapping of the FM alerts in use
+func (a *AlarmManager) AlertReceiver() *AlertReceiverConfig {
+	if c := a.alertReceiver.Load(); c != nil {
+		return c
+	}
+	a.alertReceiver.CompareAndSwap(nil, DefaultAlertReceiverConfig())
+	return a.alertReceiver.Load()
+}
+
+// Selects tells if the alert with the labels is an FM alert. Nothing is selected without a selector.
+func (c *AlertReceiverConfig) Selects(labels map[string]string) bool {
+	if len(c.Selector) == 0 && len(c.selectorRegex) == 0 {
+		return false
+	}
+	for k, v := range c.Selector {
+		if l, ok := labels[k]; !ok || l != v {
+			return false
+		}
+	}
+	for k, re := range c.selectorRegex {
+		if l, ok := labels[k]; !ok || !re.MatchString(l) {
+			return false
+		}
+	}
+	return true
+}
+
+// Alarm builds the alarm of an FM alert
+func (c *AlertReceiverConfig) Alarm(labels, annotations map[string]string) alarm.Alarm {
+	var value = func(name string) (string, bool) {
+		if name == "" {
+			return "", false
+		}
+		if v, ok := labels[name]; ok {
+			return v, true
+		}
+		v, ok := annotations[name]
+		return v, ok
+	}
+
+	a := alarm.Alarm{ManagedObjectId: DefaultFMManagedObjectId, ApplicationId: DefaultFMApplicationId}
+	if v, ok := value(c.ManagedObjectId); ok && v != "" {
+		a.ManagedObjectId = v
+	}
+	if v, ok := value(c.ApplicationId); ok && v != "" {
+		a.ApplicationId = v
+	}
+	if v, ok := value(c.SpecificProblem); ok {
+		a.SpecificProblem, _ = strconv.Atoi(v)
+	}
+	if v, ok := value(c.PerceivedSeverity); ok {
+		a.PerceivedSeverity = alarm.Severity(strings.ToUpper(v))
+	}
+	if v, ok := value(c.IdentifyingInfo); ok {
+		a.IdentifyingInfo = v
+	}
+	if v, ok := value(c.AdditionalInfo); ok {
+		a.AdditionalInfo = v
+	}
+	return a
+}
+
+// fmAlarmKey identifies the alarm the way IsMatchFound does
+func fmAlarmKey(a alarm.Alarm) string {
+	return fmt.Sprintf("%s/%s/%d/%s", a.ManagedObjectId, a.ApplicationId, a.SpecificProblem, a.IdentifyingInfo)
+}
+
+// IsFMAlarm tells if the alarm is built from an FM alert. Those are not posted back to Alert Manager. The alarms
+// of the FM applications are recognized by the application ID, the others by the markers set when raised.
+func (a *AlarmManager) IsFMAlarm(m alarm.Alarm) bool {
+	if strings.Contains(m.ApplicationId, DefaultFMApplicationId) {
+		return true
+	}
+
+	a.fmMutex.Lock()
+	defer a.fmMutex.Unlock()
+	return a.fmAlarms[fmAlarmKey(m)]
+}
+
+// markFMAlarm marks the alarm as built from an FM alert before it is raised, to keep it from being posted to
+// Alert Manager. Called with fmSync held.
+func (a *AlarmManager) markFMAlarm(m alarm.Alarm) {
+	a.fmMutex.Lock()
+	defer a.fmMutex.Unlock()
+
+	if a.fmAlarms == nil {
+		a.fmAlarms = make(map[string]bool)
+	}
+	a.fmAlarms[fmAlarmKey(m)] = true
+}
+
+// processFMAlarms raises and clears the alarms of FM alerts. It is called without fmSync held, so that the FM
+// alerts are not waiting for the alarm processing, e.g. a raise delay. The markers of the alarms not active
+// afterwards, i.e. cleared or not raised e.g. due to an unknown specific problem, are removed.
+func (a *AlarmManager) processFMAlarms(msgs []alarm.AlarmMessage) {
+	for _, msg := range msgs {
+		a.ProcessAlarm(&AlarmNotification{AlarmMessage: msg})
+
+		a.mutex.Lock()
+		if _, found := a.IsMatchFound(msg.Alarm); !found {
+			a.fmMutex.Lock()
+			delete(a.fmAlarms, fmAlarmKey(msg.Alarm))
+			a.fmMutex.Unlock()
+		}
+		a.mutex.Unlock()
+	}
+}
+
+// ProcessWebhookMessage raises and clears the alarms of the FM alerts of the notification. The alerts not
+// selected by the mapping are ignored. Returns the number of alarms raised and cleared.
+func (a *AlarmManager) ProcessWebhookMessage(msg AlertmanagerWebhookMessage) (raised, cleared int) {
+	cfg := a.AlertReceiver()
+
+	a.fmSync.Lock()
+	var msgs []alarm.AlarmMessage
+	for _, alert := range msg.Alerts {
+		if !cfg.Selects(alert.Labels) {
+			continue
+		}
+
+		m := cfg.Alarm(alert.Labels, alert.Annotations)
+		switch alert.Status {
+		case alertmanagerStatusFiring:
+			a.markFMAlarm(m)
+			msgs = append(msgs, alarm.AlarmMessage{Alarm: m, AlarmAction: alarm.AlarmActionRaise, AlarmTime: webhookAlertTime(alert.StartsAt)})
+			raised++
+		case alertmanagerStatusResolved:
+			msgs = append(msgs, alarm.AlarmMessage{Alarm: m, AlarmAction: alarm.AlarmActionClear, AlarmTime: webhookAlertTime(alert.EndsAt)})
+			cleared++
+		default:
+			app.Logger.Warn("Unknown status '%s' of alert %v, ignoring", alert.Status, alert.Labels)
+		}
+	}
+	a.fmSync.Unlock()
+
+	a.processFMAlarms(msgs)
+	return raised, cleared
+}
+
+func webhookAlertTime(t time.Time) int64 {
+	if t.IsZero() || t.After(time.Now()) {
+		return time.Now().UnixNano()
+	}
+	return t.UnixNano()
+}
+
+// ReceiveAlertmanagerWebhook is the webhook receiver of the Alert Manager notifications
+func (a *AlarmManager) ReceiveAlertmanagerWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Body == nil {
+		app.Logger.Error("POST - body is empty")
+		a.respondWithError(w, http.StatusBadRequest, "No data in request body.")
+		return
+	}
+	defer r.Body.Close()
+
+	var msg AlertmanagerWebhookMessage
+	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+		app.Logger.Error("POST - received webhook notification is invalid: %v", err)
+		a.respondWithError(w, http.StatusBadRequest, "Invalid data in request body.")
+		return
+	}
+
+	raised, cleared := a.ProcessWebhookMessage(msg)
+	app.Logger.Info("Alert Manager notification '%s': %d FM alarms raised, %d cleared", msg.GroupKey, raised, cleared)
+	a.respondWithJSON(w, http.StatusOK, map[string]int{"raised": raised, "cleared": cleared})
+}
+
+// ProcessAlerts reconciles the FM alarms with the active alerts of Alert Manager: the alarms of the alerts not
+// active anymore are cleared, and the alarms of the active alerts raised unless active already.
+func (a *AlarmManager) ProcessAlerts() {
+	resp, err := a.GetAlerts()
+	if err != nil || resp == nil {
+		app.Logger.Error("Getting alerts from Alert Manager failed: %v", err)
+		return
+	}
+	cfg := a.AlertReceiver()
+
+	a.fmSync.Lock()
+	// The alarms of the firing alerts are marked also when active already, e.g. restored after a restart
+	firing := make(map[string]alarm.Alarm)
+	for _, alert := range resp.Payload {
+		if alert == nil || !cfg.Selects(alert.Labels) {
+			continue
+		}
+		m := cfg.Alarm(alert.Labels, alert.Annotations)
+		firing[fmAlarmKey(m)] = m
+		a.markFMAlarm(m)
+	}
+
+	a.mutex.Lock()
+	active := make(map[string]alarm.Alarm)
+	for _, m := range a.activeAlarms {
+		if a.IsFMAlarm(m.Alarm) {
+			active[fmAlarmKey(m.Alarm)] = m.Alarm
+		}
+	}
+	a.mutex.Unlock()
+
+	var msgs []alarm.AlarmMessage
+	now := time.Now().UnixNano()
+	for k, m := range active {
+		if _, ok := firing[k]; !ok {
+			app.Logger.Info("FM alarm not active in Alert Manager, clearing: %v", m)
+			msgs = append(msgs, alarm.AlarmMessage{Alarm: m, AlarmAction: alarm.AlarmActionClear, AlarmTime: now})
+		}
+	}
+
+	for k, m := range firing {
+		if n, ok := active[k]; ok && n.PerceivedSeverity == m.PerceivedSeverity {
+			continue
+		}
+		app.Logger.Info("FM alarm active in Alert Manager, raising: %v", m)
+		msgs = append(msgs, alarm.AlarmMessage{Alarm: m, AlarmAction: alarm.AlarmActionRaise, AlarmTime: now})
+	}
+	a.fmSync.Unlock()
+
+	a.processFMAlarms(msgs)
+}
+
+// reconcileDue tells if the FM alarms are to be reconciled with Alert Manager
+func (a *AlarmManager) reconcileDue() bool {
+	interval := a.AlertReceiver().ReconcileInterval
+	if interval < 0 {
+		return false
+	}
+	now, last := time.Now(), a.lastReconcile.Load()
+	if now.Sub(time.Unix(0, last)) < time.Duration(interval)*time.Millisecond {
+		return false
+	}
+	return a.lastReconcile.CompareAndSwap(last, now.UnixNano())
+}
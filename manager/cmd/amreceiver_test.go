@@ -0,0 +1,219 @@
+/*
+ *  Copyright (c) 2020 AT&T Intellectual Property.
+ *  Copyright (c) 2020 Nokia.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ * This source code is part of the near-RT RIC (RAN Intelligent Controller)
+ * platform project (RICP).
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/alarm-go.git/alarm"
+	"github.com/prometheus/alertmanager/api/v2/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func fmAlert(labels, annotations map[string]string) *models.GettableAlert {
+	return &models.GettableAlert{Alert: models.Alert{Labels: labels}, Annotations: annotations}
+}
+
+func postWebhookMessage(t *testing.T, msg AlertmanagerWebhookMessage) map[string]int {
+	body, _ := json.Marshal(msg)
+	req, _ := http.NewRequest("POST", "/ric/v1/alertmanager/webhook", bytes.NewBuffer(body))
+	rr := executeRequest(req, alarmManager.ReceiveAlertmanagerWebhook)
+	checkResponseCode(t, http.StatusOK, rr.Code)
+
+	var counts map[string]int
+	json.NewDecoder(rr.Body).Decode(&counts)
+	return counts
+}
+
+func TestAlertReceiverMapping(t *testing.T) {
+	cfg := DefaultAlertReceiverConfig()
+	labels := map[string]string{"service": "FM", "specific_problem": "72004", "severity": "critical", "name": "link down"}
+	annotations := map[string]string{"description": "gnb-1"}
+
+	assert.True(t, cfg.Selects(labels))
+	assert.False(t, cfg.Selects(map[string]string{"service": "my-pod/my-app"}))
+	assert.True(t, cfg.Selects(map[string]string{"service": "xFMon/xFMon"}))
+	assert.Equal(t, alarm.Alarm{ManagedObjectId: "SEP", ApplicationId: "FM", SpecificProblem: 72004,
+		PerceivedSeverity: alarm.SeverityCritical, IdentifyingInfo: "gnb-1", AdditionalInfo: "link down"},
+		cfg.Alarm(labels, annotations))
+
+	cfg.Selector = map[string]string{"source": "infra"}
+	cfg.SelectorRegex = nil
+	assert.Nil(t, cfg.CompileSelector())
+	cfg.ManagedObjectId = "instance"
+	cfg.ApplicationId = "job"
+	cfg.SpecificProblem = "sp"
+	cfg.IdentifyingInfo = "device"
+	labels = map[string]string{"source": "infra", "sp": "72007", "instance": "node-1", "job": "node-exporter", "device": "eth0"}
+
+	assert.True(t, cfg.Selects(labels))
+	m := cfg.Alarm(labels, nil)
+	assert.Equal(t, "node-1", m.ManagedObjectId)
+	assert.Equal(t, "node-exporter", m.ApplicationId)
+	assert.Equal(t, 72007, m.SpecificProblem)
+	assert.Equal(t, "eth0", m.IdentifyingInfo)
+
+	// Managed object and application fall back to the defaults
+	delete(labels, "instance")
+	delete(labels, "job")
+	m = cfg.Alarm(labels, nil)
+	assert.Equal(t, "SEP", m.ManagedObjectId)
+	assert.Equal(t, "FM", m.ApplicationId)
+
+	// Regular expressions match the whole label value
+	cfg.Selector = nil
+	cfg.SelectorRegex = map[string]string{"service": "RIC-.*"}
+	assert.Nil(t, cfg.CompileSelector())
+	assert.True(t, cfg.Selects(map[string]string{"service": "RIC-FM"}))
+	assert.False(t, cfg.Selects(map[string]string{"service": "xRIC-FM"}))
+
+	cfg.SelectorRegex = map[string]string{"service": "("}
+	assert.NotNil(t, cfg.CompileSelector())
+}
+
+func TestReadAlertReceiverConfig(t *testing.T) {
+	// The alerts of any service containing FM are selected by default
+	cfg := ReadAlertReceiverConfig()
+	assert.Equal(t, map[string]string{"service": DefaultFMServiceRegex}, cfg.SelectorRegex)
+	assert.True(t, cfg.Selects(map[string]string{"service": "FM"}))
+	assert.True(t, cfg.Selects(map[string]string{"service": "xFMon/xFMon"}))
+	assert.False(t, cfg.Selects(map[string]string{"service": "my-pod/my-app"}))
+}
+
+func TestAlertmanagerWebhook(t *testing.T) {
+	am := newAlertmanagerSim()
+	defer am.close()
+	amHosts := alarmManager.alertmanagerHosts()
+	alarmManager.SetAlertmanagerHosts([]string{am.host()})
+	defer alarmManager.SetAlertmanagerHosts(amHosts)
+
+	cfg := DefaultAlertReceiverConfig()
+	cfg.ApplicationId = "job"
+	defer alarmManager.alertReceiver.Store(alarmManager.AlertReceiver())
+	alarmManager.alertReceiver.Store(cfg)
+	defer isolateAlarmState()()
+
+	firing := AlertmanagerWebhookAlert{
+		Status:      "firing",
+		Labels:      map[string]string{"service": "FM", "specific_problem": "72004", "severity": "major", "job": "node-exporter"},
+		Annotations: map[string]string{"description": "gnb-1"},
+	}
+	other := AlertmanagerWebhookAlert{Status: "firing", Labels: map[string]string{"service": "my-pod/my-app"}}
+	counts := postWebhookMessage(t, AlertmanagerWebhookMessage{Status: "firing", Alerts: []AlertmanagerWebhookAlert{firing, other}})
+	assert.Equal(t, map[string]int{"raised": 1, "cleared": 0}, counts)
+
+	active := alarmManager.QueryActiveAlarms(alarm.AlarmFilter{}).Alarms
+	assert.Equal(t, 1, len(active))
+	assert.Equal(t, "node-exporter", active[0].ApplicationId)
+	assert.Equal(t, alarm.SeverityMajor, active[0].PerceivedSeverity)
+	assert.Equal(t, "gnb-1", active[0].IdentifyingInfo)
+	assert.True(t, alarmManager.IsFMAlarm(active[0].Alarm))
+	assert.True(t, alarmManager.IsFMAlarm(alarm.Alarm{ManagedObjectId: "my-pod", ApplicationId: "xFMon"}))
+	assert.False(t, alarmManager.IsFMAlarm(alarm.Alarm{ManagedObjectId: "my-pod", ApplicationId: "my-app"}))
+
+	// The FM alarms are not posted back to Alert Manager
+	assert.Equal(t, 0, len(am.received("POST")))
+
+	resolved := firing
+	resolved.Status = "resolved"
+	counts = postWebhookMessage(t, AlertmanagerWebhookMessage{Status: "resolved", Alerts: []AlertmanagerWebhookAlert{resolved}})
+	assert.Equal(t, map[string]int{"raised": 0, "cleared": 1}, counts)
+	assert.Equal(t, 0, len(alarmManager.QueryActiveAlarms(alarm.AlarmFilter{}).Alarms))
+	assert.False(t, alarmManager.IsFMAlarm(active[0].Alarm))
+	assert.Equal(t, 0, len(am.received("POST")))
+
+	req, _ := http.NewRequest("POST", "/ric/v1/alertmanager/webhook", strings.NewReader("{"))
+	rr := executeRequest(req, alarmManager.ReceiveAlertmanagerWebhook)
+	checkResponseCode(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestFMAlarmRaisedWithoutFMLock(t *testing.T) {
+	am := newAlertmanagerSim()
+	defer am.close()
+	amHosts := alarmManager.alertmanagerHosts()
+	alarmManager.SetAlertmanagerHosts([]string{am.host()})
+	defer alarmManager.SetAlertmanagerHosts(amHosts)
+	defer isolateAlarmState()()
+
+	alarm.RICAlarmDefinitions[9998] = &alarm.AlarmDefinition{AlarmId: 9998, AlarmText: "DELAYED FM ALARM", RaiseDelay: 1}
+	defer delete(alarm.RICAlarmDefinitions, 9998)
+
+	firing := AlertmanagerWebhookAlert{Status: "firing", Labels: map[string]string{"service": "FM", "specific_problem": "9998", "severity": "major"}}
+	done := make(chan struct{})
+	go func() {
+		alarmManager.ProcessWebhookMessage(AlertmanagerWebhookMessage{Status: "firing", Alerts: []AlertmanagerWebhookAlert{firing}})
+		close(done)
+	}()
+
+	// The FM alerts are not locked out while the alarm waits for its raise delay
+	time.Sleep(100 * time.Millisecond)
+	assert.True(t, alarmManager.fmSync.TryLock())
+	alarmManager.fmSync.Unlock()
+
+	<-done
+	assert.Equal(t, 1, len(alarmManager.QueryActiveAlarms(alarm.AlarmFilter{}).Alarms))
+	assert.Equal(t, 0, len(am.received("POST")))
+}
+
+func TestReconcileFMAlarms(t *testing.T) {
+	am := newAlertmanagerSim()
+	defer am.close()
+	amHosts := alarmManager.alertmanagerHosts()
+	alarmManager.SetAlertmanagerHosts([]string{am.host()})
+	defer alarmManager.SetAlertmanagerHosts(amHosts)
+	defer isolateAlarmState()()
+
+	am.setAlerts(
+		fmAlert(map[string]string{"service": "FM", "specific_problem": "72004", "severity": "MAJOR"}, map[string]string{"description": "gnb-1"}),
+		fmAlert(map[string]string{"service": "my-pod/my-app", "specific_problem": "72007"}, nil),
+	)
+	alarmManager.ProcessAlerts()
+	active := alarmManager.QueryActiveAlarms(alarm.AlarmFilter{}).Alarms
+	assert.Equal(t, 1, len(active))
+	assert.Equal(t, "gnb-1", active[0].IdentifyingInfo)
+
+	// Active alarms are not raised again
+	alarmManager.ProcessAlerts()
+	assert.Equal(t, active, alarmManager.QueryActiveAlarms(alarm.AlarmFilter{}).Alarms)
+
+	// The alarms of the alerts not active anymore are cleared
+	am.setAlerts()
+	alarmManager.ProcessAlerts()
+	assert.Equal(t, 0, len(alarmManager.QueryActiveAlarms(alarm.AlarmFilter{}).Alarms))
+	assert.Equal(t, 0, len(am.received("POST")))
+}
+
+func TestReconcileDue(t *testing.T) {
+	a := &AlarmManager{}
+	cfg := DefaultAlertReceiverConfig()
+	a.alertReceiver.Store(cfg)
+	assert.True(t, a.reconcileDue())
+	assert.False(t, a.reconcileDue())
+
+	cfg.ReconcileInterval = -1
+	a.lastReconcile.Store(0)
+	assert.False(t, a.reconcileDue())
+}
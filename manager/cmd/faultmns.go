@@ -0,0 +1,529 @@
+/*
+ *  Copyright (c) 2020 AT&T Intellectual Property.
+ *  Copyright (c) 2020 Nokia.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ * This source code is part of the near-RT RIC (RAN Intelligent Controller)
+ * platform project (RICP).
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/alarm-go.git/alarm"
+	app "gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/xapp"
+	"github.com/gorilla/mux"
+)
+
+// Root of the 3GPP TS 28.532 fault supervision REST API
+const faultMnSRoot = "/FaultSupervisionMnS/v1"
+
+// Acknowledgement state of an alarm record
+type AckState string
+
+const (
+	AckStateAcknowledged   AckState = "ACKNOWLEDGED"
+	AckStateUnacknowledged AckState = "UNACKNOWLEDGED"
+)
+
+// Notification types of the fault supervision
+const (
+	NotifyNewAlarm        = "notifyNewAlarm"
+	NotifyChangedAlarm    = "notifyChangedAlarm"
+	NotifyClearedAlarm    = "notifyClearedAlarm"
+	NotifyAckStateChanged = "notifyAckStateChanged"
+)
+
+// AlarmRecord is an alarm in the 3GPP TS 28.532 / TS 28.623 format
+type AlarmRecord struct {
+	AlarmId               string            `json:"alarmId"`
+	ObjectInstance        string            `json:"objectInstance"`
+	NotificationId        int               `json:"notificationId"`
+	AlarmRaisedTime       string            `json:"alarmRaisedTime"`
+	AlarmChangedTime      string            `json:"alarmChangedTime,omitempty"`
+	AlarmClearedTime      string            `json:"alarmClearedTime,omitempty"`
+	AlarmType             string            `json:"alarmType"`
+	ProbableCause         string            `json:"probableCause"`
+	SpecificProblem       string            `json:"specificProblem"`
+	PerceivedSeverity     string            `json:"perceivedSeverity"`
+	TrendIndication       string            `json:"trendIndication,omitempty"`
+	ProposedRepairActions string            `json:"proposedRepairActions,omitempty"`
+	AdditionalText        string            `json:"additionalText,omitempty"`
+	AdditionalInformation map[string]string `json:"additionalInformation,omitempty"`
+	AckState              AckState          `json:"ackState"`
+	AckTime               string            `json:"ackTime,omitempty"`
+	AckUserId             string            `json:"ackUserId,omitempty"`
+}
+
+// AlarmList is the reply to the alarm list query
+type AlarmList struct {
+	NumOfAlarmRecords int                    `json:"numOfAlarmRecords"`
+	AlarmRecords      map[string]AlarmRecord `json:"alarmRecords"`
+}
+
+// AlarmRecordPatch acknowledges, unacknowledges or clears an alarm record
+type AlarmRecordPatch struct {
+	AckState          AckState `json:"ackState,omitempty"`
+	AckUserId         string   `json:"ackUserId,omitempty"`
+	AckSystemId       string   `json:"ackSystemId,omitempty"`
+	PerceivedSeverity string   `json:"perceivedSeverity,omitempty"`
+	ClearUserId       string   `json:"clearUserId,omitempty"`
+	ClearSystemId     string   `json:"clearSystemId,omitempty"`
+}
+
+// FaultSubscription is a subscription of the fault supervision notifications. The notifications are posted to
+// the consumer reference, i.e. the callback URI. Empty filter selects all notification types.
+type FaultSubscription struct {
+	Id                string                   `json:"id,omitempty"`
+	ConsumerReference string                   `json:"consumerReference"`
+	Filter            *FaultSubscriptionFilter `json:"filter,omitempty"`
+}
+
+type FaultSubscriptionFilter struct {
+	NotificationTypes []string `json:"notificationTypes,omitempty"`
+}
+
+// FaultNotification is the notification posted to the subscribers
+type FaultNotification struct {
+	Href             string `json:"href"`
+	NotificationType string `json:"notificationType"`
+	EventTime        string `json:"eventTime"`
+	SystemDN         string `json:"systemDN"`
+	AlarmRecord
+}
+
+type faultAlarmState struct {
+	notificationId int
+	raisedTime     int64
+	changedTime    int64
+}
+
+type faultPost struct {
+	url  string
+	body []byte
+}
+
+// FaultMnS keeps the fault supervision subscriptions, and sends the notifications to the subscribers. The
+// subscriptions are persisted to the subscription file, if given, so that they survive a restart.
+type FaultMnS struct {
+	subscriptions    map[string]FaultSubscription
+	subscriptionFile string
+	alarms           map[int]*faultAlarmState
+	notificationId   int
+	subscriptionId   int
+	httpClient       *http.Client
+	posts            chan faultPost
+	closed           bool
+	mutex            sync.Mutex
+}
+
+func NewFaultMnS(subscriptionFile string) *FaultMnS {
+	f := &FaultMnS{
+		subscriptions:    make(map[string]FaultSubscription),
+		subscriptionFile: subscriptionFile,
+		alarms:           make(map[int]*faultAlarmState),
+		httpClient:       &http.Client{Timeout: 5 * time.Second},
+		posts:            make(chan faultPost, 1000),
+	}
+	f.readSubscriptions()
+	go f.run()
+	return f
+}
+
+// FaultSubscriptionFile returns the subscription file next to the alarm info file, or empty if not persisted
+func FaultSubscriptionFile(alarmInfoPvFile string) string {
+	if alarmInfoPvFile == "" {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(alarmInfoPvFile), "faultmns-subscriptions.json")
+}
+
+func (f *FaultMnS) readSubscriptions() {
+	if f.subscriptionFile == "" {
+		return
+	}
+
+	data, err := ioutil.ReadFile(f.subscriptionFile)
+	if err != nil {
+		app.Logger.Info("Unable to read fault supervision subscriptions: %v", err)
+		return
+	}
+	var subs []FaultSubscription
+	if err := json.Unmarshal(data, &subs); err != nil {
+		app.Logger.Error("Fault supervision subscriptions json unmarshal error %v", err)
+		return
+	}
+	for _, s := range subs {
+		f.subscriptions[s.Id] = s
+		if id, _ := strconv.Atoi(s.Id); id > f.subscriptionId {
+			f.subscriptionId = id
+		}
+	}
+}
+
+// writeSubscriptions persists the subscriptions. Called with the mutex locked.
+func (f *FaultMnS) writeSubscriptions() {
+	if f.subscriptionFile == "" {
+		return
+	}
+
+	data, err := json.MarshalIndent(f.sortedSubscriptions(), "", " ")
+	if err != nil {
+		app.Logger.Error("Fault supervision subscriptions json marshal error %v", err)
+		return
+	}
+	if err := ioutil.WriteFile(f.subscriptionFile, data, 0644); err != nil {
+		app.Logger.Error("Fault supervision subscriptions file write error %v", err)
+	}
+}
+
+// Subscribe adds the subscription, and returns it with the subscription ID
+func (f *FaultMnS) Subscribe(s FaultSubscription) FaultSubscription {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.subscriptionId++
+	s.Id = strconv.Itoa(f.subscriptionId)
+	f.subscriptions[s.Id] = s
+	f.writeSubscriptions()
+	return s
+}
+
+// Unsubscribe removes the subscription. Returns false if the subscription doesn't exist.
+func (f *FaultMnS) Unsubscribe(id string) bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if _, ok := f.subscriptions[id]; !ok {
+		return false
+	}
+	delete(f.subscriptions, id)
+	f.writeSubscriptions()
+	return true
+}
+
+// Subscriptions returns the subscriptions ordered by the subscription ID
+func (f *FaultMnS) Subscriptions() []FaultSubscription {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.sortedSubscriptions()
+}
+
+func (f *FaultMnS) sortedSubscriptions() []FaultSubscription {
+	subs := make([]FaultSubscription, 0, len(f.subscriptions))
+	for _, s := range f.subscriptions {
+		subs = append(subs, s)
+	}
+	sort.Slice(subs, func(i, j int) bool {
+		a, _ := strconv.Atoi(subs[i].Id)
+		b, _ := strconv.Atoi(subs[j].Id)
+		return a < b
+	})
+	return subs
+}
+
+// Notify sends the fault notification of the alarm to the subscribers
+func (f *FaultMnS) Notify(m AlarmNotification) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.closed {
+		return
+	}
+
+	eventTime := m.AlarmTime
+	if eventTime == 0 {
+		eventTime = time.Now().UnixNano()
+	}
+
+	state, ok := f.alarms[m.AlarmId]
+	if !ok {
+		state = &faultAlarmState{raisedTime: eventTime}
+		f.alarms[m.AlarmId] = state
+	}
+	f.notificationId++
+	state.notificationId = f.notificationId
+
+	notificationType := NotifyNewAlarm
+	switch m.AlarmAction {
+	case alarm.AlarmActionUpdate:
+		notificationType = NotifyChangedAlarm
+		state.changedTime = eventTime
+	case alarm.AlarmActionClear:
+		notificationType = NotifyClearedAlarm
+		delete(f.alarms, m.AlarmId)
+	case AlarmActionAck:
+		notificationType = NotifyAckStateChanged
+		eventTime = time.Now().UnixNano()
+	}
+
+	n := FaultNotification{
+		Href:             fmt.Sprintf("%s/alarms/%d", faultMnSRoot, m.AlarmId),
+		NotificationType: notificationType,
+		EventTime:        faultTime(eventTime),
+		SystemDN:         "RIC",
+		AlarmRecord:      newAlarmRecord(m, state),
+	}
+	if notificationType == NotifyClearedAlarm {
+		n.PerceivedSeverity = string(alarm.SeverityCleared)
+		n.AlarmClearedTime = faultTime(eventTime)
+	}
+
+	body, err := json.Marshal(n)
+	if err != nil {
+		app.Logger.Error("Fault notification json.Marshal failed: %v", err)
+		return
+	}
+
+	for _, s := range f.subscriptions {
+		if !s.matches(notificationType) {
+			continue
+		}
+		select {
+		case f.posts <- faultPost{url: s.ConsumerReference, body: body}:
+		default:
+			app.Logger.Warn("Fault notification queue full, dropping %s of alarm (sp=%d id=%d)", notificationType, m.SpecificProblem, m.AlarmId)
+		}
+	}
+}
+
+// Close stops sending the notifications
+func (f *FaultMnS) Close() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if !f.closed {
+		f.closed = true
+		close(f.posts)
+	}
+}
+
+func (f *FaultMnS) run() {
+	for p := range f.posts {
+		resp, err := f.httpClient.Post(p.url, "application/json", bytes.NewReader(p.body))
+		if err != nil {
+			app.Logger.Info("Unable to post fault notification to '%s': %v", p.url, err)
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			app.Logger.Info("Unable to post fault notification to '%s': HttpError=%s", p.url, resp.Status)
+		}
+	}
+}
+
+func (s FaultSubscription) matches(notificationType string) bool {
+	if s.Filter == nil || len(s.Filter.NotificationTypes) == 0 {
+		return true
+	}
+	for _, t := range s.Filter.NotificationTypes {
+		if t == notificationType {
+			return true
+		}
+	}
+	return false
+}
+
+// AlarmRecord returns the alarm record of an active alarm
+func (f *FaultMnS) AlarmRecord(m AlarmNotification) AlarmRecord {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return newAlarmRecord(m, f.alarms[m.AlarmId])
+}
+
+// newAlarmRecord maps the alarm to the alarm record. The notification ID and the raised time are known only
+// for the alarms notified after the alarm manager has started.
+func newAlarmRecord(m AlarmNotification, state *faultAlarmState) AlarmRecord {
+	r := AlarmRecord{
+		AlarmId:           strconv.Itoa(m.AlarmId),
+		ObjectInstance:    m.ManagedObjectId,
+		AlarmRaisedTime:   faultTime(m.AlarmTime),
+		AlarmType:         faultAlarmType(m.EventType),
+		ProbableCause:     m.ProbableCause,
+		SpecificProblem:   strconv.Itoa(m.SpecificProblem),
+		PerceivedSeverity: faultSeverity(m.PerceivedSeverity),
+		TrendIndication:   string(m.TrendIndication),
+		AdditionalText:    m.AdditionalInfo,
+		AckState:          AckStateUnacknowledged,
+	}
+	if state != nil {
+		r.NotificationId = state.notificationId
+		r.AlarmRaisedTime = faultTime(state.raisedTime)
+		if state.changedTime != 0 {
+			r.AlarmChangedTime = faultTime(state.changedTime)
+		}
+	}
+	if r.ProbableCause == "" {
+		r.ProbableCause = m.AlarmText
+	}
+	if len(m.ProposedRepairActions) > 0 {
+		r.ProposedRepairActions = strings.Join(m.ProposedRepairActions, "; ")
+	}
+
+	r.AdditionalInformation = map[string]string{
+		"applicationId":   m.ApplicationId,
+		"identifyingInfo": m.IdentifyingInfo,
+	}
+	for k, v := range m.AdditionalAttributes {
+		r.AdditionalInformation[k] = v
+	}
+
+	if m.Ack != nil {
+		r.AckState = AckStateAcknowledged
+		r.AckUserId = m.Ack.User
+		r.AckTime = faultTime(m.Ack.Time)
+	}
+	return r
+}
+
+func faultTime(t int64) string {
+	return time.Unix(0, t).UTC().Format(time.RFC3339)
+}
+
+func faultSeverity(severity alarm.Severity) string {
+	switch severity {
+	case alarm.SeverityCritical, alarm.SeverityMajor, alarm.SeverityMinor, alarm.SeverityWarning, alarm.SeverityCleared:
+		return string(severity)
+	}
+	return "INDETERMINATE"
+}
+
+// faultAlarmType maps the event type of the alarm definition to the alarm type of ITU-T X.733
+func faultAlarmType(eventType string) string {
+	t := strings.ToLower(eventType)
+	switch {
+	case strings.Contains(t, "communication"):
+		return "COMMUNICATIONS_ALARM"
+	case strings.Contains(t, "equipment"):
+		return "EQUIPMENT_ALARM"
+	case strings.Contains(t, "environment"):
+		return "ENVIRONMENTAL_ALARM"
+	case strings.Contains(t, "quality"):
+		return "QUALITY_OF_SERVICE_ALARM"
+	case strings.Contains(t, "integrity"), strings.Contains(t, "security"):
+		return "INTEGRITY_VIOLATION"
+	}
+	return "PROCESSING_ERROR_ALARM"
+}
+
+func (a *AlarmManager) GetFaultAlarmList(w http.ResponseWriter, r *http.Request) {
+	ackState := AckState(r.URL.Query().Get("alarmAckState"))
+	if ackState != "" && ackState != AckStateAcknowledged && ackState != AckStateUnacknowledged {
+		a.respondWithError(w, http.StatusBadRequest, "Invalid alarmAckState")
+		return
+	}
+
+	a.mutex.Lock()
+	list := AlarmList{AlarmRecords: make(map[string]AlarmRecord)}
+	for _, m := range a.activeAlarms {
+		// Alarm is not shown before raise delay has elapsed
+		if m.AlarmDefinition.RaiseDelay > 0 {
+			continue
+		}
+		record := a.faultMnS.AlarmRecord(m)
+		if ackState == "" || record.AckState == ackState {
+			list.AlarmRecords[record.AlarmId] = record
+		}
+	}
+	a.mutex.Unlock()
+
+	list.NumOfAlarmRecords = len(list.AlarmRecords)
+	a.respondWithJSON(w, http.StatusOK, map[string]AlarmList{"alarmList": list})
+}
+
+func (a *AlarmManager) PatchFaultAlarm(w http.ResponseWriter, r *http.Request) {
+	alarmId, ok := a.alarmIdFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	if r.Body == nil {
+		a.respondWithError(w, http.StatusBadRequest, "No data in request body.")
+		return
+	}
+	defer r.Body.Close()
+
+	var patch AlarmRecordPatch
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		app.Logger.Error("PATCH - received alarm record is invalid - " + err.Error())
+		a.respondWithError(w, http.StatusBadRequest, "Invalid data in request body.")
+		return
+	}
+
+	found := false
+	switch {
+	case patch.PerceivedSeverity == string(alarm.SeverityCleared):
+		app.Logger.Info("Alarm (id=%d) cleared by %s/%s", alarmId, patch.ClearUserId, patch.ClearSystemId)
+		_, found = a.ClearAlarmById(alarmId)
+	case patch.AckState == AckStateAcknowledged && patch.AckUserId != "":
+		_, found = a.SetAlarmAck(alarmId, &alarm.AlarmAck{User: patch.AckUserId, Time: time.Now().UnixNano()})
+	case patch.AckState == AckStateUnacknowledged:
+		_, found = a.SetAlarmAck(alarmId, nil)
+	default:
+		a.respondWithError(w, http.StatusBadRequest, "Invalid alarm record modification.")
+		return
+	}
+
+	if !found {
+		a.respondWithError(w, http.StatusNotFound, "Non existent alarmId")
+		return
+	}
+	a.respondWithJSON(w, http.StatusNoContent, nil)
+}
+
+func (a *AlarmManager) CreateFaultSubscription(w http.ResponseWriter, r *http.Request) {
+	if r.Body == nil {
+		a.respondWithError(w, http.StatusBadRequest, "No data in request body.")
+		return
+	}
+	defer r.Body.Close()
+
+	var s FaultSubscription
+	if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+		a.respondWithError(w, http.StatusBadRequest, "Invalid data in request body.")
+		return
+	}
+	if u, err := url.Parse(s.ConsumerReference); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		a.respondWithError(w, http.StatusBadRequest, "Invalid consumerReference")
+		return
+	}
+
+	s = a.faultMnS.Subscribe(s)
+	app.Logger.Info("Fault supervision subscription %s created: %s", s.Id, s.ConsumerReference)
+	w.Header().Set("Location", faultMnSRoot+"/subscriptions/"+s.Id)
+	a.respondWithJSON(w, http.StatusCreated, s)
+}
+
+func (a *AlarmManager) GetFaultSubscriptions(w http.ResponseWriter, r *http.Request) {
+	a.respondWithJSON(w, http.StatusOK, a.faultMnS.Subscriptions())
+}
+
+func (a *AlarmManager) DeleteFaultSubscription(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["subscriptionId"]
+	if !a.faultMnS.Unsubscribe(id) {
+		a.respondWithError(w, http.StatusNotFound, "Non existent subscriptionId")
+		return
+	}
+	app.Logger.Info("Fault supervision subscription %s deleted", id)
+	a.respondWithJSON(w, http.StatusNoContent, nil)
+}
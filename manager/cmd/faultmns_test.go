@@ -0,0 +1,187 @@
+/*
+ *  Copyright (c) 2020 AT&T Intellectual Property.
+ *  Copyright (c) 2020 Nokia.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ * This source code is part of the near-RT RIC (RAN Intelligent Controller)
+ * platform project (RICP).
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/alarm-go.git/alarm"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+// newFaultConsumer returns a consumer recording the fault notifications sent to it
+func newFaultConsumer() *recordingServer {
+	return newRecordingServer(respondStatus(http.StatusNoContent))
+}
+
+func faultNotifications(c *recordingServer) []FaultNotification {
+	return decodeBodies[FaultNotification](c.received("POST"))
+}
+
+// isolateAlarmState empties the active alarms of the alarm manager shared by the tests, and returns a function
+// restoring the active alarms and alarm history, so that the tests counting them are not disturbed
+func isolateAlarmState() func() {
+	alarmManager.mutex.Lock()
+	defer alarmManager.mutex.Unlock()
+
+	activeAlarms := alarmManager.activeAlarms
+	alarmHistory := append([]AlarmNotification{}, alarmManager.alarmHistory...)
+	exceededActiveAlarmOn, exceededAlarmHistoryOn := alarmManager.exceededActiveAlarmOn, alarmManager.exceededAlarmHistoryOn
+	alarmManager.activeAlarms = make([]AlarmNotification, 0)
+
+	return func() {
+		alarmManager.mutex.Lock()
+		defer alarmManager.mutex.Unlock()
+
+		alarmManager.activeAlarms = activeAlarms
+		alarmManager.alarmHistory = alarmHistory
+		alarmManager.exceededActiveAlarmOn, alarmManager.exceededAlarmHistoryOn = exceededActiveAlarmOn, exceededAlarmHistoryOn
+	}
+}
+
+func TestFaultMnSNotifications(t *testing.T) {
+	c := newFaultConsumer()
+	defer c.close()
+	f := NewFaultMnS("")
+	defer f.Close()
+
+	all := f.Subscribe(FaultSubscription{ConsumerReference: c.url()})
+	f.Subscribe(FaultSubscription{ConsumerReference: c.url(), Filter: &FaultSubscriptionFilter{NotificationTypes: []string{NotifyClearedAlarm}}})
+	assert.Equal(t, "1", all.Id)
+	assert.Equal(t, 2, len(f.Subscriptions()))
+
+	raise := vesNotification(alarm.AlarmActionRaise, alarm.SeverityMajor)
+	f.Notify(raise)
+	f.Notify(vesNotification(alarm.AlarmActionUpdate, alarm.SeverityCritical))
+	f.Notify(vesNotification(alarm.AlarmActionClear, alarm.SeverityCritical))
+	assert.Eventually(t, func() bool { return len(faultNotifications(c)) == 4 }, 5*time.Second, 10*time.Millisecond)
+
+	count := map[string]int{}
+	for _, n := range faultNotifications(c) {
+		count[n.NotificationType]++
+		assert.Equal(t, "42", n.AlarmId)
+		assert.Equal(t, "my-pod", n.ObjectInstance)
+		assert.Equal(t, faultTime(raise.AlarmTime), n.AlarmRaisedTime)
+		if n.NotificationType == NotifyClearedAlarm {
+			assert.Equal(t, 3, n.NotificationId)
+			assert.Equal(t, "CLEARED", n.PerceivedSeverity)
+			assert.NotEmpty(t, n.AlarmClearedTime)
+		}
+	}
+	assert.Equal(t, map[string]int{NotifyNewAlarm: 1, NotifyChangedAlarm: 1, NotifyClearedAlarm: 2}, count)
+
+	assert.True(t, f.Unsubscribe(all.Id))
+	assert.False(t, f.Unsubscribe(all.Id))
+}
+
+func TestFaultMnSSubscriptionsPersisted(t *testing.T) {
+	file := FaultSubscriptionFile(filepath.Join(t.TempDir(), "alarminfo.json"))
+	f := NewFaultMnS(file)
+	first := f.Subscribe(FaultSubscription{ConsumerReference: "http://consumer-1/notifications"})
+	f.Subscribe(FaultSubscription{ConsumerReference: "http://consumer-2/notifications", Filter: &FaultSubscriptionFilter{NotificationTypes: []string{NotifyNewAlarm}}})
+	f.Subscribe(FaultSubscription{ConsumerReference: "http://consumer-3/notifications"})
+	assert.True(t, f.Unsubscribe(first.Id))
+	subs := f.Subscriptions()
+	f.Close()
+
+	// The subscriptions are restored after a restart, and the subscription IDs are not reused
+	f = NewFaultMnS(file)
+	defer f.Close()
+	assert.Equal(t, subs, f.Subscriptions())
+	assert.Equal(t, "4", f.Subscribe(FaultSubscription{ConsumerReference: "http://consumer-4/notifications"}).Id)
+
+	assert.Equal(t, "", FaultSubscriptionFile(""))
+}
+
+func TestFaultMnSRESTInterface(t *testing.T) {
+	c := newFaultConsumer()
+	defer c.close()
+
+	defer isolateAlarmState()()
+	a := alarmer.NewAlarm(alarm.E2_CONNECTION_PROBLEM, alarm.SeverityMajor, "Some App data", "eth 0 1")
+	alarmManager.ProcessAlarm(&AlarmNotification{AlarmMessage: alarmer.NewAlarmMessage(a, alarm.AlarmActionRaise)})
+	alarmId := strconv.Itoa(alarmManager.activeAlarms[0].AlarmId)
+
+	// Subscription
+	b, _ := json.Marshal(&FaultSubscription{ConsumerReference: c.url() + "/notifications"})
+	req, _ := http.NewRequest("POST", faultMnSRoot+"/subscriptions", bytes.NewBuffer(b))
+	rr := executeRequest(req, alarmManager.CreateFaultSubscription)
+	checkResponseCode(t, http.StatusCreated, rr.Code)
+	var s FaultSubscription
+	json.NewDecoder(rr.Body).Decode(&s)
+	assert.Equal(t, faultMnSRoot+"/subscriptions/"+s.Id, rr.Header().Get("Location"))
+
+	req, _ = http.NewRequest("POST", faultMnSRoot+"/subscriptions", bytes.NewBufferString(`{"consumerReference": "not a uri"}`))
+	checkResponseCode(t, http.StatusBadRequest, executeRequest(req, alarmManager.CreateFaultSubscription).Code)
+
+	// Alarm list
+	req, _ = http.NewRequest("GET", faultMnSRoot+"/alarms", nil)
+	rr = executeRequest(req, alarmManager.GetFaultAlarmList)
+	checkResponseCode(t, http.StatusOK, rr.Code)
+	var list map[string]AlarmList
+	json.NewDecoder(rr.Body).Decode(&list)
+	assert.Equal(t, 1, list["alarmList"].NumOfAlarmRecords)
+	record := list["alarmList"].AlarmRecords[alarmId]
+	assert.Equal(t, "my-pod", record.ObjectInstance)
+	assert.Equal(t, "MAJOR", record.PerceivedSeverity)
+	assert.Equal(t, "72004", record.SpecificProblem)
+	assert.Equal(t, AckStateUnacknowledged, record.AckState)
+
+	// Acknowledge
+	req, _ = http.NewRequest("PATCH", faultMnSRoot+"/alarms/"+alarmId, bytes.NewBufferString(`{"ackState": "ACKNOWLEDGED", "ackUserId": "operator"}`))
+	req = mux.SetURLVars(req, map[string]string{"alarmId": alarmId})
+	checkResponseCode(t, http.StatusNoContent, executeRequest(req, alarmManager.PatchFaultAlarm).Code)
+
+	req, _ = http.NewRequest("GET", faultMnSRoot+"/alarms?alarmAckState=ACKNOWLEDGED", nil)
+	rr = executeRequest(req, alarmManager.GetFaultAlarmList)
+	json.NewDecoder(rr.Body).Decode(&list)
+	assert.Equal(t, "operator", list["alarmList"].AlarmRecords[alarmId].AckUserId)
+
+	req, _ = http.NewRequest("PATCH", faultMnSRoot+"/alarms/"+alarmId, bytes.NewBufferString(`{"perceivedSeverity": "MINOR"}`))
+	req = mux.SetURLVars(req, map[string]string{"alarmId": alarmId})
+	checkResponseCode(t, http.StatusBadRequest, executeRequest(req, alarmManager.PatchFaultAlarm).Code)
+
+	// Clear
+	req, _ = http.NewRequest("PATCH", faultMnSRoot+"/alarms/"+alarmId, bytes.NewBufferString(`{"perceivedSeverity": "CLEARED", "clearUserId": "operator"}`))
+	req = mux.SetURLVars(req, map[string]string{"alarmId": alarmId})
+	checkResponseCode(t, http.StatusNoContent, executeRequest(req, alarmManager.PatchFaultAlarm).Code)
+	assert.Equal(t, 0, len(alarmManager.activeAlarms))
+
+	req, _ = http.NewRequest("PATCH", faultMnSRoot+"/alarms/"+alarmId, bytes.NewBufferString(`{"perceivedSeverity": "CLEARED", "clearUserId": "operator"}`))
+	req = mux.SetURLVars(req, map[string]string{"alarmId": alarmId})
+	checkResponseCode(t, http.StatusNotFound, executeRequest(req, alarmManager.PatchFaultAlarm).Code)
+
+	assert.Eventually(t, func() bool { return len(faultNotifications(c)) == 2 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, NotifyAckStateChanged, faultNotifications(c)[0].NotificationType)
+	assert.Equal(t, NotifyClearedAlarm, faultNotifications(c)[1].NotificationType)
+
+	req, _ = http.NewRequest("DELETE", faultMnSRoot+"/subscriptions/"+s.Id, nil)
+	req = mux.SetURLVars(req, map[string]string{"subscriptionId": s.Id})
+	checkResponseCode(t, http.StatusNoContent, executeRequest(req, alarmManager.DeleteFaultSubscription).Code)
+	checkResponseCode(t, http.StatusNotFound, executeRequest(req, alarmManager.DeleteFaultSubscription).Code)
+}
@@ -23,17 +23,18 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"os"
-	"strconv"
+	"reflect"
 	"strings"
+	"sync"
 	"time"
 
 	"gerrit.o-ran-sc.org/r/ric-plt/alarm-go.git/alarm"
 	app "gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/xapp"
-	clientruntime "github.com/go-openapi/runtime/client"
 	"github.com/go-openapi/strfmt"
 	"github.com/prometheus/alertmanager/api/v2/client"
 	"github.com/prometheus/alertmanager/api/v2/client/alert"
@@ -80,24 +81,48 @@ func (a *AlarmManager) StartTTLTimer(interval int) {
 func (a *AlarmManager) StartAlertTimer() {
 	tick := time.Tick(time.Duration(a.alertInterval) * time.Millisecond)
 	for range tick {
-		a.mutex.Lock()
+		// The FM alarms are pushed to the webhook receiver, polling Alert Manager is only a fallback
+		if a.reconcileDue() {
+			a.ProcessAlerts()
+		}
 
-		a.ProcessAlerts()
-		for _, m := range a.activeAlarms {
+		// The alerts are posted without the mutex held, so that a slow Alert Manager replica doesn't stall
+		// the alarm processing
+		for _, m := range a.AlarmsToReraise(time.Now()) {
 			app.Logger.Info("Re-raising alarm: %v", m)
-			a.PostAlert(a.GenerateAlertLabels(m.AlarmId, m.Alarm, AlertStatusActive, m.AlarmTime))
+			a.PostActiveAlert(&m)
 		}
-		a.mutex.Unlock()
 	}
 }
 
+// AlarmsToReraise returns the active alarms to be re-posted to Alert Manager. An alarm is not posted before
+// its raise delay has elapsed. The delay is checked against the raise time, as the RaiseDelay marker of an
+// alarm restored from the persistent volume is not reset by the raise goroutine.
+func (a *AlarmManager) AlarmsToReraise(now time.Time) []AlarmNotification {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	activeAlarms := make([]AlarmNotification, 0, len(a.activeAlarms))
+	for _, m := range a.activeAlarms {
+		delay := time.Duration(m.AlarmDefinition.RaiseDelay) * time.Second
+		if delay > 0 && now.UnixNano()-m.AlarmTime < delay.Nanoseconds() {
+			continue
+		}
+		activeAlarms = append(activeAlarms, m)
+	}
+	return activeAlarms
+}
+
 func (a *AlarmManager) Consume(rp *app.RMRParams) (err error) {
 	app.Logger.Info("Message received!")
 
-	defer app.Rmr.Free(rp.Mbuf)
+	// The message buffer is consumed by SendRts in case of a reply
+	defer func() { app.Rmr.Free(rp.Mbuf) }()
 	switch rp.Mtype {
 	case alarm.RIC_ALARM_UPDATE:
 		a.HandleAlarms(rp)
+	case alarm.RIC_ALARM_QUERY:
+		a.HandleAlarmQuery(rp)
 	default:
 		app.Logger.Info("Unknown Message Type '%d', discarding", rp.Mtype)
 	}
@@ -114,10 +139,70 @@ func (a *AlarmManager) HandleAlarms(rp *app.RMRParams) (*alert.PostAlertsOK, err
 	}
 	app.Logger.Info("newAlarm: %v", m)
 
-	return a.ProcessAlarm(&AlarmNotification{m, alarm.AlarmDefinition{}})
+	return a.ProcessAlarm(&AlarmNotification{AlarmMessage: m})
+}
+
+func (a *AlarmManager) HandleAlarmQuery(rp *app.RMRParams) error {
+	var filter alarm.AlarmFilter
+	app.Logger.Info("Received alarm query: %s", rp.Payload)
+	if len(rp.Payload) > 0 {
+		if err := json.Unmarshal(rp.Payload, &filter); err != nil {
+			app.Logger.Error("json.Unmarshal failed: %v", err)
+			return err
+		}
+	}
+
+	payload, err := json.Marshal(a.QueryActiveAlarms(filter))
+	if err != nil {
+		app.Logger.Error("json.Marshal failed: %v", err)
+		return err
+	}
+
+	// The reply must fit into the buffer allocated by the sender
+	if len(payload) > alarm.RIC_ALARM_QUERY_MAX_PAYLOAD {
+		app.Logger.Warn("Alarm query reply too big (%d bytes), truncated", len(payload))
+		payload, _ = json.Marshal(alarm.AlarmQueryResponse{Alarms: []alarm.AlarmMessage{}, Truncated: true})
+	}
+
+	rp.Mtype = alarm.RIC_ALARM_QUERY
+	rp.Payload = payload
+	rp.PayloadLen = len(payload)
+	ok := app.Rmr.SendRts(rp)
+	rp.Mbuf = nil
+	if !ok {
+		app.Logger.Error("Sending alarm query reply failed")
+		return fmt.Errorf("Sending alarm query reply failed")
+	}
+	return nil
+}
+
+// QueryActiveAlarms returns the active alarms matching the filter
+func (a *AlarmManager) QueryActiveAlarms(filter alarm.AlarmFilter) alarm.AlarmQueryResponse {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	resp := alarm.AlarmQueryResponse{Alarms: []alarm.AlarmMessage{}}
+	for _, m := range a.activeAlarms {
+		if filter.Match(m.Alarm) {
+			resp.Alarms = append(resp.Alarms, m.AlarmMessage)
+		}
+	}
+	return resp
 }
 
 func (a *AlarmManager) ProcessAlarm(m *AlarmNotification) (*alert.PostAlertsOK, error) {
+	// Clear all alarms raised by the sender
+	if m.AlarmAction == alarm.AlarmActionClearAll {
+		// The sender must be identified, otherwise the alarms of all applications would be cleared
+		if m.ManagedObjectId == "" || m.ApplicationId == "" {
+			app.Logger.Error("CLEARALL without managed object (%q) or application (%q), ignoring ...", m.ManagedObjectId, m.ApplicationId)
+			return nil, nil
+		}
+		filter := alarm.AlarmFilter{ManagedObjectId: m.ManagedObjectId, ApplicationId: m.ApplicationId}
+		a.ProcessClearAllAlarms(filter, m.AlarmTime)
+		return nil, nil
+	}
+
 	a.mutex.Lock()
 	alarmDef := &alarm.AlarmDefinition{}
 	var ok bool
@@ -136,8 +221,11 @@ func (a *AlarmManager) ProcessAlarm(m *AlarmNotification) (*alert.PostAlertsOK,
 			a.mutex.Unlock()
 			return nil, nil
 		} else {
-			// Remove duplicate with different severity
-			a.activeAlarms = a.RemoveAlarm(a.activeAlarms, idx, "active")
+			// Duplicate with different severity replaces the active alarm, which is cleared before the raise
+			replaced, cleared := a.ClearReplacedAlarm(idx, m.AlarmTime)
+			a.mutex.Unlock()
+			a.NotifyReplacedAlarm(&replaced, &cleared)
+			a.mutex.Lock()
 		}
 	}
 
@@ -146,8 +234,14 @@ func (a *AlarmManager) ProcessAlarm(m *AlarmNotification) (*alert.PostAlertsOK,
 		return a.ProcessClearAlarm(m, alarmDef, idx)
 	}
 
-	// New alarm -> update active alarms and post to Alert Manager
-	if m.AlarmAction == alarm.AlarmActionRaise {
+	// Update severity and additional info of an active alarm in place
+	if found && m.AlarmAction == alarm.AlarmActionUpdate {
+		return a.ProcessUpdateAlarm(m, idx)
+	}
+
+	// New alarm -> update active alarms and post to Alert Manager. Update of an alarm not active is handled as raise.
+	if m.AlarmAction == alarm.AlarmActionRaise || m.AlarmAction == alarm.AlarmActionUpdate {
+		m.AlarmAction = alarm.AlarmActionRaise
 		return a.ProcessRaiseAlarm(m, alarmDef)
 	}
 
@@ -172,6 +266,8 @@ func (a *AlarmManager) ProcessRaiseAlarm(m *AlarmNotification, alarmDef *alarm.A
 		if found {
 			// Alarm is not showed in active alarms or alarm history via CLI before RaiseDelay has elapsed, i.e the value is 0
 			a.activeAlarms[idx].AlarmDefinition.RaiseDelay = 0
+			// Severity may have been updated during delay
+			m.Alarm = a.activeAlarms[idx].Alarm
 			app.Logger.Debug("Raise after delay alarmDef.RaiseDelay = %v, AlarmNotification = %v", alarmDef.RaiseDelay, *m)
 			a.mutex.Unlock()
 		} else {
@@ -184,12 +280,13 @@ func (a *AlarmManager) ProcessRaiseAlarm(m *AlarmNotification, alarmDef *alarm.A
 	m.AlarmDefinition.RaiseDelay = 0
 	a.UpdateAlarmHistoryList(m)
 	a.WriteAlarmInfoToPersistentVolume()
+	a.NotifySinks(m)
 
 	// Send alarm notification to NOMA, if enabled
 	if app.Config.GetBool("controls.noma.enabled") {
 		return a.PostAlarm(m)
 	}
-	return a.PostAlert(a.GenerateAlertLabels(m.AlarmId, m.Alarm, AlertStatusActive, m.AlarmTime))
+	return a.PostActiveAlert(m)
 }
 
 func (a *AlarmManager) ProcessClearAlarm(m *AlarmNotification, alarmDef *alarm.AlarmDefinition, idx int) (*alert.PostAlertsOK, error) {
@@ -207,7 +304,8 @@ func (a *AlarmManager) ProcessClearAlarm(m *AlarmNotification, alarmDef *alarm.A
 			return nil, nil
 		}
 	}
-	a.UpdateAlarmFields(a.activeAlarms[idx].AlarmId, m)
+	active := a.activeAlarms[idx]
+	a.UpdateAlarmFields(active.AlarmId, m)
 	a.alarmHistory = append(a.alarmHistory, *m)
 	a.activeAlarms = a.RemoveAlarm(a.activeAlarms, idx, "active")
 	if (len(a.alarmHistory) >= a.maxAlarmHistory) && (a.exceededAlarmHistoryOn == false) {
@@ -225,11 +323,237 @@ func (a *AlarmManager) ProcessClearAlarm(m *AlarmNotification, alarmDef *alarm.A
 	a.WriteAlarmInfoToPersistentVolume()
 
 	a.mutex.Unlock()
-	if a.postClear && app.Config.GetBool("controls.noma.enabled") {
-		m.PerceivedSeverity = alarm.SeverityCleared
+
+	// Alarm cleared before raise delay has elapsed has not been notified
+	if active.AlarmDefinition.RaiseDelay > 0 {
+		return nil, nil
+	}
+
+	a.NotifySinks(m)
+	if app.Config.GetBool("controls.noma.enabled") {
+		if a.postClear {
+			m.PerceivedSeverity = alarm.SeverityCleared
+			return a.PostAlarm(m)
+		}
+		return nil, nil
+	}
+	return a.ResolveAlert(&active)
+}
+
+// ClearReplacedAlarm removes the active alarm replaced by a raise with different severity, and records its clear
+// in the alarm history. Returns the replaced alarm and its clear. Called with the mutex held.
+func (a *AlarmManager) ClearReplacedAlarm(idx int, alarmTime int64) (AlarmNotification, AlarmNotification) {
+	replaced := a.activeAlarms[idx]
+	a.activeAlarms = a.RemoveAlarm(a.activeAlarms, idx, "active")
+
+	cleared := replaced
+	cleared.AlarmAction = alarm.AlarmActionClear
+	cleared.AlarmTime = alarmTime
+	a.alarmHistory = append(a.alarmHistory, cleared)
+	if (len(a.alarmHistory) >= a.maxAlarmHistory) && (a.exceededAlarmHistoryOn == false) {
+		app.Logger.Warn("alarm history count exceeded maxAlarmHistory threshold")
+		a.exceededAlarmHistoryOn = a.GenerateThresholdAlarm(alarm.ALARM_HISTORY_EXCEED_MAX_THRESHOLD, "history")
+	}
+	return replaced, cleared
+}
+
+// NotifyReplacedAlarm notifies the sinks of the clear of a replaced alarm, and resolves its alert in Alert Manager,
+// so that the alarm with the old severity doesn't stay active northbound
+func (a *AlarmManager) NotifyReplacedAlarm(replaced, cleared *AlarmNotification) {
+	// Alarm replaced before raise delay has elapsed has not been notified
+	if replaced.AlarmDefinition.RaiseDelay > 0 {
+		return
+	}
+
+	a.NotifySinks(cleared)
+	if app.Config.GetBool("controls.noma.enabled") {
+		a.PostClearedAlarm(cleared)
+		return
+	}
+	a.ResolveAlert(replaced)
+}
+
+// ProcessUpdateAlarm changes the severity and additional info of an active alarm. The alarm keeps its
+// alarm ID, and the severity change is recorded in the alarm history.
+func (a *AlarmManager) ProcessUpdateAlarm(m *AlarmNotification, idx int) (*alert.PostAlertsOK, error) {
+	prev := a.activeAlarms[idx]
+	if reflect.DeepEqual(m.Alarm, prev.Alarm) {
+		app.Logger.Info("Alarm (sp=%d id=%d) not changed, suppressing update ...", m.SpecificProblem, prev.AlarmId)
+		a.mutex.Unlock()
+		return nil, nil
+	}
+
+	app.Logger.Info("Alarm (sp=%d id=%d) severity updated: %s -> %s", m.SpecificProblem, prev.AlarmId, prev.PerceivedSeverity, m.PerceivedSeverity)
+	a.UpdateAlarmFields(prev.AlarmId, m)
+	m.Ack = prev.Ack
+	// The active alarm keeps its raise time, the update time is recorded in the alarm history
+	a.activeAlarms[idx].Alarm = m.Alarm
+
+	// Raise delay still ongoing, the alarm is notified with the updated values once the delay has elapsed
+	if prev.AlarmDefinition.RaiseDelay > 0 {
+		a.mutex.Unlock()
+		return nil, nil
+	}
+
+	a.UpdateAlarmHistoryList(m)
+	a.WriteAlarmInfoToPersistentVolume()
+	updated := a.activeAlarms[idx]
+	a.mutex.Unlock()
+	a.NotifySinks(m)
+
+	if app.Config.GetBool("controls.noma.enabled") {
 		return a.PostAlarm(m)
 	}
-	return nil, nil
+
+	// Labels, e.g. severity, are the alert identity in Alert Manager, so the alert with the old labels is resolved
+	prevLabels, _ := a.GenerateAlertLabels(prev.AlarmId, prev.Alarm, AlertStatusActive, prev.AlarmTime)
+	amLabels, _ := a.GenerateAlertLabels(updated.AlarmId, updated.Alarm, AlertStatusActive, updated.AlarmTime)
+	if !reflect.DeepEqual(prevLabels, amLabels) {
+		a.ResolveAlert(&prev)
+	}
+	return a.PostActiveAlert(&updated)
+}
+
+// SetAlarmAck acknowledges the active alarm with the alarm ID given, or removes the acknowledgement if ack is nil.
+// The acknowledgement is forwarded to NOMA, if enabled, otherwise to Alert Manager.
+func (a *AlarmManager) SetAlarmAck(alarmId int, ack *alarm.AlarmAck) (AlarmNotification, bool) {
+	a.mutex.Lock()
+	idx := a.activeAlarmIndex(alarmId)
+	if idx < 0 {
+		a.mutex.Unlock()
+		return AlarmNotification{}, false
+	}
+
+	if ack != nil && ack.Time == 0 {
+		ack.Time = time.Now().UnixNano()
+	}
+	a.activeAlarms[idx].Ack = ack
+	m := a.activeAlarms[idx]
+	a.WriteAlarmInfoToPersistentVolume()
+	a.mutex.Unlock()
+	app.Logger.Info("Alarm (sp=%d id=%d) acknowledgement set to %+v", m.SpecificProblem, alarmId, ack)
+
+	// Alarm is not notified before raise delay has elapsed
+	if m.AlarmDefinition.RaiseDelay > 0 {
+		return m, true
+	}
+
+	n := m
+	n.AlarmAction = AlarmActionAck
+	a.NotifySinks(&n)
+
+	if app.Config.GetBool("controls.noma.enabled") {
+		a.PostAlarm(&m)
+	} else {
+		a.PostActiveAlert(&m)
+	}
+	return m, true
+}
+
+// ClearAlarmById clears the active alarm with the alarm ID given. The alarm is cleared at once, i.e. the clear
+// delay of the alarm definition is not applied.
+func (a *AlarmManager) ClearAlarmById(alarmId int) (AlarmNotification, bool) {
+	a.mutex.Lock()
+	idx := a.activeAlarmIndex(alarmId)
+	if idx < 0 {
+		a.mutex.Unlock()
+		return AlarmNotification{}, false
+	}
+
+	m := a.activeAlarms[idx]
+	m.AlarmAction = alarm.AlarmActionClear
+	m.AlarmTime = time.Now().UnixNano()
+	a.ProcessClearAlarm(&m, &alarm.AlarmDefinition{}, idx)
+	return m, true
+}
+
+// activeAlarmIndex returns the index of the alarm ID in the active alarms, or -1. Called with the mutex locked.
+func (a *AlarmManager) activeAlarmIndex(alarmId int) int {
+	for i, m := range a.activeAlarms {
+		if m.AlarmId == alarmId {
+			return i
+		}
+	}
+	return -1
+}
+
+// ProcessClearAllAlarms clears all active alarms matching the filter. The alarms are cleared at once,
+// i.e. the clear delays of the alarm definitions are not applied.
+func (a *AlarmManager) ProcessClearAllAlarms(filter alarm.AlarmFilter, alarmTime int64) []AlarmNotification {
+	if alarmTime == 0 {
+		alarmTime = time.Now().UnixNano()
+	}
+
+	a.mutex.Lock()
+	cleared := make([]AlarmNotification, 0)
+	remaining := make([]AlarmNotification, 0, len(a.activeAlarms))
+	for _, m := range a.activeAlarms {
+		if !a.IsFilterMatch(m.Alarm, filter) {
+			remaining = append(remaining, m)
+			continue
+		}
+		m.AlarmAction = alarm.AlarmActionClear
+		m.AlarmTime = alarmTime
+		a.alarmHistory = append(a.alarmHistory, m)
+		cleared = append(cleared, m)
+	}
+	a.activeAlarms = remaining
+	app.Logger.Info("ClearAll: %d alarms cleared with filter %+v", len(cleared), filter)
+
+	if (len(a.alarmHistory) >= a.maxAlarmHistory) && (a.exceededAlarmHistoryOn == false) {
+		app.Logger.Warn("alarm history count exceeded maxAlarmHistory threshold")
+		a.exceededAlarmHistoryOn = a.GenerateThresholdAlarm(alarm.ALARM_HISTORY_EXCEED_MAX_THRESHOLD, "history")
+	}
+
+	for _, m := range cleared {
+		if a.exceededActiveAlarmOn && m.Alarm.SpecificProblem == alarm.ACTIVE_ALARM_EXCEED_MAX_THRESHOLD {
+			a.exceededActiveAlarmOn = false
+		}
+		if a.exceededAlarmHistoryOn && m.Alarm.SpecificProblem == alarm.ALARM_HISTORY_EXCEED_MAX_THRESHOLD {
+			a.exceededAlarmHistoryOn = false
+		}
+	}
+	a.WriteAlarmInfoToPersistentVolume()
+	a.mutex.Unlock()
+
+	for i := range cleared {
+		// Alarm cleared before raise delay has elapsed has not been notified
+		if cleared[i].AlarmDefinition.RaiseDelay > 0 {
+			continue
+		}
+		a.NotifySinks(&cleared[i])
+		a.PostClearedAlarm(&cleared[i])
+	}
+	return cleared
+}
+
+// PostClearedAlarm sends the clear notification to NOMA, if enabled, otherwise resolves the alert in Alert Manager
+func (a *AlarmManager) PostClearedAlarm(m *AlarmNotification) (*alert.PostAlertsOK, error) {
+	if app.Config.GetBool("controls.noma.enabled") {
+		if !a.postClear {
+			return nil, nil
+		}
+		n := *m
+		n.PerceivedSeverity = alarm.SeverityCleared
+		return a.PostAlarm(&n)
+	}
+	return a.ResolveAlert(m)
+}
+
+// NotifySinks forwards the alarm notification to the configured northbound sinks, e.g. VES
+func (a *AlarmManager) NotifySinks(m *AlarmNotification) {
+	for _, s := range a.sinks {
+		s.Notify(*m)
+	}
+}
+
+// Close stops the northbound sinks when the alarm manager shuts down. The ongoing posts are cancelled, the queued
+// VES events are dropped and the queued webhook notifications are moved to the dead-letter queue.
+func (a *AlarmManager) Close() {
+	app.Logger.Info("Alarm manager shutting down, closing %d alarm sinks", len(a.sinks))
+	for _, s := range a.sinks {
+		s.Close()
+	}
 }
 
 func timerDelay(delay int) {
@@ -247,6 +571,10 @@ func (a *AlarmManager) IsMatchFound(newAlarm alarm.Alarm) (int, bool) {
 	return -1, false
 }
 
+func (a *AlarmManager) IsFilterMatch(m alarm.Alarm, filter alarm.AlarmFilter) bool {
+	return filter.Match(m)
+}
+
 func (a *AlarmManager) RemoveAlarm(alarms []AlarmNotification, i int, listName string) []AlarmNotification {
 	app.Logger.Info("Alarm '%+v' deleted from the '%s' list", alarms[i], listName)
 	copy(alarms[i:], alarms[i+1:])
@@ -275,8 +603,8 @@ func (a *AlarmManager) GenerateThresholdAlarm(sp int, data string) bool {
 	alarmDef := alarm.RICAlarmDefinitions[sp]
 	alarmId := a.GenerateAlarmId()
 	alarmDef.AlarmId = alarmId
-	a.activeAlarms = append(a.activeAlarms, AlarmNotification{thresholdMessage, *alarmDef})
-	a.alarmHistory = append(a.alarmHistory, AlarmNotification{thresholdMessage, *alarmDef})
+	a.activeAlarms = append(a.activeAlarms, AlarmNotification{AlarmMessage: thresholdMessage, AlarmDefinition: *alarmDef})
+	a.alarmHistory = append(a.alarmHistory, AlarmNotification{AlarmMessage: thresholdMessage, AlarmDefinition: *alarmDef})
 
 	return true
 }
@@ -318,19 +646,26 @@ func (a *AlarmManager) PostAlarm(m *AlarmNotification) (*alert.PostAlertsOK, err
 	app.Logger.Info("Posting alarm to '%s'", fullUrl)
 
 	resp, err := http.Post(fullUrl, "application/json", bytes.NewReader(result))
-	if err != nil || resp == nil {
+	if err != nil {
 		app.Logger.Info("Unable to post alarm to '%s': %v", fullUrl, err)
+		return nil, err
 	}
+	defer resp.Body.Close()
 
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		err = fmt.Errorf("HttpError=%s", resp.Status)
+		app.Logger.Info("Unable to post alarm to '%s': %v", fullUrl, err)
+	}
 	return nil, err
 }
 
 func (a *AlarmManager) GenerateAlertLabels(alarmId int, newAlarm alarm.Alarm, status AlertStatus, alarmTime int64) (models.LabelSet, models.LabelSet) {
-	if strings.Contains(newAlarm.ApplicationId, "FM") {
+	if a.IsFMAlarm(newAlarm) {
 		app.Logger.Info("Alarm '%d' is originated from FM, ignoring ...", alarmId)
 		return models.LabelSet{}, models.LabelSet{}
 	}
 
+	mapping := a.AlertMapping()
 	alarmDef := alarm.RICAlarmDefinitions[newAlarm.SpecificProblem]
 	amLabels := models.LabelSet{
 		"status":      string(status),
@@ -349,46 +684,142 @@ func (a *AlarmManager) GenerateAlertLabels(alarmId int, newAlarm alarm.Alarm, st
 		"description":      fmt.Sprintf("%s:%s", newAlarm.IdentifyingInfo, newAlarm.AdditionalInfo),
 		"summary":          newAlarm.IdentifyingInfo,
 		"instructions":     alarmDef.OperationInstructions,
-		"timestamp":        fmt.Sprintf("%s", time.Unix(0, alarmTime).Format("02/01/2006, 15:04:05")),
+		"timestamp":        mapping.FormatTime(alarmTime),
+	}
+
+	// Optional ITU-T X.733 attributes and structured additional info
+	if newAlarm.ProbableCause != "" {
+		amLabels["probable_cause"] = newAlarm.ProbableCause
+	}
+	if len(newAlarm.ProposedRepairActions) > 0 {
+		amAnnotations["proposed_repair_actions"] = strings.Join(newAlarm.ProposedRepairActions, "; ")
+	}
+	if newAlarm.TrendIndication != "" {
+		amAnnotations["trend_indication"] = string(newAlarm.TrendIndication)
+	}
+	if t := newAlarm.ThresholdInfo; t != nil {
+		amAnnotations["threshold_info"] = fmt.Sprintf("%s: observed %v, threshold %v", t.TriggeredThreshold, t.ObservedValue, t.ThresholdLevel)
 	}
+	if len(newAlarm.CorrelatedNotifications) > 0 {
+		correlated, _ := json.Marshal(newAlarm.CorrelatedNotifications)
+		amAnnotations["correlated_notifications"] = string(correlated)
+	}
+	for k, v := range newAlarm.AdditionalAttributes {
+		amAnnotations["attr_"+annotationName(k)] = v
+	}
+
+	mapping.Apply(alertTemplateData(alarmId, newAlarm, status, alarmTime), amLabels, amAnnotations)
+	return amLabels, amAnnotations
+}
 
+// GenerateNotificationAlertLabels returns the alert labels and annotations of an active alarm, including the acknowledgement
+func (a *AlarmManager) GenerateNotificationAlertLabels(m *AlarmNotification, status AlertStatus) (models.LabelSet, models.LabelSet) {
+	amLabels, amAnnotations := a.GenerateAlertLabels(m.AlarmId, m.Alarm, status, m.AlarmTime)
+	if m.Ack != nil && len(amAnnotations) > 0 {
+		amAnnotations["ack_user"] = m.Ack.User
+		amAnnotations["ack_time"] = a.AlertMapping().FormatTime(m.Ack.Time)
+		amAnnotations["ack_comment"] = m.Ack.Comment
+	}
 	return amLabels, amAnnotations
 }
 
-func (a *AlarmManager) NewAlertmanagerClient() *client.AlertmanagerAPI {
-	cr := clientruntime.New(a.amHost, a.amBaseUrl, a.amSchemes)
-	return client.New(cr, strfmt.Default)
+// annotationName replaces the characters not allowed in Alert Manager label and annotation names
+func annotationName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' {
+			return r
+		}
+		return '_'
+	}, name)
 }
 
 func (a *AlarmManager) PostAlert(amLabels, amAnnotations models.LabelSet) (*alert.PostAlertsOK, error) {
+	return a.postAlert(amLabels, amAnnotations, DefaultAlertGeneratorUrl, strfmt.DateTime{}, strfmt.DateTime{})
+}
+
+// PostActiveAlert posts the alert of an active alarm with startsAt set to the alarm time
+func (a *AlarmManager) PostActiveAlert(m *AlarmNotification) (*alert.PostAlertsOK, error) {
+	amLabels, amAnnotations := a.GenerateNotificationAlertLabels(m, AlertStatusActive)
+	return a.postAlert(amLabels, amAnnotations, a.generatorURL(m), alertTime(m.AlarmTime), strfmt.DateTime{})
+}
+
+// ResolveAlert posts the alert of a cleared alarm with endsAt set to current time, i.e. the alert is resolved
+// in Alert Manager at once. The labels are the ones of the active alarm, since they are the alert identity.
+func (a *AlarmManager) ResolveAlert(m *AlarmNotification) (*alert.PostAlertsOK, error) {
+	amLabels, amAnnotations := a.GenerateNotificationAlertLabels(m, AlertStatusActive)
+	return a.postAlert(amLabels, amAnnotations, a.generatorURL(m), alertTime(m.AlarmTime), strfmt.DateTime(time.Now()))
+}
+
+// alertTime converts the alarm time to the alert time. Zero alarm time is left for Alert Manager to set.
+func alertTime(alarmTime int64) strfmt.DateTime {
+	if alarmTime == 0 {
+		return strfmt.DateTime{}
+	}
+	return strfmt.DateTime(time.Unix(0, alarmTime))
+}
+
+// generatorURL returns the generator URL of the alert of the alarm given by the alert mapping
+func (a *AlarmManager) generatorURL(m *AlarmNotification) string {
+	return a.AlertMapping().GeneratorURL(alertTemplateData(m.AlarmId, m.Alarm, AlertStatusActive, m.AlarmTime))
+}
+
+func (a *AlarmManager) postAlert(amLabels, amAnnotations models.LabelSet, generatorUrl string, startsAt, endsAt strfmt.DateTime) (*alert.PostAlertsOK, error) {
 	if len(amLabels) == 0 || len(amAnnotations) == 0 {
 		return &alert.PostAlertsOK{}, nil
 	}
 
 	pa := &models.PostableAlert{
 		Alert: models.Alert{
-			GeneratorURL: strfmt.URI("http://service-ricplt-alarmmanager-http.ricplt:8080/ric/v1/alarms"),
+			GeneratorURL: strfmt.URI(generatorUrl),
 			Labels:       amLabels,
 		},
 		Annotations: amAnnotations,
+		StartsAt:    startsAt,
+		EndsAt:      endsAt,
 	}
-	alertParams := alert.NewPostAlertsParams().WithAlerts(models.PostableAlerts{pa})
+	alerts := models.PostableAlerts{pa}
 
+	// Alerts are posted to every Alert Manager replica, the post succeeds if any of the replicas got the alerts
 	app.Logger.Info("Posting alerts: labels: %+v, annotations: %+v", amLabels, amAnnotations)
-	ok, err := a.NewAlertmanagerClient().Alert.PostAlerts(alertParams)
-	if err != nil {
-		app.Logger.Error("Posting alerts to '%s/%s' failed: %v", a.amHost, a.amBaseUrl, err)
+	hosts := a.alertmanagerHosts()
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("no Alert Manager configured")
+	}
+	results := make([]*alert.PostAlertsOK, len(hosts))
+	errs := make([]error, len(hosts))
+	var wg sync.WaitGroup
+	for i, host := range hosts {
+		wg.Add(1)
+		go func(i int, host string) {
+			defer wg.Done()
+			results[i], errs[i] = a.NewAlertmanagerClient(host).Alert.PostAlerts(alert.NewPostAlertsParams().WithAlerts(alerts))
+			a.updateAlertmanagerHealth(host, errs[i])
+			if errs[i] != nil {
+				app.Logger.Error("Posting alerts to '%s/%s' failed: %v", host, a.amBaseUrl, errs[i])
+			}
+		}(i, host)
+	}
+	wg.Wait()
+
+	for i := range hosts {
+		if errs[i] == nil {
+			return results[i], nil
+		}
 	}
-	return ok, err
+	return nil, errors.Join(errs...)
 }
 
 func (a *AlarmManager) GetAlerts() (*alert.GetAlertsOK, error) {
 	active := true
-	alertParams := alert.NewGetAlertsParams()
-	alertParams.Active = &active
-	resp, err := a.NewAlertmanagerClient().Alert.GetAlerts(alertParams)
+	var resp *alert.GetAlertsOK
+	err := a.withAlertmanager(func(c *client.AlertmanagerAPI) (err error) {
+		alertParams := alert.NewGetAlertsParams()
+		alertParams.Active = &active
+		resp, err = c.Alert.GetAlerts(alertParams)
+		return err
+	})
 	if err != nil {
-		app.Logger.Error("Getting alerts from '%s/%s' failed: %v", a.amHost, a.amBaseUrl, err)
+		app.Logger.Error("Getting alerts from Alert Manager failed: %v", err)
 		return resp, nil
 	}
 	app.Logger.Info("GetAlerts: %+v", resp)
@@ -396,72 +827,6 @@ func (a *AlarmManager) GetAlerts() (*alert.GetAlertsOK, error) {
 	return resp, err
 }
 
-func (a *AlarmManager) ProcessAlerts() {
-	resp, err := a.GetAlerts()
-	if err != nil || resp == nil {
-		app.Logger.Error("Getting alerts from '%s/%s' failed: %v", a.amHost, a.amBaseUrl, err)
-		return
-	}
-
-	var buildAlarm = func(alert *models.GettableAlert) alarm.Alarm {
-		a := alarm.Alarm{ManagedObjectId: "SEP", ApplicationId: "FM"}
-
-		if v, ok := alert.Alert.Labels["specific_problem"]; ok {
-			sp, _ := strconv.Atoi(v)
-			a.SpecificProblem = sp
-		}
-
-		if v, ok := alert.Alert.Labels["severity"]; ok {
-			a.PerceivedSeverity = alarm.Severity(fmt.Sprint(v))
-		}
-
-		if v, ok := alert.Alert.Labels["name"]; ok {
-			a.AdditionalInfo = v
-		}
-
-		if v, ok := alert.Annotations["description"]; ok {
-			a.IdentifyingInfo = v
-		}
-
-		return a
-	}
-
-	// Remove cleared alerts first
-	for _, m := range a.activeAlarms {
-		if m.ApplicationId != "FM" {
-			continue
-		}
-
-		found := false
-		for _, alert := range resp.Payload {
-			v, ok := alert.Alert.Labels["service"]
-			if !ok || !strings.Contains(v, "FM") {
-				continue
-			}
-
-			a := buildAlarm(alert)
-			if m.ManagedObjectId == a.ManagedObjectId && m.ApplicationId == a.ApplicationId &&
-				m.SpecificProblem == a.SpecificProblem && m.IdentifyingInfo == a.IdentifyingInfo {
-				found = true
-				break
-			}
-		}
-
-		if !found {
-			m.AlarmAction = alarm.AlarmActionClear
-			go a.ProcessAlarm(&m)
-		}
-	}
-
-	for _, alert := range resp.Payload {
-		v, ok := alert.Alert.Labels["service"]
-		if ok && strings.Contains(v, "FM") {
-			m := alarm.AlarmMessage{Alarm: buildAlarm(alert), AlarmAction: alarm.AlarmActionRaise, AlarmTime: time.Now().UnixNano()}
-			go a.ProcessAlarm(&AlarmNotification{m, alarm.AlarmDefinition{}})
-		}
-	}
-}
-
 func (a *AlarmManager) StatusCB() bool {
 	if !a.rmrReady {
 		app.Logger.Info("RMR not ready yet!")
@@ -481,12 +846,14 @@ func (a *AlarmManager) ConfigChangeCB(configparam string) {
 	}
 
 	a.alertInterval = viper.GetInt("controls.promAlertManager.alertInterval")
-	a.amHost = viper.GetString("controls.promAlertManager.address")
+	a.SetAlertmanagerHosts(ReadAlertmanagerHosts())
+	a.alertMapping.Store(ReadAlertMapping())
+	a.alertReceiver.Store(ReadAlertReceiverConfig())
 
 	app.Logger.Debug("ConfigChangeCB: maxActiveAlarms %v", a.maxActiveAlarms)
 	app.Logger.Debug("ConfigChangeCB: maxAlarmHistory = %v", a.maxAlarmHistory)
 	app.Logger.Debug("ConfigChangeCB: alertInterval %v", a.alertInterval)
-	app.Logger.Debug("ConfigChangeCB: amHost = %v", a.amHost)
+	app.Logger.Debug("ConfigChangeCB: Alert Manager hosts = %v", a.alertmanagerHosts())
 
 	return
 }
@@ -568,6 +935,7 @@ func (a *AlarmManager) Run(sdlcheck bool, ttlInterval int) {
 	app.SetReadyCB(func(d interface{}) { a.rmrReady = true }, true)
 	app.Resource.InjectStatusCb(a.StatusCB)
 	app.AddConfigChangeListener(a.ConfigChangeCB)
+	app.SetShutdownCB(a.Close)
 
 	alarm.RICAlarmDefinitions = make(map[int]*alarm.AlarmDefinition)
 	a.ReadAlarmDefinitionFromJson()
@@ -591,8 +959,9 @@ func NewAlarmManager(amHost string, alertInterval int, clearAlarm bool) *AlarmMa
 		alertInterval = viper.GetInt("controls.promAlertManager.alertInterval")
 	}
 
-	if amHost == "" {
-		amHost = viper.GetString("controls.promAlertManager.address")
+	amHosts := SplitAlertmanagerHosts(amHost)
+	if len(amHosts) == 0 {
+		amHosts = ReadAlertmanagerHosts()
 	}
 
 	maxActiveAlarms := app.Config.GetInt("controls.maxActiveAlarms")
@@ -605,10 +974,33 @@ func NewAlarmManager(amHost string, alertInterval int, clearAlarm bool) *AlarmMa
 		maxAlarmHistory = 20000
 	}
 
-	return &AlarmManager{
+	alarmInfoPvFile := app.Config.GetString("controls.alarmInfoPvFile")
+	faultMnS := NewFaultMnS(FaultSubscriptionFile(alarmInfoPvFile))
+	sinks := []AlarmSink{faultMnS}
+	if cfg, ok := ReadVesConfig(); ok {
+		sinks = append(sinks, NewVesSink(cfg))
+	}
+	if cfg, ok := ReadSnmpConfig(alarmInfoPvFile); ok {
+		if s, err := NewSnmpSink(cfg); err == nil {
+			sinks = append(sinks, s)
+		} else {
+			app.Logger.Error("SNMP trap sink not started: %v", err)
+		}
+	}
+
+	webhooks := make([]*WebhookSink, 0)
+	for _, cfg := range ReadWebhookConfigs(alarmInfoPvFile) {
+		if s, err := NewWebhookSink(cfg); err == nil {
+			webhooks = append(webhooks, s)
+			sinks = append(sinks, s)
+		} else {
+			app.Logger.Error("Webhook sink not started: %v", err)
+		}
+	}
+
+	a := &AlarmManager{
 		rmrReady:               false,
 		postClear:              clearAlarm,
-		amHost:                 amHost,
 		amBaseUrl:              app.Config.GetString("controls.promAlertManager.baseUrl"),
 		amSchemes:              []string{app.Config.GetString("controls.promAlertManager.schemes")},
 		alertInterval:          alertInterval,
@@ -619,8 +1011,16 @@ func NewAlarmManager(amHost string, alertInterval int, clearAlarm bool) *AlarmMa
 		maxAlarmHistory:        maxAlarmHistory,
 		exceededActiveAlarmOn:  false,
 		exceededAlarmHistoryOn: false,
-		alarmInfoPvFile:        app.Config.GetString("controls.alarmInfoPvFile"),
+		alarmInfoPvFile:        alarmInfoPvFile,
+		instanceId:             fmt.Sprintf("%d", time.Now().UnixNano()),
+		sinks:                  sinks,
+		faultMnS:               faultMnS,
+		webhooks:               webhooks,
 	}
+	a.SetAlertmanagerHosts(amHosts)
+	a.alertMapping.Store(ReadAlertMapping())
+	a.alertReceiver.Store(ReadAlertReceiverConfig())
+	return a
 }
 
 // Main function
@@ -59,7 +59,7 @@ func TestMain(M *testing.M) {
 		time.Sleep(time.Duration(1) * time.Second)
 	}
 
-	alarmer, _ = alarm.InitAlarm("my-pod", "my-app")
+	alarmer, _ = alarm.InitAlarm("my-pod", "my-app", alarm.WithRMREndpoint("127.0.0.1:4560"))
 	alarmManager.alarmClient = alarmer
 	time.Sleep(time.Duration(5) * time.Second)
 	eventChan = make(chan string)
@@ -293,6 +293,9 @@ func TestAlarmClearedSucess(t *testing.T) {
 	a = alarmer.NewAlarm(alarm.E2_CONNECTION_PROBLEM, alarm.SeverityCritical, "Some App data", "eth 0 1")
 	assert.Nil(t, alarmer.Clear(a), "clear failed")
 
+	// Alert is resolved in Alert Manager at once
+	VerifyResolvedAlert(t, waitForEvent())
+
 	time.Sleep(time.Duration(2) * time.Second)
 	//assert.Equal(t, len(alarmManager.activeAlarms), 0)
 }
@@ -329,6 +332,9 @@ func TestMultipleAlarmsClearedSucess(t *testing.T) {
 	b := alarmer.NewAlarm(alarm.ACTIVE_ALARM_EXCEED_MAX_THRESHOLD, alarm.SeverityMinor, "Hello", "abcd 11")
 	assert.Nil(t, alarmer.Clear(b), "clear failed")
 
+	VerifyResolvedAlert(t, waitForEvent())
+	VerifyResolvedAlert(t, waitForEvent())
+
 	time.Sleep(time.Duration(2) * time.Second)
 	assert.Equal(t, len(alarmManager.activeAlarms), 0)
 }
@@ -345,6 +351,7 @@ func TestAlarmsSuppresedSucess(t *testing.T) {
 
 	VerifyAlarm(t, a, 1)
 	assert.Nil(t, alarmer.Clear(a), "clear failed")
+	VerifyResolvedAlert(t, waitForEvent())
 }
 
 func TestInvalidAlarms(t *testing.T) {
@@ -457,6 +464,7 @@ func TestDelayedAlarmRaiseAndClear(t *testing.T) {
 
 	// Clear the alarm and check the alarm is removed. Posting alert clear and updating alarm history should be delayed
 	assert.Nil(t, alarmer.Clear(a), "clear failed")
+	VerifyResolvedAlert(t, waitForEvent())
 
 	time.Sleep(time.Duration(2) * time.Second)
 	assert.Equal(t, len(alarmManager.activeAlarms), activeAlarmsBeforeTest)
@@ -484,6 +492,8 @@ func TestDelayedAlarmRaiseAndClear2(t *testing.T) {
 	// Clear two alarms. The first should be delayed. Check the alarms are removed
 	assert.Nil(t, alarmer.Clear(a), "clear failed")
 	assert.Nil(t, alarmer.Clear(b), "clear failed")
+	VerifyResolvedAlert(t, waitForEvent())
+	VerifyResolvedAlert(t, waitForEvent())
 
 	time.Sleep(time.Duration(2) * time.Second)
 	assert.Equal(t, len(alarmManager.activeAlarms), activeAlarmsBeforeTest)
@@ -542,6 +552,8 @@ func TestDelayedAlarmRaiseAndClear3(t *testing.T) {
 	// Clear two alarms. The first should be delayed. Check the alarms are removed
 	assert.Nil(t, alarmer.Clear(a), "clear failed")
 	assert.Nil(t, alarmer.Clear(b), "clear failed")
+	VerifyResolvedAlert(t, waitForEvent())
+	VerifyResolvedAlert(t, waitForEvent())
 
 	time.Sleep(time.Duration(2) * time.Second)
 	assert.Equal(t, len(alarmManager.activeAlarms), activeAlarmsBeforeTest)
@@ -557,7 +569,7 @@ func TestClearExpiredAlarms(t *testing.T) {
 		AlarmTime:   time.Now().UnixNano(),
 	}
 	d := alarm.RICAlarmDefinitions[72004]
-	n := AlarmNotification{a, *d}
+	n := AlarmNotification{AlarmMessage: a, AlarmDefinition: *d}
 	alarmManager.activeAlarms = make([]AlarmNotification, 0)
 	alarmManager.UpdateActiveAlarmList(&n)
 
@@ -581,6 +593,231 @@ func TestClearExpiredAlarms(t *testing.T) {
 	assert.Equal(t, len(alarmManager.activeAlarms), 0)
 }
 
+func TestClearAllAlarms(t *testing.T) {
+	xapp.Logger.Info("TestClearAllAlarms")
+	alarmManager.activeAlarms = make([]AlarmNotification, 0)
+	alarmHistoryBeforeTest := len(alarmManager.alarmHistory)
+
+	// Raise two alarms from the application and one from some other application
+	a := alarmer.NewAlarm(alarm.E2_CONNECTION_PROBLEM, alarm.SeverityMajor, "Some App data", "eth 0 1")
+	b := alarmer.NewAlarm(alarm.ACTIVE_ALARM_EXCEED_MAX_THRESHOLD, alarm.SeverityMinor, "Hello", "abcd 11")
+	c := alarmer.NewAlarm(alarm.E2_CONNECTION_PROBLEM, alarm.SeverityMajor, "Some App data", "eth 0 1")
+	c.ApplicationId = "other-app"
+	for _, n := range []alarm.Alarm{a, b, c} {
+		m := alarmer.NewAlarmMessage(n, alarm.AlarmActionRaise)
+		alarmManager.ProcessAlarm(&AlarmNotification{AlarmMessage: m})
+	}
+	assert.Equal(t, 3, len(alarmManager.activeAlarms))
+
+	// Clear all without managed object or application is ignored
+	for _, n := range []alarm.Alarm{{ApplicationId: "my-app"}, {ManagedObjectId: "my-pod"}, {}} {
+		m := alarmer.NewAlarmMessage(n, alarm.AlarmActionClearAll)
+		alarmManager.ProcessAlarm(&AlarmNotification{AlarmMessage: m})
+	}
+	assert.Equal(t, 3, len(alarmManager.activeAlarms))
+	assert.Equal(t, alarmHistoryBeforeTest+3, len(alarmManager.alarmHistory))
+
+	// Clear all alarms of the application, the alarm of the other application stays active
+	m := alarmer.NewAlarmMessage(alarmer.NewAlarm(0, alarm.SeverityDefault, "", ""), alarm.AlarmActionClearAll)
+	alarmManager.ProcessAlarm(&AlarmNotification{AlarmMessage: m})
+
+	assert.Equal(t, 1, len(alarmManager.activeAlarms))
+	_, ok := alarmManager.IsMatchFound(c)
+	assert.True(t, ok)
+	assert.Equal(t, alarmHistoryBeforeTest+5, len(alarmManager.alarmHistory))
+	assert.Equal(t, alarm.AlarmActionClear, alarmManager.alarmHistory[len(alarmManager.alarmHistory)-1].AlarmAction)
+
+	// Clear with severity filter
+	cleared := alarmManager.ProcessClearAllAlarms(alarm.AlarmFilter{PerceivedSeverity: alarm.SeverityMajor}, 0)
+	assert.Equal(t, 1, len(cleared))
+	assert.Equal(t, 0, len(alarmManager.activeAlarms))
+}
+
+func TestUpdateAlarmSeverity(t *testing.T) {
+	xapp.Logger.Info("TestUpdateAlarmSeverity")
+	ts := CreatePromAlertSimulator(t, "POST", "/api/v2/alerts", http.StatusOK, models.LabelSet{})
+	defer ts.Close()
+	alarmManager.activeAlarms = make([]AlarmNotification, 0)
+	alarmHistoryBeforeTest := len(alarmManager.alarmHistory)
+
+	// Alarms are processed synchronously, so the alerts posted are collected in the background
+	events := collectEvents(4)
+
+	a := alarmer.NewAlarm(alarm.E2_CONNECTION_PROBLEM, alarm.SeverityMajor, "Some App data", "eth 0 1")
+	m := alarmer.NewAlarmMessage(a, alarm.AlarmActionRaise)
+	alarmManager.ProcessAlarm(&AlarmNotification{AlarmMessage: m})
+	assert.Equal(t, 1, len(alarmManager.activeAlarms))
+	alarmId := alarmManager.activeAlarms[0].AlarmId
+	raiseTime := alarmManager.activeAlarms[0].AlarmTime
+
+	// Severity and additional info are changed in place, alarm ID and raise time stay the same
+	a.PerceivedSeverity = alarm.SeverityCritical
+	a.AdditionalInfo = "More App data"
+	m = alarmer.NewAlarmMessage(a, alarm.AlarmActionUpdate)
+	m.AlarmTime = raiseTime + 1e9
+	alarmManager.ProcessAlarm(&AlarmNotification{AlarmMessage: m})
+	assert.Equal(t, 1, len(alarmManager.activeAlarms))
+	assert.Equal(t, alarmId, alarmManager.activeAlarms[0].AlarmId)
+	assert.Equal(t, raiseTime, alarmManager.activeAlarms[0].AlarmTime)
+	assert.Equal(t, alarm.SeverityCritical, alarmManager.activeAlarms[0].PerceivedSeverity)
+	assert.Equal(t, "More App data", alarmManager.activeAlarms[0].AdditionalInfo)
+
+	assert.Equal(t, alarmHistoryBeforeTest+2, len(alarmManager.alarmHistory))
+	last := alarmManager.alarmHistory[len(alarmManager.alarmHistory)-1]
+	assert.Equal(t, alarm.AlarmActionUpdate, last.AlarmAction)
+	assert.Equal(t, alarmId, last.AlarmId)
+	assert.Equal(t, raiseTime+1e9, last.AlarmTime)
+
+	// Unchanged update is suppressed
+	alarmManager.ProcessAlarm(&AlarmNotification{AlarmMessage: m})
+	assert.Equal(t, alarmHistoryBeforeTest+2, len(alarmManager.alarmHistory))
+
+	// Update of an alarm not active raises it
+	b := alarmer.NewAlarm(alarm.E2_CONNECTION_PROBLEM, alarm.SeverityMinor, "Some App data", "eth 0 2")
+	m = alarmer.NewAlarmMessage(b, alarm.AlarmActionUpdate)
+	alarmManager.ProcessAlarm(&AlarmNotification{AlarmMessage: m})
+	assert.Equal(t, 2, len(alarmManager.activeAlarms))
+	assert.Equal(t, alarm.AlarmActionRaise, alarmManager.activeAlarms[1].AlarmAction)
+	alarmManager.activeAlarms = make([]AlarmNotification, 0)
+
+	// The alert with the old severity is resolved and the one with the new severity posted
+	VerifyActiveAlert(t, <-events)
+	resolved := VerifyResolvedAlert(t, <-events)
+	assert.Equal(t, string(alarm.SeverityMajor), resolved.Labels["severity"])
+	raised := VerifyActiveAlert(t, <-events)
+	assert.Equal(t, string(alarm.SeverityCritical), raised.Labels["severity"])
+	VerifyActiveAlert(t, <-events)
+}
+
+func TestAlarmsToReraise(t *testing.T) {
+	xapp.Logger.Info("TestAlarmsToReraise")
+	now := time.Now()
+
+	a := alarmer.NewAlarm(alarm.E2_CONNECTION_PROBLEM, alarm.SeverityMajor, "Some App data", "eth 0 1")
+	noDelay := AlarmNotification{AlarmMessage: alarmer.NewAlarmMessage(a, alarm.AlarmActionRaise)}
+	noDelay.AlarmTime = now.Add(-2 * time.Second).UnixNano()
+
+	// Raise delay elapsed, e.g. alarm restored from the persistent volume with the delay marker set
+	elapsed := noDelay
+	elapsed.Alarm.IdentifyingInfo = "eth 0 2"
+	elapsed.AlarmDefinition.RaiseDelay = 1
+
+	ongoing := elapsed
+	ongoing.Alarm.IdentifyingInfo = "eth 0 3"
+	ongoing.AlarmTime = now.UnixNano()
+
+	alarmManager.activeAlarms = []AlarmNotification{noDelay, elapsed, ongoing}
+	assert.Equal(t, []AlarmNotification{noDelay, elapsed}, alarmManager.AlarmsToReraise(now))
+	alarmManager.activeAlarms = make([]AlarmNotification, 0)
+}
+
+func TestRaiseAlarmWithNewSeverity(t *testing.T) {
+	xapp.Logger.Info("TestRaiseAlarmWithNewSeverity")
+	ts := CreatePromAlertSimulator(t, "POST", "/api/v2/alerts", http.StatusOK, models.LabelSet{})
+	defer ts.Close()
+	defer isolateAlarmState()()
+
+	c := newFaultConsumer()
+	defer c.close()
+	f := NewFaultMnS("")
+	defer f.Close()
+	f.Subscribe(FaultSubscription{ConsumerReference: c.url()})
+	sinks := alarmManager.sinks
+	alarmManager.sinks = []AlarmSink{f}
+	defer func() { alarmManager.sinks = sinks }()
+
+	events := collectEvents(3)
+	alarmHistoryBeforeTest := len(alarmManager.alarmHistory)
+
+	a := alarmer.NewAlarm(alarm.E2_CONNECTION_PROBLEM, alarm.SeverityMajor, "Some App data", "eth 0 1")
+	alarmManager.ProcessAlarm(&AlarmNotification{AlarmMessage: alarmer.NewAlarmMessage(a, alarm.AlarmActionRaise)})
+	alarmId := alarmManager.activeAlarms[0].AlarmId
+
+	// Raise with different severity clears the active alarm before raising the new one
+	a.PerceivedSeverity = alarm.SeverityCritical
+	alarmManager.ProcessAlarm(&AlarmNotification{AlarmMessage: alarmer.NewAlarmMessage(a, alarm.AlarmActionRaise)})
+	assert.Equal(t, 1, len(alarmManager.activeAlarms))
+	assert.Equal(t, alarm.SeverityCritical, alarmManager.activeAlarms[0].PerceivedSeverity)
+
+	history := alarmManager.alarmHistory[alarmHistoryBeforeTest:]
+	assert.Equal(t, 3, len(history))
+	assert.Equal(t, alarm.AlarmActionClear, history[1].AlarmAction)
+	assert.Equal(t, alarmId, history[1].AlarmId)
+	assert.Equal(t, alarm.SeverityMajor, history[1].PerceivedSeverity)
+	assert.Equal(t, alarm.AlarmActionRaise, history[2].AlarmAction)
+
+	// The alert with the old severity is resolved before the one with the new severity is posted
+	VerifyActiveAlert(t, <-events)
+	resolved := VerifyResolvedAlert(t, <-events)
+	assert.Equal(t, string(alarm.SeverityMajor), resolved.Labels["severity"])
+	raised := VerifyActiveAlert(t, <-events)
+	assert.Equal(t, string(alarm.SeverityCritical), raised.Labels["severity"])
+
+	// The sinks are notified of the clear of the replaced alarm
+	assert.Eventually(t, func() bool { return len(faultNotifications(c)) == 3 }, 5*time.Second, 10*time.Millisecond)
+	count := map[string]int{}
+	for _, n := range faultNotifications(c) {
+		count[n.NotificationType]++
+		if n.NotificationType == NotifyClearedAlarm {
+			assert.Equal(t, strconv.Itoa(alarmId), n.AlarmId)
+		}
+	}
+	assert.Equal(t, map[string]int{NotifyNewAlarm: 2, NotifyClearedAlarm: 1}, count)
+}
+
+func TestX733AlertLabels(t *testing.T) {
+	xapp.Logger.Info("TestX733AlertLabels")
+	a := alarmer.NewAlarm(alarm.E2_CONNECTION_PROBLEM, alarm.SeverityMajor, "Some App data", "eth 0 1")
+	a.AdditionalAttributes = map[string]string{"peer-address": "10.0.0.1"}
+	a.ProbableCause = "LOSS_OF_SIGNAL"
+	a.ProposedRepairActions = []string{"Check the cable", "Restart the link"}
+	a.TrendIndication = alarm.TrendMoreSevere
+	a.ThresholdInfo = &alarm.ThresholdInfo{TriggeredThreshold: "packetLoss", ObservedValue: 12.5, ThresholdLevel: 10}
+	a.CorrelatedNotifications = []alarm.CorrelatedNotification{{NotificationIds: []int{17}}}
+
+	amLabels, amAnnotations := alarmManager.GenerateAlertLabels(1, a, AlertStatusActive, time.Now().UnixNano())
+	assert.Equal(t, "LOSS_OF_SIGNAL", amLabels["probable_cause"])
+	assert.Equal(t, "Check the cable; Restart the link", amAnnotations["proposed_repair_actions"])
+	assert.Equal(t, "MORE_SEVERE", amAnnotations["trend_indication"])
+	assert.Equal(t, "packetLoss: observed 12.5, threshold 10", amAnnotations["threshold_info"])
+	assert.Equal(t, `[{"notificationIds":[17]}]`, amAnnotations["correlated_notifications"])
+	assert.Equal(t, "10.0.0.1", amAnnotations["attr_peer_address"])
+
+	// Alarms without the optional attributes don't get the labels
+	amLabels, amAnnotations = alarmManager.GenerateAlertLabels(1, alarmer.NewAlarm(alarm.E2_CONNECTION_PROBLEM, alarm.SeverityMajor, "", "eth 0 1"), AlertStatusActive, 0)
+	_, ok := amLabels["probable_cause"]
+	assert.False(t, ok)
+	_, ok = amAnnotations["trend_indication"]
+	assert.False(t, ok)
+}
+
+func TestAlarmQuery(t *testing.T) {
+	xapp.Logger.Info("TestAlarmQuery")
+	alarmManager.activeAlarms = make([]AlarmNotification, 0)
+
+	a := alarmer.NewAlarm(alarm.E2_CONNECTION_PROBLEM, alarm.SeverityMajor, "Some App data", "eth 0 1")
+	b := alarmer.NewAlarm(alarm.E2_CONNECTION_PROBLEM, alarm.SeverityMajor, "Some App data", "eth 0 2")
+	b.ApplicationId = "other-app"
+	for _, n := range []alarm.Alarm{a, b} {
+		m := alarmer.NewAlarmMessage(n, alarm.AlarmActionRaise)
+		alarmManager.ProcessAlarm(&AlarmNotification{AlarmMessage: m})
+	}
+
+	resp := alarmManager.QueryActiveAlarms(alarm.AlarmFilter{ApplicationId: a.ApplicationId})
+	assert.Equal(t, 1, len(resp.Alarms))
+	assert.Equal(t, a, resp.Alarms[0].Alarm)
+	assert.False(t, resp.Truncated)
+	assert.Equal(t, 2, len(alarmManager.QueryActiveAlarms(alarm.AlarmFilter{}).Alarms))
+
+	// Consume replies to the sender with the matching alarms
+	payload, _ := json.Marshal(alarm.AlarmFilter{ApplicationId: a.ApplicationId})
+	err := alarmManager.Consume(&xapp.RMRParams{Mtype: alarm.RIC_ALARM_QUERY, Payload: payload, PayloadLen: len(payload)})
+	assert.Nil(t, err)
+
+	assert.NotNil(t, alarmManager.HandleAlarmQuery(&xapp.RMRParams{Mtype: alarm.RIC_ALARM_QUERY, Payload: []byte("{")}))
+	alarmManager.activeAlarms = make([]AlarmNotification, 0)
+}
+
 func TestSetAlarmConfig(t *testing.T) {
 	xapp.Logger.Info("TestSetAlarmConfig")
 
@@ -817,6 +1054,39 @@ func waitForEvent() string {
 	return receivedAlert
 }
 
+func collectEvents(n int) chan string {
+	events := make(chan string, n)
+	go func() {
+		for i := 0; i < n; i++ {
+			events <- waitForEvent()
+		}
+	}()
+	return events
+}
+
+func decodeAlert(t *testing.T, receivedAlert string) models.PostableAlert {
+	var alerts models.PostableAlerts
+	assert.Nil(t, json.Unmarshal([]byte(receivedAlert), &alerts))
+	if !assert.Equal(t, 1, len(alerts)) {
+		return models.PostableAlert{}
+	}
+	assert.False(t, time.Time(alerts[0].StartsAt).IsZero(), "startsAt not set")
+	return *alerts[0]
+}
+
+func VerifyActiveAlert(t *testing.T, receivedAlert string) models.PostableAlert {
+	pa := decodeAlert(t, receivedAlert)
+	assert.True(t, time.Time(pa.EndsAt).IsZero(), "endsAt set for active alert")
+	return pa
+}
+
+func VerifyResolvedAlert(t *testing.T, receivedAlert string) models.PostableAlert {
+	pa := decodeAlert(t, receivedAlert)
+	assert.False(t, time.Time(pa.EndsAt).IsZero(), "endsAt not set for resolved alert")
+	assert.False(t, time.Time(pa.EndsAt).Before(time.Time(pa.StartsAt)), "endsAt before startsAt")
+	return pa
+}
+
 func fireEvent(t *testing.T, body io.ReadCloser) {
 	reqBody, err := ioutil.ReadAll(body)
 	assert.Nil(t, err, "ioutil.ReadAll failed")
@@ -0,0 +1,140 @@
+/*
+ *  Copyright (c) 2020 AT&T Intellectual Property.
+ *  Copyright (c) 2020 Nokia.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ * This source code is part of the near-RT RIC (RAN Intelligent Controller)
+ * platform project (RICP).
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+)
+
+// recordedRequest is a request received by the recording server
+type recordedRequest struct {
+	Method string
+	Path   string
+	Header http.Header
+	Body   []byte
+}
+
+// recordingServer is a fake northbound HTTP server, e.g. a VES collector or an Alert Manager, recording the
+// requests it receives. The requests are answered by the responder, if given, otherwise with 200 OK.
+// While failing, the requests are answered with 503 Service Unavailable and not recorded.
+type recordingServer struct {
+	server   *httptest.Server
+	mutex    sync.Mutex
+	respond  func(w http.ResponseWriter, r recordedRequest)
+	requests []recordedRequest
+	fail     bool
+	failures int
+}
+
+func newRecordingServer(respond func(w http.ResponseWriter, r recordedRequest)) *recordingServer {
+	s := &recordingServer{respond: respond}
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		s.mutex.Lock()
+		if s.fail || s.failures > 0 {
+			if s.failures > 0 {
+				s.failures--
+			}
+			s.mutex.Unlock()
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		req := recordedRequest{Method: r.Method, Path: r.URL.Path, Header: r.Header, Body: body}
+		s.requests = append(s.requests, req)
+		s.mutex.Unlock()
+
+		if s.respond != nil {
+			s.respond(w, req)
+		}
+	}))
+	return s
+}
+
+func (s *recordingServer) url() string {
+	return s.server.URL
+}
+
+func (s *recordingServer) host() string {
+	return strings.TrimPrefix(s.server.URL, "http://")
+}
+
+func (s *recordingServer) close() {
+	s.server.Close()
+}
+
+// setFail makes the server fail all requests until called again with false
+func (s *recordingServer) setFail(fail bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.fail = fail
+}
+
+// failNext makes the server fail the next n requests
+func (s *recordingServer) failNext(n int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.failures = n
+}
+
+// failuresLeft returns the number of requests still to be failed
+func (s *recordingServer) failuresLeft() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.failures
+}
+
+// received returns the requests recorded with the method given, or all requests if the method is empty
+func (s *recordingServer) received(method string) []recordedRequest {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	requests := make([]recordedRequest, 0, len(s.requests))
+	for _, r := range s.requests {
+		if method == "" || r.Method == method {
+			requests = append(requests, r)
+		}
+	}
+	return requests
+}
+
+// decodeBodies unmarshals the JSON bodies of the requests
+func decodeBodies[T any](requests []recordedRequest) []T {
+	values := make([]T, 0, len(requests))
+	for _, r := range requests {
+		var v T
+		json.Unmarshal(r.Body, &v)
+		values = append(values, v)
+	}
+	return values
+}
+
+// respondStatus returns a responder answering all requests with the status given
+func respondStatus(status int) func(w http.ResponseWriter, r recordedRequest) {
+	return func(w http.ResponseWriter, r recordedRequest) {
+		w.WriteHeader(status)
+	}
+}
@@ -35,7 +35,10 @@ func (a *AlarmManager) InjectRoutes() {
 	app.Resource.InjectRoute("/ric/v1/alarms", a.RaiseAlarm, "POST")
 	app.Resource.InjectRoute("/ric/v1/alarms", a.ClearAlarm, "DELETE")
 	app.Resource.InjectRoute("/ric/v1/alarms/active", a.GetActiveAlarms, "GET")
+	app.Resource.InjectRoute("/ric/v1/alarms/active", a.ClearAllAlarms, "DELETE")
 	app.Resource.InjectRoute("/ric/v1/alarms/history", a.GetAlarmHistory, "GET")
+	app.Resource.InjectRoute("/ric/v1/alarms/ack/{alarmId}", a.AcknowledgeAlarm, "POST")
+	app.Resource.InjectRoute("/ric/v1/alarms/ack/{alarmId}", a.UnacknowledgeAlarm, "DELETE")
 	app.Resource.InjectRoute("/ric/v1/alarms/config", a.SetAlarmConfig, "POST")
 	app.Resource.InjectRoute("/ric/v1/alarms/config", a.GetAlarmConfig, "GET")
 	app.Resource.InjectRoute("/ric/v1/alarms/define", a.SetAlarmDefinition, "POST")
@@ -44,6 +47,25 @@ func (a *AlarmManager) InjectRoutes() {
 	app.Resource.InjectRoute("/ric/v1/alarms/define/{alarmId}", a.GetAlarmDefinition, "GET")
 
 	app.Resource.InjectRoute("/ric/v1/symptomdata", a.SymptomDataHandler, "GET")
+
+	// 3GPP TS 28.532 fault supervision
+	app.Resource.InjectRoute(faultMnSRoot+"/alarms", a.GetFaultAlarmList, "GET")
+	app.Resource.InjectRoute(faultMnSRoot+"/alarms/{alarmId}", a.PatchFaultAlarm, "PATCH")
+	app.Resource.InjectRoute(faultMnSRoot+"/subscriptions", a.CreateFaultSubscription, "POST")
+	app.Resource.InjectRoute(faultMnSRoot+"/subscriptions", a.GetFaultSubscriptions, "GET")
+	app.Resource.InjectRoute(faultMnSRoot+"/subscriptions/{subscriptionId}", a.DeleteFaultSubscription, "DELETE")
+
+	app.Resource.InjectRoute("/ric/v1/alertmanagers", a.GetAlertmanagers, "GET")
+	app.Resource.InjectRoute("/ric/v1/alertmanager/webhook", a.ReceiveAlertmanagerWebhook, "POST")
+
+	app.Resource.InjectRoute("/ric/v1/silences", a.PostSilence, "POST")
+	app.Resource.InjectRoute("/ric/v1/silences", a.GetSilenceList, "GET")
+	app.Resource.InjectRoute("/ric/v1/silences/{silenceId}", a.DeleteSilence, "DELETE")
+
+	app.Resource.InjectRoute("/ric/v1/webhooks", a.GetWebhooks, "GET")
+	app.Resource.InjectRoute("/ric/v1/webhooks/{name}/deadletters", a.GetDeadLetters, "GET")
+	app.Resource.InjectRoute("/ric/v1/webhooks/{name}/deadletters", a.PurgeDeadLetters, "DELETE")
+	app.Resource.InjectRoute("/ric/v1/webhooks/{name}/deadletters/replay", a.ReplayDeadLetters, "POST")
 }
 
 func (a *AlarmManager) respondWithError(w http.ResponseWriter, code int, message string) {
@@ -52,6 +74,7 @@ func (a *AlarmManager) respondWithError(w http.ResponseWriter, code int, message
 
 func (a *AlarmManager) respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set(alarm.ALARM_MANAGER_INSTANCE_HEADER, a.instanceId)
 	w.WriteHeader(code)
 	if payload != nil {
 		response, _ := json.Marshal(payload)
@@ -81,6 +104,82 @@ func (a *AlarmManager) ClearAlarm(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (a *AlarmManager) ClearAllAlarms(w http.ResponseWriter, r *http.Request) {
+	if r.Body == nil {
+		app.Logger.Error("DELETE - body is empty")
+		a.respondWithError(w, http.StatusBadRequest, "No data in request body.")
+		return
+	}
+	defer r.Body.Close()
+
+	var filter alarm.AlarmFilter
+	if err := json.NewDecoder(r.Body).Decode(&filter); err != nil {
+		app.Logger.Error("DELETE - received alarm filter is invalid - " + err.Error())
+		a.respondWithError(w, http.StatusBadRequest, "Invalid data in request body.")
+		return
+	}
+
+	// Clearing all active alarms at once is not allowed, at least one criterion is needed
+	if filter == (alarm.AlarmFilter{}) {
+		app.Logger.Error("DELETE - alarm filter is empty")
+		a.respondWithError(w, http.StatusBadRequest, "Alarm filter is empty.")
+		return
+	}
+
+	cleared := a.ProcessClearAllAlarms(filter, time.Now().UnixNano())
+	a.respondWithJSON(w, http.StatusOK, cleared)
+}
+
+func (a *AlarmManager) AcknowledgeAlarm(w http.ResponseWriter, r *http.Request) {
+	alarmId, ok := a.alarmIdFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	if r.Body == nil {
+		app.Logger.Error("POST - body is empty")
+		a.respondWithError(w, http.StatusBadRequest, "No data in request body.")
+		return
+	}
+	defer r.Body.Close()
+
+	var ack alarm.AlarmAck
+	if err := json.NewDecoder(r.Body).Decode(&ack); err != nil || ack.User == "" {
+		app.Logger.Error("POST - received alarm acknowledgement is invalid")
+		a.respondWithError(w, http.StatusBadRequest, "Invalid data in request body.")
+		return
+	}
+	ack.Time = time.Now().UnixNano()
+
+	a.setAlarmAck(w, alarmId, &ack)
+}
+
+func (a *AlarmManager) UnacknowledgeAlarm(w http.ResponseWriter, r *http.Request) {
+	if alarmId, ok := a.alarmIdFromPath(w, r); ok {
+		a.setAlarmAck(w, alarmId, nil)
+	}
+}
+
+func (a *AlarmManager) setAlarmAck(w http.ResponseWriter, alarmId int, ack *alarm.AlarmAck) {
+	m, found := a.SetAlarmAck(alarmId, ack)
+	if !found {
+		app.Logger.Error("Active alarm not found %v", alarmId)
+		a.respondWithError(w, http.StatusNotFound, "Non existent alarmId")
+		return
+	}
+	a.respondWithJSON(w, http.StatusOK, m)
+}
+
+func (a *AlarmManager) alarmIdFromPath(w http.ResponseWriter, r *http.Request) (int, bool) {
+	alarmId, err := strconv.Atoi(mux.Vars(r)["alarmId"])
+	if err != nil {
+		app.Logger.Error("alarmId string to int conversion failed %v", mux.Vars(r)["alarmId"])
+		a.respondWithError(w, http.StatusBadRequest, "Invalid alarmId")
+		return 0, false
+	}
+	return alarmId, true
+}
+
 func (a *AlarmManager) SetAlarmDefinition(w http.ResponseWriter, r *http.Request) {
 
 	app.Logger.Debug("POST arrived for creating alarm definition ")
@@ -199,7 +298,7 @@ func (a *AlarmManager) doAction(w http.ResponseWriter, r *http.Request, isRaiseA
 		m.AlarmTime = time.Now().UnixNano()
 	}
 
-	_, err := a.ProcessAlarm(&AlarmNotification{m, alarm.AlarmDefinition{}})
+	_, err := a.ProcessAlarm(&AlarmNotification{AlarmMessage: m})
 	return err
 }
 
@@ -25,9 +25,11 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"testing"
 
 	"gerrit.o-ran-sc.org/r/ric-plt/alarm-go.git/alarm"
+	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -46,6 +48,21 @@ func TestGetActiveAlarmsRESTInterface(t *testing.T) {
 	assert.Equal(t, rr.Code, http.StatusOK)
 }
 
+func TestAlarmManagerInstanceHeader(t *testing.T) {
+	req, err := http.NewRequest("GET", "/ric/v1/alarms/config", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(alarmManager.GetAlarmConfig)
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, rr.Code, http.StatusOK)
+	assert.NotEmpty(t, rr.Header().Get(alarm.ALARM_MANAGER_INSTANCE_HEADER))
+	assert.Equal(t, alarmManager.instanceId, rr.Header().Get(alarm.ALARM_MANAGER_INSTANCE_HEADER))
+}
+
 func TestRaiseAlarmRESTInterface(t *testing.T) {
 	a := alarmer.NewAlarm(alarm.E2_CONNECTION_PROBLEM, alarm.SeverityMajor, "Some App data", "eth 0 1")
 	b, err := json.Marshal(&a)
@@ -99,3 +116,92 @@ func TestSymptomDataHandler(t *testing.T) {
 	assert.Equal(t, true, rr != nil)
 	assert.Equal(t, rr.Code, http.StatusOK)
 }
+
+func TestClearAllAlarmsRESTInterface(t *testing.T) {
+	a := alarmer.NewAlarm(alarm.E2_CONNECTION_PROBLEM, alarm.SeverityMajor, "Some App data", "eth 0 1")
+	m := alarmer.NewAlarmMessage(a, alarm.AlarmActionRaise)
+	alarmManager.ProcessAlarm(&AlarmNotification{AlarmMessage: m})
+
+	b, err := json.Marshal(&alarm.AlarmFilter{ManagedObjectId: a.ManagedObjectId, SpecificProblem: a.SpecificProblem})
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	req, err := http.NewRequest("DELETE", "/ric/v1/alarms/active", bytes.NewBuffer(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(alarmManager.ClearAllAlarms)
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, rr.Code, http.StatusOK)
+	var cleared []AlarmNotification
+	json.NewDecoder(rr.Body).Decode(&cleared)
+	assert.Equal(t, 1, len(cleared))
+	_, ok := alarmManager.IsMatchFound(a)
+	assert.False(t, ok)
+}
+
+func TestClearAllAlarmsEmptyFilterRESTInterface(t *testing.T) {
+	req, err := http.NewRequest("DELETE", "/ric/v1/alarms/active", bytes.NewBufferString("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(alarmManager.ClearAllAlarms)
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, rr.Code, http.StatusBadRequest)
+}
+
+func TestAlarmAckRESTInterface(t *testing.T) {
+	alarmManager.activeAlarms = make([]AlarmNotification, 0)
+	a := alarmer.NewAlarm(alarm.E2_CONNECTION_PROBLEM, alarm.SeverityMajor, "Some App data", "eth 0 1")
+	m := alarmer.NewAlarmMessage(a, alarm.AlarmActionRaise)
+	alarmManager.ProcessAlarm(&AlarmNotification{AlarmMessage: m})
+	alarmId := strconv.Itoa(alarmManager.activeAlarms[0].AlarmId)
+
+	b, _ := json.Marshal(&alarm.AlarmAck{User: "operator", Comment: "on it"})
+	req, _ := http.NewRequest("POST", "/ric/v1/alarms/ack/"+alarmId, bytes.NewBuffer(b))
+	req = mux.SetURLVars(req, map[string]string{"alarmId": alarmId})
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(alarmManager.AcknowledgeAlarm).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var acked AlarmNotification
+	json.NewDecoder(rr.Body).Decode(&acked)
+	assert.NotNil(t, acked.Ack)
+	assert.Equal(t, "operator", acked.Ack.User)
+	assert.Equal(t, "on it", acked.Ack.Comment)
+	assert.NotNil(t, alarmManager.activeAlarms[0].Ack)
+
+	labels, annotations := alarmManager.GenerateNotificationAlertLabels(&alarmManager.activeAlarms[0], AlertStatusActive)
+	assert.NotEmpty(t, labels)
+	assert.Equal(t, "operator", annotations["ack_user"])
+
+	// User is mandatory
+	b, _ = json.Marshal(&alarm.AlarmAck{Comment: "on it"})
+	req, _ = http.NewRequest("POST", "/ric/v1/alarms/ack/"+alarmId, bytes.NewBuffer(b))
+	req = mux.SetURLVars(req, map[string]string{"alarmId": alarmId})
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(alarmManager.AcknowledgeAlarm).ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	req, _ = http.NewRequest("DELETE", "/ric/v1/alarms/ack/"+alarmId, nil)
+	req = mux.SetURLVars(req, map[string]string{"alarmId": alarmId})
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(alarmManager.UnacknowledgeAlarm).ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Nil(t, alarmManager.activeAlarms[0].Ack)
+
+	// Alarm not active
+	req, _ = http.NewRequest("DELETE", "/ric/v1/alarms/ack/0", nil)
+	req = mux.SetURLVars(req, map[string]string{"alarmId": "0"})
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(alarmManager.UnacknowledgeAlarm).ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	alarmManager.activeAlarms = make([]AlarmNotification, 0)
+}
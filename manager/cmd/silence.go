@@ -0,0 +1,334 @@
+/*
+ *  Copyright (c) 2020 AT&T Intellectual Property.
+ *  Copyright (c) 2020 Nokia.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ * This source code is part of the near-RT RIC (RAN Intelligent Controller)
+ * platform project (RICP).
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/alarm-go.git/alarm"
+	app "gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/xapp"
+	"github.com/go-openapi/runtime"
+	"github.com/go-openapi/strfmt"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/alertmanager/api/v2/client"
+	"github.com/prometheus/alertmanager/api/v2/client/silence"
+	"github.com/prometheus/alertmanager/api/v2/models"
+)
+
+// Labels set by GenerateAlertLabels that alarm silences are matched against
+const (
+	silenceLabelSystem   = "system_name"
+	silenceLabelName     = "alertname"
+	silenceLabelService  = "service"
+	silenceLabelInfo     = "info"
+	silenceLabelSeverity = "severity"
+	silenceSystemName    = "RIC"
+)
+
+// isSilenceLabel tells whether the alert label is matched by the alarm silences. The alert mapping must keep these
+// labels as GenerateAlertLabels sets them, otherwise the silences would not match the alerts.
+func isSilenceLabel(name string) bool {
+	switch name {
+	case silenceLabelSystem, silenceLabelName, silenceLabelService, silenceLabelInfo, silenceLabelSeverity:
+		return true
+	}
+	return false
+}
+
+// SilenceMatchers translates the alarm terms of the silence into Alert Manager matchers of the alert labels. The
+// specific problem matches the alarm text of the definition, and the managed object and application the service label.
+func SilenceMatchers(s alarm.AlarmSilence) (models.Matchers, error) {
+	matchers := models.Matchers{newMatcher(silenceLabelSystem, silenceSystemName, false)}
+
+	if s.SpecificProblem != 0 {
+		alarmDef, ok := alarm.RICAlarmDefinitions[s.SpecificProblem]
+		if !ok {
+			return nil, fmt.Errorf("alarm definition of specific problem %d not found", s.SpecificProblem)
+		}
+		matchers = append(matchers, newMatcher(silenceLabelName, alarmDef.AlarmText, false))
+	}
+
+	switch {
+	case s.ManagedObjectId != "" && s.ApplicationId != "":
+		matchers = append(matchers, newMatcher(silenceLabelService, s.ManagedObjectId+"/"+s.ApplicationId, false))
+	case s.ManagedObjectId != "":
+		matchers = append(matchers, newMatcher(silenceLabelService, regexp.QuoteMeta(s.ManagedObjectId)+"/.*", true))
+	case s.ApplicationId != "":
+		matchers = append(matchers, newMatcher(silenceLabelService, ".*/"+regexp.QuoteMeta(s.ApplicationId), true))
+	}
+
+	if s.IdentifyingInfo != "" {
+		matchers = append(matchers, newMatcher(silenceLabelInfo, s.IdentifyingInfo, false))
+	}
+
+	if s.PerceivedSeverity != "" {
+		switch s.PerceivedSeverity {
+		case alarm.SeverityCritical, alarm.SeverityMajor, alarm.SeverityMinor, alarm.SeverityWarning,
+			alarm.SeverityUnspecified, alarm.SeverityDefault:
+		default:
+			return nil, fmt.Errorf("invalid severity '%s'", s.PerceivedSeverity)
+		}
+		matchers = append(matchers, newMatcher(silenceLabelSeverity, string(s.PerceivedSeverity), false))
+	}
+
+	// Silencing all RIC alarms is not allowed
+	if len(matchers) == 1 {
+		return nil, fmt.Errorf("no alarm matchers given")
+	}
+	return matchers, nil
+}
+
+func newMatcher(name, value string, isRegex bool) *models.Matcher {
+	isEqual := true
+	return &models.Matcher{Name: &name, Value: &value, IsRegex: &isRegex, IsEqual: &isEqual}
+}
+
+// NewAlarmSilence translates the Alert Manager silence back into alarm terms. Silences not created for RIC alarms
+// are not translated, and false is returned.
+func NewAlarmSilence(gs *models.GettableSilence) (alarm.AlarmSilence, bool) {
+	s := alarm.AlarmSilence{Matchers: []string{}}
+	ric := false
+	for _, m := range gs.Matchers {
+		if m == nil || m.Name == nil || m.Value == nil {
+			continue
+		}
+		isRegex := m.IsRegex != nil && *m.IsRegex
+		isEqual := m.IsEqual == nil || *m.IsEqual
+		s.Matchers = append(s.Matchers, matcherString(*m.Name, *m.Value, isRegex, isEqual))
+		if !isEqual {
+			continue
+		}
+
+		name, value := *m.Name, *m.Value
+		switch {
+		case name == silenceLabelSystem && value == silenceSystemName && !isRegex:
+			ric = true
+		case name == silenceLabelName && !isRegex:
+			s.SpecificProblem = specificProblemOf(value)
+		case name == silenceLabelService && !isRegex:
+			s.ManagedObjectId, s.ApplicationId, _ = strings.Cut(value, "/")
+		case name == silenceLabelService && strings.HasSuffix(value, "/.*"):
+			s.ManagedObjectId = unquoteMeta(strings.TrimSuffix(value, "/.*"))
+		case name == silenceLabelService && strings.HasPrefix(value, ".*/"):
+			s.ApplicationId = unquoteMeta(strings.TrimPrefix(value, ".*/"))
+		case name == silenceLabelInfo && !isRegex:
+			s.IdentifyingInfo = value
+		case name == silenceLabelSeverity && !isRegex:
+			s.PerceivedSeverity = alarm.Severity(value)
+		}
+	}
+	if !ric {
+		return s, false
+	}
+
+	if gs.ID != nil {
+		s.Id = *gs.ID
+	}
+	if gs.Status != nil && gs.Status.State != nil {
+		s.State = *gs.Status.State
+	}
+	if gs.StartsAt != nil {
+		s.StartsAt = time.Time(*gs.StartsAt).UnixNano()
+	}
+	if gs.EndsAt != nil {
+		s.EndsAt = time.Time(*gs.EndsAt).UnixNano()
+	}
+	if gs.CreatedBy != nil {
+		s.CreatedBy = *gs.CreatedBy
+	}
+	if gs.Comment != nil {
+		s.Comment = *gs.Comment
+	}
+	return s, true
+}
+
+func matcherString(name, value string, isRegex, isEqual bool) string {
+	op := "="
+	if isRegex {
+		op = "=~"
+	}
+	if !isEqual {
+		op = "!" + op[len(op)-1:]
+	}
+	return fmt.Sprintf("%s%s\"%s\"", name, op, value)
+}
+
+// specificProblemOf returns the lowest specific problem of the alarm definitions having the alarm text, or 0 if not found
+func specificProblemOf(alarmText string) int {
+	specificProblem := 0
+	for sp, alarmDef := range alarm.RICAlarmDefinitions {
+		if alarmDef.AlarmText == alarmText && (specificProblem == 0 || sp < specificProblem) {
+			specificProblem = sp
+		}
+	}
+	return specificProblem
+}
+
+// unquoteMeta reverses regexp.QuoteMeta
+func unquoteMeta(s string) string {
+	var b strings.Builder
+	escaped := false
+	for _, r := range s {
+		if r == '\\' && !escaped {
+			escaped = true
+			continue
+		}
+		escaped = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// CreateSilence creates the silence in Alert Manager and returns the silence ID
+func (a *AlarmManager) CreateSilence(s alarm.AlarmSilence) (string, error) {
+	matchers, err := SilenceMatchers(s)
+	if err != nil {
+		return "", err
+	}
+
+	startsAt := strfmt.DateTime(time.Now())
+	if s.StartsAt != 0 {
+		startsAt = strfmt.DateTime(time.Unix(0, s.StartsAt))
+	}
+	endsAt := strfmt.DateTime(time.Unix(0, s.EndsAt))
+	ps := &models.PostableSilence{
+		Silence: models.Silence{
+			Comment:   &s.Comment,
+			CreatedBy: &s.CreatedBy,
+			StartsAt:  &startsAt,
+			EndsAt:    &endsAt,
+			Matchers:  matchers,
+		},
+	}
+
+	// Silences are shared between the Alert Manager replicas, so the silence is created in one of them
+	var resp *silence.PostSilencesOK
+	err = a.withAlertmanager(func(c *client.AlertmanagerAPI) (err error) {
+		resp, err = c.Silence.PostSilences(silence.NewPostSilencesParams().WithSilence(ps))
+		return err
+	})
+	if err != nil {
+		app.Logger.Error("Posting silence to Alert Manager failed: %v", err)
+		return "", err
+	}
+	return resp.Payload.SilenceID, nil
+}
+
+// GetSilences returns the silences of RIC alarms in Alert Manager, including the expired ones
+func (a *AlarmManager) GetSilences() ([]alarm.AlarmSilence, error) {
+	var resp *silence.GetSilencesOK
+	err := a.withAlertmanager(func(c *client.AlertmanagerAPI) (err error) {
+		resp, err = c.Silence.GetSilences(silence.NewGetSilencesParams())
+		return err
+	})
+	if err != nil {
+		app.Logger.Error("Getting silences from Alert Manager failed: %v", err)
+		return nil, err
+	}
+
+	silences := []alarm.AlarmSilence{}
+	for _, gs := range resp.Payload {
+		if s, ok := NewAlarmSilence(gs); ok {
+			silences = append(silences, s)
+		}
+	}
+	return silences, nil
+}
+
+// ExpireSilence expires the silence in Alert Manager
+func (a *AlarmManager) ExpireSilence(id string) error {
+	err := a.withAlertmanager(func(c *client.AlertmanagerAPI) error {
+		_, err := c.Silence.DeleteSilence(silence.NewDeleteSilenceParams().WithSilenceID(strfmt.UUID(id)))
+		return err
+	})
+	if err != nil {
+		app.Logger.Error("Expiring silence '%s' in Alert Manager failed: %v", id, err)
+	}
+	return err
+}
+
+func (a *AlarmManager) PostSilence(w http.ResponseWriter, r *http.Request) {
+	if r.Body == nil {
+		app.Logger.Error("POST - body is empty")
+		a.respondWithError(w, http.StatusBadRequest, "No data in request body.")
+		return
+	}
+	defer r.Body.Close()
+
+	var s alarm.AlarmSilence
+	if err := json.NewDecoder(r.Body).Decode(&s); err != nil || s.CreatedBy == "" || s.Comment == "" {
+		app.Logger.Error("POST - received silence is invalid")
+		a.respondWithError(w, http.StatusBadRequest, "Invalid data in request body.")
+		return
+	}
+	if s.EndsAt <= time.Now().UnixNano() || (s.StartsAt != 0 && s.StartsAt >= s.EndsAt) {
+		a.respondWithError(w, http.StatusBadRequest, "Invalid silence start or end time.")
+		return
+	}
+	if _, err := SilenceMatchers(s); err != nil {
+		a.respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	id, err := a.CreateSilence(s)
+	if err != nil {
+		a.respondWithError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	app.Logger.Info("Silence '%s' created by '%s'", id, s.CreatedBy)
+	a.respondWithJSON(w, http.StatusOK, map[string]string{"id": id})
+}
+
+func (a *AlarmManager) GetSilenceList(w http.ResponseWriter, r *http.Request) {
+	silences, err := a.GetSilences()
+	if err != nil {
+		a.respondWithError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	a.respondWithJSON(w, http.StatusOK, silences)
+}
+
+func (a *AlarmManager) DeleteSilence(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["silenceId"]
+	if !strfmt.IsUUID(id) {
+		a.respondWithError(w, http.StatusBadRequest, "Invalid silenceId")
+		return
+	}
+
+	err := a.ExpireSilence(id)
+	var apiErr *runtime.APIError
+	if errors.As(err, &apiErr) && apiErr.IsCode(http.StatusNotFound) {
+		a.respondWithError(w, http.StatusNotFound, "Non existent silenceId")
+		return
+	}
+	if err != nil {
+		a.respondWithError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	app.Logger.Info("Silence '%s' expired", id)
+	a.respondWithJSON(w, http.StatusOK, nil)
+}
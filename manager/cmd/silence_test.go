@@ -0,0 +1,187 @@
+/*
+ *  Copyright (c) 2020 AT&T Intellectual Property.
+ *  Copyright (c) 2020 Nokia.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ * This source code is part of the near-RT RIC (RAN Intelligent Controller)
+ * platform project (RICP).
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/alarm-go.git/alarm"
+	"github.com/go-openapi/strfmt"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/alertmanager/api/v2/models"
+	"github.com/stretchr/testify/assert"
+)
+
+const testSilenceId = "8f2b7c6e-3d1a-4b5e-9c0f-1a2b3c4d5e6f"
+
+// silenceSimulator is an Alert Manager storing one silence
+type silenceSimulator struct {
+	*recordingServer
+	silenceMutex sync.Mutex
+	silence      *models.PostableSilence
+	expired      bool
+}
+
+func newSilenceSimulator() *silenceSimulator {
+	s := &silenceSimulator{}
+	s.recordingServer = newRecordingServer(func(w http.ResponseWriter, r recordedRequest) {
+		s.silenceMutex.Lock()
+		defer s.silenceMutex.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == "POST" && strings.HasSuffix(r.Path, "/silences"):
+			s.silence = &models.PostableSilence{}
+			json.Unmarshal(r.Body, s.silence)
+			json.NewEncoder(w).Encode(map[string]string{"silenceID": testSilenceId})
+		case r.Method == "GET" && strings.HasSuffix(r.Path, "/silences"):
+			silences := models.GettableSilences{}
+			if s.silence != nil {
+				id, state, updatedAt := testSilenceId, "active", strfmt.DateTime(time.Now())
+				if s.expired {
+					state = "expired"
+				}
+				silences = append(silences, &models.GettableSilence{
+					ID: &id, Status: &models.SilenceStatus{State: &state}, UpdatedAt: &updatedAt, Silence: s.silence.Silence,
+				})
+			}
+			json.NewEncoder(w).Encode(silences)
+		case r.Method == "DELETE" && strings.HasSuffix(r.Path, "/silence/"+testSilenceId):
+			s.expired = true
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	return s
+}
+
+func TestSilenceMatchers(t *testing.T) {
+	s := alarm.AlarmSilence{
+		AlarmFilter: alarm.AlarmFilter{
+			ManagedObjectId:   "my-pod",
+			SpecificProblem:   alarm.E2_CONNECTION_PROBLEM,
+			PerceivedSeverity: alarm.SeverityMajor,
+		},
+		IdentifyingInfo: "eth 0 1",
+	}
+	matchers, err := SilenceMatchers(s)
+	assert.Nil(t, err)
+
+	var strs []string
+	for _, m := range matchers {
+		strs = append(strs, matcherString(*m.Name, *m.Value, *m.IsRegex, *m.IsEqual))
+	}
+	assert.Equal(t, []string{
+		`system_name="RIC"`,
+		`alertname="` + alarm.RICAlarmDefinitions[alarm.E2_CONNECTION_PROBLEM].AlarmText + `"`,
+		`service=~"my-pod/.*"`,
+		`info="eth 0 1"`,
+		`severity="MAJOR"`,
+	}, strs)
+
+	// Matchers select the labels of the alert of a matching alarm
+	a := alarmer.NewAlarm(alarm.E2_CONNECTION_PROBLEM, alarm.SeverityMajor, "Some App data", "eth 0 1")
+	a.ManagedObjectId = "my-pod"
+	amLabels, _ := alarmManager.GenerateAlertLabels(1, a, AlertStatusActive, time.Now().UnixNano())
+	assert.Equal(t, "RIC", amLabels["system_name"])
+	assert.Equal(t, *matchers[1].Value, amLabels["alertname"])
+	assert.Regexp(t, "^"+*matchers[2].Value+"$", amLabels["service"])
+	assert.Equal(t, *matchers[3].Value, amLabels["info"])
+	assert.Equal(t, *matchers[4].Value, amLabels["severity"])
+
+	// Translated back into alarm terms
+	matchers, _ = SilenceMatchers(alarm.AlarmSilence{AlarmFilter: alarm.AlarmFilter{ApplicationId: "my.app"}})
+	assert.Equal(t, `.*/my\.app`, *matchers[1].Value)
+	id, createdBy, comment := testSilenceId, "operator", "maintenance"
+	back, ok := NewAlarmSilence(&models.GettableSilence{ID: &id, Silence: models.Silence{Matchers: matchers, CreatedBy: &createdBy, Comment: &comment}})
+	assert.True(t, ok)
+	assert.Equal(t, "my.app", back.ApplicationId)
+	assert.Equal(t, "operator", back.CreatedBy)
+
+	// Other than RIC silences are not translated
+	_, ok = NewAlarmSilence(&models.GettableSilence{Silence: models.Silence{Matchers: matchers[1:]}})
+	assert.False(t, ok)
+
+	_, err = SilenceMatchers(alarm.AlarmSilence{})
+	assert.NotNil(t, err)
+	_, err = SilenceMatchers(alarm.AlarmSilence{AlarmFilter: alarm.AlarmFilter{SpecificProblem: 1}})
+	assert.NotNil(t, err)
+	_, err = SilenceMatchers(alarm.AlarmSilence{AlarmFilter: alarm.AlarmFilter{PerceivedSeverity: alarm.SeverityCleared}})
+	assert.NotNil(t, err)
+}
+
+func TestSilenceRESTInterface(t *testing.T) {
+	am := newSilenceSimulator()
+	defer am.close()
+	amHosts := alarmManager.alertmanagerHosts()
+	alarmManager.SetAlertmanagerHosts([]string{am.host()})
+	defer alarmManager.SetAlertmanagerHosts(amHosts)
+
+	s := alarm.AlarmSilence{
+		AlarmFilter: alarm.AlarmFilter{ManagedObjectId: "my-pod", ApplicationId: "my-app", SpecificProblem: alarm.E2_CONNECTION_PROBLEM},
+		EndsAt:      time.Now().Add(time.Hour).UnixNano(),
+		CreatedBy:   "operator",
+		Comment:     "maintenance",
+	}
+	b, _ := json.Marshal(&s)
+	req, _ := http.NewRequest("POST", "/ric/v1/silences", bytes.NewBuffer(b))
+	rr := executeRequest(req, alarmManager.PostSilence)
+	checkResponseCode(t, http.StatusOK, rr.Code)
+	var created map[string]string
+	json.NewDecoder(rr.Body).Decode(&created)
+	assert.Equal(t, testSilenceId, created["id"])
+
+	req, _ = http.NewRequest("GET", "/ric/v1/silences", nil)
+	rr = executeRequest(req, alarmManager.GetSilenceList)
+	checkResponseCode(t, http.StatusOK, rr.Code)
+	var silences []alarm.AlarmSilence
+	json.NewDecoder(rr.Body).Decode(&silences)
+	assert.Equal(t, 1, len(silences))
+	assert.Equal(t, testSilenceId, silences[0].Id)
+	assert.Equal(t, "active", silences[0].State)
+	assert.Equal(t, s.AlarmFilter, silences[0].AlarmFilter)
+	assert.Equal(t, `service="my-pod/my-app"`, silences[0].Matchers[2])
+
+	req, _ = http.NewRequest("DELETE", "/ric/v1/silences/"+testSilenceId, nil)
+	req = mux.SetURLVars(req, map[string]string{"silenceId": testSilenceId})
+	checkResponseCode(t, http.StatusOK, executeRequest(req, alarmManager.DeleteSilence).Code)
+	assert.True(t, am.expired)
+
+	// Errors
+	otherId := "00000000-0000-0000-0000-000000000000"
+	req, _ = http.NewRequest("DELETE", "/ric/v1/silences/"+otherId, nil)
+	req = mux.SetURLVars(req, map[string]string{"silenceId": otherId})
+	checkResponseCode(t, http.StatusNotFound, executeRequest(req, alarmManager.DeleteSilence).Code)
+
+	req, _ = http.NewRequest("DELETE", "/ric/v1/silences/foo", nil)
+	req = mux.SetURLVars(req, map[string]string{"silenceId": "foo"})
+	checkResponseCode(t, http.StatusBadRequest, executeRequest(req, alarmManager.DeleteSilence).Code)
+
+	s.EndsAt = time.Now().Add(-time.Hour).UnixNano()
+	b, _ = json.Marshal(&s)
+	req, _ = http.NewRequest("POST", "/ric/v1/silences", bytes.NewBuffer(b))
+	checkResponseCode(t, http.StatusBadRequest, executeRequest(req, alarmManager.PostSilence).Code)
+}
@@ -0,0 +1,378 @@
+/*
+ *  Copyright (c) 2020 AT&T Intellectual Property.
+ *  Copyright (c) 2020 Nokia.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ * This source code is part of the near-RT RIC (RAN Intelligent Controller)
+ * platform project (RICP).
+ */
+
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/alarm-go.git/alarm"
+	app "gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/xapp"
+	"github.com/gosnmp/gosnmp"
+)
+
+// OIDs of RIC-ALARM-MIB relative to the root OID of the MIB, see schemas/RIC-ALARM-MIB.txt. The MIB is experimental,
+// and its root OID is not registered: by default it is under the experimental arc, and it is configurable.
+const (
+	SnmpDefaultMibRootOid   = "1.3.6.1.3.100"
+	snmpRicAlarmRaised      = ".0.1"
+	snmpRicAlarmCleared     = ".0.2"
+	snmpRicAlarmChanged     = ".0.3"
+	snmpRicAlarmObjects     = ".1"
+	snmpRicAlarmId          = snmpRicAlarmObjects + ".1"
+	snmpRicAlarmSP          = snmpRicAlarmObjects + ".2"
+	snmpRicAlarmMO          = snmpRicAlarmObjects + ".3"
+	snmpRicAlarmApplication = snmpRicAlarmObjects + ".4"
+	snmpRicAlarmSeverity    = snmpRicAlarmObjects + ".5"
+	snmpRicAlarmIdentifying = snmpRicAlarmObjects + ".6"
+	snmpRicAlarmAdditional  = snmpRicAlarmObjects + ".7"
+	snmpRicAlarmText        = snmpRicAlarmObjects + ".8"
+	snmpRicAlarmEventType   = snmpRicAlarmObjects + ".9"
+)
+
+const (
+	snmpSysUpTime  = "1.3.6.1.2.1.1.3.0"
+	snmpTrapOID    = "1.3.6.1.6.3.1.1.4.1.0"
+	snmpMaxBoots   = 2147483647 // RFC 3414: snmpEngineBoots latches at its maximum value
+	snmpEngineText = "alarmmanager"
+)
+
+// SnmpDefaultEnterprise is the IANA enterprise number of the default engine ID, i.e. the O-RAN Alliance
+const SnmpDefaultEnterprise = 53148
+
+var snmpOid = regexp.MustCompile(`^[0-9]+(\.[0-9]+)+$`)
+
+// Values of RicAlarmSeverity of RIC-ALARM-MIB
+var snmpSeverities = map[alarm.Severity]int{
+	alarm.SeverityCleared:  1,
+	alarm.SeverityCritical: 3,
+	alarm.SeverityMajor:    4,
+	alarm.SeverityMinor:    5,
+	alarm.SeverityWarning:  6,
+}
+
+var snmpAuthProtocols = map[string]gosnmp.SnmpV3AuthProtocol{
+	"":       gosnmp.NoAuth,
+	"MD5":    gosnmp.MD5,
+	"SHA":    gosnmp.SHA,
+	"SHA224": gosnmp.SHA224,
+	"SHA256": gosnmp.SHA256,
+	"SHA384": gosnmp.SHA384,
+	"SHA512": gosnmp.SHA512,
+}
+
+var snmpPrivProtocols = map[string]gosnmp.SnmpV3PrivProtocol{
+	"":       gosnmp.NoPriv,
+	"DES":    gosnmp.DES,
+	"AES":    gosnmp.AES,
+	"AES192": gosnmp.AES192,
+	"AES256": gosnmp.AES256,
+}
+
+// SnmpConfig is the configuration of the SNMP trap sink, see controls.snmp in config-file.json.
+// Community is used with version 2c, and the user and the protocols and passwords with version 3.
+// MibRootOid is the root OID of RIC-ALARM-MIB, by default SnmpDefaultMibRootOid. If EngineId is not given,
+// the engine ID of SNMPv3 is built from Enterprise, by default SnmpDefaultEnterprise. The engine boots are
+// persisted to EngineBootsFile, if given.
+type SnmpConfig struct {
+	Target          string
+	MibRootOid      string
+	Version         string
+	Community       string
+	User            string
+	AuthProtocol    string
+	AuthPassword    string
+	PrivProtocol    string
+	PrivPassword    string
+	EngineId        string
+	Enterprise      int
+	EngineBootsFile string
+	QueueSize       int
+}
+
+// SnmpSink sends a trap of RIC-ALARM-MIB on every raise, clear and severity change of the alarms
+type SnmpSink struct {
+	client  *gosnmp.GoSNMP
+	rootOid string
+	usm     *gosnmp.UsmSecurityParameters
+	started time.Time
+	traps   chan gosnmp.SnmpTrap
+	done    chan struct{}
+	closed  bool
+	mutex   sync.Mutex
+}
+
+// ReadSnmpConfig reads the SNMP sink configuration. Returns false if the sink is not enabled. The engine boots
+// are persisted next to the alarm info file.
+func ReadSnmpConfig(alarmInfoPvFile string) (SnmpConfig, bool) {
+	if !app.Config.GetBool("controls.snmp.enabled") {
+		return SnmpConfig{}, false
+	}
+
+	var bootsFile string
+	if alarmInfoPvFile != "" {
+		bootsFile = filepath.Join(filepath.Dir(alarmInfoPvFile), "snmp-engine-boots.json")
+	}
+	return SnmpConfig{
+		Target:          app.Config.GetString("controls.snmp.target"),
+		MibRootOid:      app.Config.GetString("controls.snmp.mibRootOid"),
+		Version:         app.Config.GetString("controls.snmp.version"),
+		Community:       app.Config.GetString("controls.snmp.community"),
+		User:            app.Config.GetString("controls.snmp.user"),
+		AuthProtocol:    app.Config.GetString("controls.snmp.authProtocol"),
+		AuthPassword:    app.Config.GetString("controls.snmp.authPassword"),
+		PrivProtocol:    app.Config.GetString("controls.snmp.privProtocol"),
+		PrivPassword:    app.Config.GetString("controls.snmp.privPassword"),
+		EngineId:        app.Config.GetString("controls.snmp.engineId"),
+		Enterprise:      app.Config.GetInt("controls.snmp.enterprise"),
+		EngineBootsFile: bootsFile,
+		QueueSize:       app.Config.GetInt("controls.snmp.queueSize"),
+	}, true
+}
+
+// NewSnmpSink starts the SNMP sink. The target is given as host:port, and the port defaults to 162.
+func NewSnmpSink(cfg SnmpConfig) (*SnmpSink, error) {
+	host, port := cfg.Target, "162"
+	if h, p, err := net.SplitHostPort(cfg.Target); err == nil {
+		host, port = h, p
+	}
+	portNum, err := strconv.Atoi(port)
+	if err != nil || host == "" {
+		return nil, fmt.Errorf("invalid SNMP target '%s'", cfg.Target)
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 1000
+	}
+	rootOid := strings.TrimPrefix(cfg.MibRootOid, ".")
+	if rootOid == "" {
+		rootOid = SnmpDefaultMibRootOid
+	}
+	if !snmpOid.MatchString(rootOid) {
+		return nil, fmt.Errorf("invalid SNMP MIB root OID '%s'", cfg.MibRootOid)
+	}
+
+	client := &gosnmp.GoSNMP{
+		Target:    host,
+		Port:      uint16(portNum),
+		Transport: "udp",
+		Community: cfg.Community,
+		Timeout:   5 * time.Second,
+		MaxOids:   gosnmp.MaxOids,
+	}
+
+	s := &SnmpSink{
+		client:  client,
+		rootOid: rootOid,
+		started: time.Now(),
+		traps:   make(chan gosnmp.SnmpTrap, cfg.QueueSize),
+		done:    make(chan struct{}),
+	}
+
+	switch cfg.Version {
+	case "", "2c":
+		client.Version = gosnmp.Version2c
+		if client.Community == "" {
+			client.Community = "public"
+		}
+	case "3":
+		if s.usm, err = newSnmpUsm(cfg); err != nil {
+			return nil, err
+		}
+		client.Version = gosnmp.Version3
+		client.SecurityModel = gosnmp.UserSecurityModel
+		client.SecurityParameters = s.usm
+		client.MsgFlags = gosnmp.NoAuthNoPriv
+		if s.usm.AuthenticationProtocol != gosnmp.NoAuth {
+			client.MsgFlags = gosnmp.AuthNoPriv
+			if s.usm.PrivacyProtocol != gosnmp.NoPriv {
+				client.MsgFlags = gosnmp.AuthPriv
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported SNMP version '%s'", cfg.Version)
+	}
+
+	if err := client.Connect(); err != nil {
+		return nil, err
+	}
+	go s.run()
+	return s, nil
+}
+
+// newSnmpUsm returns the USM parameters of SNMPv3. The alarm manager is the authoritative engine of the traps.
+func newSnmpUsm(cfg SnmpConfig) (*gosnmp.UsmSecurityParameters, error) {
+	auth, ok := snmpAuthProtocols[strings.ToUpper(cfg.AuthProtocol)]
+	if !ok {
+		return nil, fmt.Errorf("unsupported SNMP auth protocol '%s'", cfg.AuthProtocol)
+	}
+	priv, ok := snmpPrivProtocols[strings.ToUpper(cfg.PrivProtocol)]
+	if !ok {
+		return nil, fmt.Errorf("unsupported SNMP privacy protocol '%s'", cfg.PrivProtocol)
+	}
+	if cfg.User == "" || (priv != gosnmp.NoPriv && auth == gosnmp.NoAuth) {
+		return nil, fmt.Errorf("invalid SNMPv3 credentials of user '%s'", cfg.User)
+	}
+
+	engineId := cfg.EngineId
+	if engineId == "" {
+		enterprise := cfg.Enterprise
+		if enterprise == 0 {
+			enterprise = SnmpDefaultEnterprise
+		}
+		if enterprise < 0 || enterprise > 0x7fffffff {
+			return nil, fmt.Errorf("invalid SNMP enterprise number %d", cfg.Enterprise)
+		}
+		engineId = snmpEngineId(enterprise)
+	}
+	id, err := hex.DecodeString(strings.TrimPrefix(engineId, "0x"))
+	if err != nil || len(id) < 5 || len(id) > 32 {
+		return nil, fmt.Errorf("invalid SNMP engine ID '%s'", cfg.EngineId)
+	}
+
+	return &gosnmp.UsmSecurityParameters{
+		UserName:                 cfg.User,
+		AuthoritativeEngineID:    string(id),
+		AuthoritativeEngineBoots: snmpEngineBoots(cfg.EngineBootsFile),
+		AuthenticationProtocol:   auth,
+		AuthenticationPassphrase: cfg.AuthPassword,
+		PrivacyProtocol:          priv,
+		PrivacyPassphrase:        cfg.PrivPassword,
+	}, nil
+}
+
+// snmpEngineId returns the RFC 3411 engine ID of the enterprise in text format, in hex
+func snmpEngineId(enterprise int) string {
+	return fmt.Sprintf("%08x04", 0x80000000|uint32(enterprise)) + hex.EncodeToString([]byte(snmpEngineText))
+}
+
+// snmpEngineBoots increments the engine boots persisted to the file, and returns the new value. The engine time
+// restarts from zero, so the receivers accept the traps only if the boots increase on every start.
+func snmpEngineBoots(file string) uint32 {
+	if file == "" {
+		return 1
+	}
+
+	var state struct {
+		EngineBoots uint32 `json:"engineBoots"`
+	}
+	if data, err := ioutil.ReadFile(file); err != nil {
+		app.Logger.Info("Unable to read SNMP engine boots: %v", err)
+	} else if err := json.Unmarshal(data, &state); err != nil {
+		app.Logger.Error("SNMP engine boots json unmarshal error %v", err)
+	}
+	if state.EngineBoots < snmpMaxBoots {
+		state.EngineBoots++
+	}
+
+	data, _ := json.Marshal(state)
+	if err := ioutil.WriteFile(file, data, 0644); err != nil {
+		app.Logger.Error("Unable to write SNMP engine boots: %v", err)
+	}
+	return state.EngineBoots
+}
+
+// Notify queues the trap of the alarm notification. The trap is dropped if the queue is full.
+func (s *SnmpSink) Notify(m AlarmNotification) {
+	if m.AlarmAction == AlarmActionAck {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return
+	}
+
+	select {
+	case s.traps <- s.newTrap(m):
+	default:
+		app.Logger.Warn("SNMP trap queue full, dropping trap of alarm (sp=%d id=%d)", m.SpecificProblem, m.AlarmId)
+	}
+}
+
+// Close sends the queued traps and stops the sink
+func (s *SnmpSink) Close() {
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		return
+	}
+	s.closed = true
+	close(s.traps)
+	s.mutex.Unlock()
+	<-s.done
+	s.client.Conn.Close()
+}
+
+// newTrap maps the alarm notification to the variable bindings of the notification type
+func (s *SnmpSink) newTrap(m AlarmNotification) gosnmp.SnmpTrap {
+	trapOID := s.rootOid + snmpRicAlarmRaised
+	severity := m.PerceivedSeverity
+	switch m.AlarmAction {
+	case alarm.AlarmActionClear:
+		trapOID = s.rootOid + snmpRicAlarmCleared
+		severity = alarm.SeverityCleared
+	case alarm.AlarmActionUpdate:
+		trapOID = s.rootOid + snmpRicAlarmChanged
+	}
+
+	severityValue, ok := snmpSeverities[severity]
+	if !ok {
+		severityValue = 2 // indeterminate
+	}
+
+	return gosnmp.SnmpTrap{
+		Variables: []gosnmp.SnmpPDU{
+			{Name: snmpSysUpTime, Type: gosnmp.TimeTicks, Value: uint32(time.Since(s.started) / (10 * time.Millisecond))},
+			{Name: snmpTrapOID, Type: gosnmp.ObjectIdentifier, Value: trapOID},
+			{Name: s.rootOid + snmpRicAlarmId, Type: gosnmp.Gauge32, Value: uint32(m.AlarmId)},
+			{Name: s.rootOid + snmpRicAlarmSP, Type: gosnmp.Integer, Value: m.SpecificProblem},
+			{Name: s.rootOid + snmpRicAlarmMO, Type: gosnmp.OctetString, Value: m.ManagedObjectId},
+			{Name: s.rootOid + snmpRicAlarmApplication, Type: gosnmp.OctetString, Value: m.ApplicationId},
+			{Name: s.rootOid + snmpRicAlarmSeverity, Type: gosnmp.Integer, Value: severityValue},
+			{Name: s.rootOid + snmpRicAlarmIdentifying, Type: gosnmp.OctetString, Value: m.IdentifyingInfo},
+			{Name: s.rootOid + snmpRicAlarmAdditional, Type: gosnmp.OctetString, Value: m.AdditionalInfo},
+			{Name: s.rootOid + snmpRicAlarmText, Type: gosnmp.OctetString, Value: m.AlarmText},
+			{Name: s.rootOid + snmpRicAlarmEventType, Type: gosnmp.OctetString, Value: m.EventType},
+		},
+	}
+}
+
+func (s *SnmpSink) run() {
+	defer close(s.done)
+	for trap := range s.traps {
+		if s.usm != nil {
+			s.usm.AuthoritativeEngineTime = uint32(time.Since(s.started).Seconds())
+		}
+		if _, err := s.client.SendTrap(trap); err != nil {
+			app.Logger.Info("Unable to send SNMP trap to '%s:%d': %v", s.client.Target, s.client.Port, err)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+/*
+ *  Copyright (c) 2020 AT&T Intellectual Property.
+ *  Copyright (c) 2020 Nokia.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ * This source code is part of the near-RT RIC (RAN Intelligent Controller)
+ * platform project (RICP).
+ */
+
+package main
+
+import (
+	"encoding/hex"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/alarm-go.git/alarm"
+	"github.com/gosnmp/gosnmp"
+	"github.com/stretchr/testify/assert"
+)
+
+type trapReceiver struct {
+	listener *gosnmp.TrapListener
+	addr     string
+	mutex    sync.Mutex
+	traps    []map[string]interface{}
+}
+
+func newTrapReceiver(t *testing.T, params *gosnmp.GoSNMP) *trapReceiver {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	addr := conn.LocalAddr().String()
+	conn.Close()
+
+	r := &trapReceiver{listener: gosnmp.NewTrapListener(), addr: addr}
+	r.listener.Params = params
+	r.listener.OnNewTrap = func(p *gosnmp.SnmpPacket, u *net.UDPAddr) {
+		vars := make(map[string]interface{})
+		for _, v := range p.Variables {
+			if b, ok := v.Value.([]byte); ok {
+				vars[v.Name] = string(b)
+			} else {
+				vars[v.Name] = v.Value
+			}
+		}
+		r.mutex.Lock()
+		r.traps = append(r.traps, vars)
+		r.mutex.Unlock()
+	}
+	go r.listener.Listen(addr)
+	<-r.listener.Listening()
+	return r
+}
+
+func (r *trapReceiver) received() []map[string]interface{} {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]map[string]interface{}{}, r.traps...)
+}
+
+func TestSnmpSinkV2c(t *testing.T) {
+	params := &gosnmp.GoSNMP{Version: gosnmp.Version2c, Community: "ric", Logger: gosnmp.Default.Logger}
+	r := newTrapReceiver(t, params)
+	defer r.listener.Close()
+
+	s, err := NewSnmpSink(SnmpConfig{Target: r.addr, Version: "2c", Community: "ric"})
+	assert.Nil(t, err)
+	s.Notify(vesNotification(alarm.AlarmActionRaise, alarm.SeverityMajor))
+	s.Notify(vesNotification(AlarmActionAck, alarm.SeverityMajor))
+	s.Notify(vesNotification(alarm.AlarmActionUpdate, alarm.SeverityCritical))
+	s.Notify(vesNotification(alarm.AlarmActionClear, alarm.SeverityCritical))
+	assert.Eventually(t, func() bool { return len(r.received()) == 3 }, 5*time.Second, 10*time.Millisecond)
+	s.Close()
+
+	traps := r.received()
+	oid := "." + SnmpDefaultMibRootOid
+	assert.Equal(t, oid+snmpRicAlarmRaised, traps[0]["."+snmpTrapOID])
+	assert.Equal(t, oid+snmpRicAlarmChanged, traps[1]["."+snmpTrapOID])
+	assert.Equal(t, oid+snmpRicAlarmCleared, traps[2]["."+snmpTrapOID])
+	assert.Equal(t, uint(42), traps[0][oid+snmpRicAlarmId])
+	assert.Equal(t, alarm.E2_CONNECTION_PROBLEM, traps[0][oid+snmpRicAlarmSP])
+	assert.Equal(t, "my-pod", traps[0][oid+snmpRicAlarmMO])
+	assert.Equal(t, "my-app", traps[0][oid+snmpRicAlarmApplication])
+	assert.Equal(t, "eth 0 1", traps[0][oid+snmpRicAlarmIdentifying])
+	assert.Equal(t, "E2 CONNECTIVITY LOST TO E2NODE", traps[0][oid+snmpRicAlarmText])
+	assert.Equal(t, 4, traps[0][oid+snmpRicAlarmSeverity])
+	assert.Equal(t, 3, traps[1][oid+snmpRicAlarmSeverity])
+	assert.Equal(t, 1, traps[2][oid+snmpRicAlarmSeverity])
+}
+
+func TestSnmpSinkV3(t *testing.T) {
+	cfg := SnmpConfig{Version: "3", User: "ric", AuthProtocol: "SHA", AuthPassword: "authpassword", PrivProtocol: "AES", PrivPassword: "privpassword"}
+	usm, err := newSnmpUsm(cfg)
+	assert.Nil(t, err)
+	params := &gosnmp.GoSNMP{Version: gosnmp.Version3, SecurityModel: gosnmp.UserSecurityModel, MsgFlags: gosnmp.AuthPriv,
+		SecurityParameters: usm, Logger: gosnmp.Default.Logger}
+	r := newTrapReceiver(t, params)
+	defer r.listener.Close()
+
+	// The MIB root OID is configurable
+	cfg.Target = r.addr
+	cfg.MibRootOid = ".1.3.6.1.4.1.99999.7"
+	s, err := NewSnmpSink(cfg)
+	assert.Nil(t, err)
+	s.Notify(vesNotification(alarm.AlarmActionRaise, alarm.SeverityMajor))
+	assert.Eventually(t, func() bool { return len(r.received()) == 1 }, 5*time.Second, 10*time.Millisecond)
+	s.Close()
+	assert.Equal(t, ".1.3.6.1.4.1.99999.7"+snmpRicAlarmRaised, r.received()[0]["."+snmpTrapOID])
+	assert.Equal(t, "my-pod", r.received()[0][".1.3.6.1.4.1.99999.7"+snmpRicAlarmMO])
+
+	// Invalid configurations
+	_, err = newSnmpUsm(SnmpConfig{User: "ric", Enterprise: -1})
+	assert.NotNil(t, err)
+	_, err = NewSnmpSink(SnmpConfig{Target: r.addr, Version: "1"})
+	assert.NotNil(t, err)
+	_, err = NewSnmpSink(SnmpConfig{Target: r.addr, MibRootOid: "1.3.6.1.x"})
+	assert.NotNil(t, err)
+	_, err = NewSnmpSink(SnmpConfig{Target: r.addr, Version: "3", User: "ric", AuthProtocol: "foo"})
+	assert.NotNil(t, err)
+	_, err = NewSnmpSink(SnmpConfig{Target: r.addr, Version: "3", User: "ric", PrivProtocol: "AES"})
+	assert.NotNil(t, err)
+}
+
+func TestSnmpEngineIdAndBoots(t *testing.T) {
+	usm, err := newSnmpUsm(SnmpConfig{User: "ric"})
+	assert.Nil(t, err)
+	assert.Equal(t, "8000cf9c04616c61726d6d616e61676572", hex.EncodeToString([]byte(usm.AuthoritativeEngineID)))
+	assert.Equal(t, uint32(1), usm.AuthoritativeEngineBoots)
+
+	// The default engine ID is built from the enterprise number
+	usm, err = newSnmpUsm(SnmpConfig{User: "ric", Enterprise: 99999})
+	assert.Nil(t, err)
+	assert.Equal(t, "8001869f04616c61726d6d616e61676572", hex.EncodeToString([]byte(usm.AuthoritativeEngineID)))
+
+	// The engine boots are incremented on every start
+	cfg := SnmpConfig{User: "ric", EngineBootsFile: filepath.Join(t.TempDir(), "snmp-engine-boots.json")}
+	for boots := uint32(1); boots <= 3; boots++ {
+		usm, err = newSnmpUsm(cfg)
+		assert.Nil(t, err)
+		assert.Equal(t, boots, usm.AuthoritativeEngineBoots)
+	}
+}
@@ -22,13 +22,21 @@ package main
 
 import (
 	"sync"
+	"sync/atomic"
 
 	"gerrit.o-ran-sc.org/r/ric-plt/alarm-go.git/alarm"
 )
 
 type AlarmManager struct {
-	amHost                 string
+	amEndpoints            []*AlertmanagerEndpoint
+	amMutex                sync.Mutex
 	amBaseUrl              string
+	alertMapping           atomic.Pointer[AlertMapping]
+	alertReceiver          atomic.Pointer[AlertReceiverConfig]
+	fmAlarms               map[string]bool
+	fmMutex                sync.Mutex
+	fmSync                 sync.Mutex
+	lastReconcile          atomic.Int64
 	amSchemes              []string
 	alertInterval          int
 	activeAlarms           []AlarmNotification
@@ -43,13 +51,28 @@ type AlarmManager struct {
 	exceededActiveAlarmOn  bool
 	exceededAlarmHistoryOn bool
 	alarmInfoPvFile        string
+	instanceId             string
+	sinks                  []AlarmSink
+	faultMnS               *FaultMnS
+	webhooks               []*WebhookSink
+}
+
+// AlarmSink receives the raises, clears and updates of the alarms, e.g. to forward them northbound.
+// Notify must not block.
+type AlarmSink interface {
+	Notify(m AlarmNotification)
+	Close()
 }
 
 type AlarmNotification struct {
 	alarm.AlarmMessage
 	alarm.AlarmDefinition
+	Ack *alarm.AlarmAck `json:"ack,omitempty"`
 }
 
+// AlarmActionAck is given to the alarm sinks when the acknowledgement of an alarm changes
+const AlarmActionAck alarm.AlarmAction = "ACK"
+
 type AlertStatus string
 
 const (
@@ -60,9 +83,7 @@ const (
 var Version string
 var Hash string
 
-type RicAlarmDefinitions struct {
-	AlarmDefinitions []*alarm.AlarmDefinition `json:"alarmdefinitions"`
-}
+type RicAlarmDefinitions = alarm.AlarmDefinitions
 
 type RicPerfAlarmObjects struct {
 	AlarmObjects []*alarm.Alarm `json:"alarmobjects"`
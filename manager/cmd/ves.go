@@ -0,0 +1,395 @@
+/*
+ *  Copyright (c) 2020 AT&T Intellectual Property.
+ *  Copyright (c) 2020 Nokia.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ * This source code is part of the near-RT RIC (RAN Intelligent Controller)
+ * platform project (RICP).
+ */
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/alarm-go.git/alarm"
+	app "gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/xapp"
+)
+
+// VesConfig is the configuration of the VES fault event sink, see controls.ves in config-file.json
+type VesConfig struct {
+	Url                 string
+	User                string
+	Password            string
+	ReportingEntityName string
+	BatchSize           int
+	BatchInterval       time.Duration
+	MaxRetries          int
+	RetryInterval       time.Duration
+	MaxRetryInterval    time.Duration
+	QueueSize           int
+}
+
+// VesSink sends the raises, clears and severity changes of the alarms as ONAP VES fault events to the
+// VES collector. The events of an alarm share the event ID, and the sequence number is incremented per event.
+type VesSink struct {
+	cfg        VesConfig
+	httpClient *http.Client
+	events     chan vesEvent
+	stop       chan struct{}
+	done       chan struct{}
+	ctx        context.Context
+	cancel     context.CancelFunc
+	alarms     map[int]*vesAlarmState
+	closed     bool
+	mutex      sync.Mutex
+}
+
+type vesAlarmState struct {
+	sequence   int
+	startEpoch int64
+}
+
+type vesEvent struct {
+	CommonEventHeader vesCommonEventHeader `json:"commonEventHeader"`
+	FaultFields       vesFaultFields       `json:"faultFields"`
+}
+
+type vesCommonEventHeader struct {
+	Domain                  string `json:"domain"`
+	EventId                 string `json:"eventId"`
+	EventName               string `json:"eventName"`
+	EventType               string `json:"eventType,omitempty"`
+	Sequence                int    `json:"sequence"`
+	Priority                string `json:"priority"`
+	ReportingEntityName     string `json:"reportingEntityName"`
+	SourceName              string `json:"sourceName"`
+	NfVendorName            string `json:"nfVendorName"`
+	StartEpochMicrosec      int64  `json:"startEpochMicrosec"`
+	LastEpochMicrosec       int64  `json:"lastEpochMicrosec"`
+	Version                 string `json:"version"`
+	VesEventListenerVersion string `json:"vesEventListenerVersion"`
+}
+
+type vesFaultFields struct {
+	FaultFieldsVersion         string            `json:"faultFieldsVersion"`
+	AlarmCondition             string            `json:"alarmCondition"`
+	SpecificProblem            string            `json:"specificProblem"`
+	EventSeverity              string            `json:"eventSeverity"`
+	EventSourceType            string            `json:"eventSourceType"`
+	VfStatus                   string            `json:"vfStatus"`
+	AlarmInterfaceA            string            `json:"alarmInterfaceA,omitempty"`
+	AlarmAdditionalInformation map[string]string `json:"alarmAdditionalInformation,omitempty"`
+}
+
+// ReadVesConfig reads the VES sink configuration. Returns false if the sink is not enabled.
+func ReadVesConfig() (VesConfig, bool) {
+	if !app.Config.GetBool("controls.ves.enabled") {
+		return VesConfig{}, false
+	}
+
+	return VesConfig{
+		Url:                 app.Config.GetString("controls.ves.url"),
+		User:                app.Config.GetString("controls.ves.user"),
+		Password:            app.Config.GetString("controls.ves.password"),
+		ReportingEntityName: app.Config.GetString("controls.ves.reportingEntityName"),
+		BatchSize:           app.Config.GetInt("controls.ves.batchSize"),
+		BatchInterval:       time.Duration(app.Config.GetInt("controls.ves.batchInterval")) * time.Millisecond,
+		MaxRetries:          app.Config.GetInt("controls.ves.maxRetries"),
+		RetryInterval:       time.Duration(app.Config.GetInt("controls.ves.retryInterval")) * time.Millisecond,
+		MaxRetryInterval:    time.Duration(app.Config.GetInt("controls.ves.maxRetryInterval")) * time.Millisecond,
+		QueueSize:           app.Config.GetInt("controls.ves.queueSize"),
+	}, true
+}
+
+// NewVesSink starts the VES sink. Zero values of the configuration are replaced with the defaults.
+func NewVesSink(cfg VesConfig) *VesSink {
+	if cfg.ReportingEntityName == "" {
+		cfg.ReportingEntityName = "ric-alarm-manager"
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 1
+	}
+	if cfg.BatchInterval <= 0 {
+		cfg.BatchInterval = time.Second
+	}
+	if cfg.RetryInterval <= 0 {
+		cfg.RetryInterval = time.Second
+	}
+	if cfg.MaxRetryInterval <= 0 {
+		cfg.MaxRetryInterval = 30 * time.Second
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 1000
+	}
+
+	s := &VesSink{
+		cfg:        cfg,
+		httpClient: &http.Client{Timeout: 5 * time.Second},
+		events:     make(chan vesEvent, cfg.QueueSize),
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+		alarms:     make(map[int]*vesAlarmState),
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	go s.run()
+	return s
+}
+
+// Notify queues the VES fault event of the alarm notification. The event is dropped if the queue is full.
+// Acknowledgements are not sent, VES fault events don't carry them.
+func (s *VesSink) Notify(m AlarmNotification) {
+	if m.AlarmAction == AlarmActionAck {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return
+	}
+
+	select {
+	case s.events <- s.newEvent(m):
+	default:
+		app.Logger.Warn("VES event queue full, dropping event of alarm (sp=%d id=%d)", m.SpecificProblem, m.AlarmId)
+	}
+}
+
+// Close stops the sink. The ongoing post is cancelled, and the queued events are dropped without posting.
+func (s *VesSink) Close() {
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		return
+	}
+	s.closed = true
+	close(s.stop)
+	s.cancel()
+	close(s.events)
+	s.mutex.Unlock()
+	<-s.done
+}
+
+// newEvent maps the alarm notification to a VES fault event. Called with the mutex locked.
+func (s *VesSink) newEvent(m AlarmNotification) vesEvent {
+	lastEpoch := m.AlarmTime / 1000
+	if lastEpoch == 0 {
+		lastEpoch = time.Now().UnixNano() / 1000
+	}
+
+	state, ok := s.alarms[m.AlarmId]
+	if !ok {
+		state = &vesAlarmState{startEpoch: lastEpoch}
+		s.alarms[m.AlarmId] = state
+	}
+	state.sequence++
+
+	severity := vesSeverity(m.PerceivedSeverity)
+	if m.AlarmAction == alarm.AlarmActionClear {
+		severity = "NORMAL"
+		delete(s.alarms, m.AlarmId)
+	}
+
+	condition := m.AlarmText
+	if condition == "" {
+		if def, ok := alarm.RICAlarmDefinitions[m.SpecificProblem]; ok {
+			condition = def.AlarmText
+		}
+	}
+	if condition == "" {
+		condition = fmt.Sprintf("RIC alarm %d", m.SpecificProblem)
+	}
+
+	info := map[string]string{
+		"alarmId":         strconv.Itoa(m.AlarmId),
+		"applicationId":   m.ApplicationId,
+		"identifyingInfo": m.IdentifyingInfo,
+		"additionalInfo":  m.AdditionalInfo,
+	}
+	if m.ProbableCause != "" {
+		info["probableCause"] = m.ProbableCause
+	}
+	if len(m.ProposedRepairActions) > 0 {
+		info["proposedRepairActions"] = strings.Join(m.ProposedRepairActions, "; ")
+	}
+	for k, v := range m.AdditionalAttributes {
+		info[k] = v
+	}
+
+	return vesEvent{
+		CommonEventHeader: vesCommonEventHeader{
+			Domain:                  "fault",
+			EventId:                 fmt.Sprintf("ric-alarm-%d", m.AlarmId),
+			EventName:               "Fault_RIC_" + strings.ReplaceAll(condition, " ", "_"),
+			EventType:               m.EventType,
+			Sequence:                state.sequence,
+			Priority:                vesPriority(m.PerceivedSeverity),
+			ReportingEntityName:     s.cfg.ReportingEntityName,
+			SourceName:              m.ManagedObjectId,
+			NfVendorName:            "O-RAN-SC",
+			StartEpochMicrosec:      state.startEpoch,
+			LastEpochMicrosec:       lastEpoch,
+			Version:                 "4.1",
+			VesEventListenerVersion: "7.2.1",
+		},
+		FaultFields: vesFaultFields{
+			FaultFieldsVersion:         "4.0",
+			AlarmCondition:             condition,
+			SpecificProblem:            strconv.Itoa(m.SpecificProblem),
+			EventSeverity:              severity,
+			EventSourceType:            "RIC",
+			VfStatus:                   "Active",
+			AlarmInterfaceA:            m.IdentifyingInfo,
+			AlarmAdditionalInformation: info,
+		},
+	}
+}
+
+func vesSeverity(severity alarm.Severity) string {
+	switch severity {
+	case alarm.SeverityCritical, alarm.SeverityMajor, alarm.SeverityMinor, alarm.SeverityWarning:
+		return string(severity)
+	case alarm.SeverityCleared:
+		return "NORMAL"
+	}
+	return "WARNING"
+}
+
+func vesPriority(severity alarm.Severity) string {
+	switch severity {
+	case alarm.SeverityCritical:
+		return "High"
+	case alarm.SeverityMajor:
+		return "Medium"
+	}
+	return "Normal"
+}
+
+// run collects the queued events into batches, which are sent once full or after the batch interval
+func (s *VesSink) run() {
+	defer close(s.done)
+	ticker := time.NewTicker(s.cfg.BatchInterval)
+	defer ticker.Stop()
+
+	batch := make([]vesEvent, 0, s.cfg.BatchSize)
+	for {
+		select {
+		case <-s.stop:
+			s.discard(batch)
+			return
+		case e, ok := <-s.events:
+			if !ok {
+				s.discard(batch)
+				return
+			}
+			batch = append(batch, e)
+			if len(batch) >= s.cfg.BatchSize {
+				s.send(batch)
+				batch = make([]vesEvent, 0, s.cfg.BatchSize)
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				s.send(batch)
+				batch = make([]vesEvent, 0, s.cfg.BatchSize)
+			}
+		}
+	}
+}
+
+// discard drops the events not sent when the sink is stopped
+func (s *VesSink) discard(batch []vesEvent) {
+	n := len(batch)
+	for range s.events {
+		n++
+	}
+	if n > 0 {
+		app.Logger.Error("VES sink stopped, %d queued VES events not sent", n)
+	}
+}
+
+// send posts a single event to the event listener URL, and several events to the eventBatch URL.
+// The post is retried with doubling interval, up to the maximum retry interval, until the sink is stopped.
+func (s *VesSink) send(batch []vesEvent) {
+	if len(batch) == 0 {
+		return
+	}
+
+	url := s.cfg.Url
+	var body interface{} = map[string]interface{}{"event": batch[0]}
+	if len(batch) > 1 {
+		url = strings.TrimSuffix(s.cfg.Url, "/") + "/eventBatch"
+		body = map[string]interface{}{"eventList": batch}
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		app.Logger.Error("VES event json.Marshal failed: %v", err)
+		return
+	}
+
+	interval := s.cfg.RetryInterval
+	for attempt := 0; ; attempt++ {
+		if err = s.post(s.ctx, url, data); err == nil {
+			return
+		}
+		if attempt >= s.cfg.MaxRetries {
+			break
+		}
+		app.Logger.Info("Unable to post VES events to '%s': %v, retrying in %v", url, err, interval)
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-s.stop:
+			timer.Stop()
+			app.Logger.Error("Unable to post %d VES events to '%s' before close: %v", len(batch), url, err)
+			return
+		case <-timer.C:
+		}
+
+		if interval *= 2; interval > s.cfg.MaxRetryInterval {
+			interval = s.cfg.MaxRetryInterval
+		}
+	}
+	app.Logger.Error("Unable to post %d VES events to '%s': %v", len(batch), url, err)
+}
+
+func (s *VesSink) post(ctx context.Context, url string, data []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.cfg.User != "" {
+		req.SetBasicAuth(s.cfg.User, s.cfg.Password)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("HttpError=%s", resp.Status)
+	}
+	return nil
+}
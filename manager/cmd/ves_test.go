@@ -0,0 +1,173 @@
+/*
+ *  Copyright (c) 2020 AT&T Intellectual Property.
+ *  Copyright (c) 2020 Nokia.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ * This source code is part of the near-RT RIC (RAN Intelligent Controller)
+ * platform project (RICP).
+ */
+
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/alarm-go.git/alarm"
+	"github.com/stretchr/testify/assert"
+)
+
+// vesCollector is a VES collector recording the events posted to it, and failing the given number of posts first
+type vesCollector struct {
+	*recordingServer
+}
+
+func newVesCollector(failures int) *vesCollector {
+	c := &vesCollector{newRecordingServer(respondStatus(http.StatusAccepted))}
+	c.failNext(failures)
+	return c
+}
+
+func (c *vesCollector) events() []vesEvent {
+	events := []vesEvent{}
+	for _, body := range decodeBodies[struct {
+		Event     *vesEvent  `json:"event"`
+		EventList []vesEvent `json:"eventList"`
+	}](c.received("POST")) {
+		if body.Event != nil {
+			events = append(events, *body.Event)
+		}
+		events = append(events, body.EventList...)
+	}
+	return events
+}
+
+func (c *vesCollector) paths() []string {
+	paths := []string{}
+	for _, r := range c.received("POST") {
+		paths = append(paths, r.Path)
+	}
+	return paths
+}
+
+func vesNotification(action alarm.AlarmAction, severity alarm.Severity) AlarmNotification {
+	m := AlarmNotification{}
+	m.Alarm = alarm.Alarm{ManagedObjectId: "my-pod", ApplicationId: "my-app", SpecificProblem: alarm.E2_CONNECTION_PROBLEM,
+		PerceivedSeverity: severity, IdentifyingInfo: "eth 0 1", AdditionalInfo: "Some App data"}
+	m.AlarmAction = action
+	m.AlarmTime = time.Now().UnixNano()
+	m.AlarmId = 42
+	m.AlarmText = "E2 CONNECTIVITY LOST TO E2NODE"
+	return m
+}
+
+func TestVesSinkFaultEvents(t *testing.T) {
+	c := newVesCollector(0)
+	defer c.close()
+	s := NewVesSink(VesConfig{Url: c.url() + "/eventListener/v7", BatchSize: 3, BatchInterval: time.Hour})
+
+	raise := vesNotification(alarm.AlarmActionRaise, alarm.SeverityMajor)
+	s.Notify(raise)
+	s.Notify(vesNotification(alarm.AlarmActionUpdate, alarm.SeverityCritical))
+	s.Notify(vesNotification(alarm.AlarmActionClear, alarm.SeverityMajor))
+	assert.Eventually(t, func() bool { return len(c.events()) == 3 }, 5*time.Second, 10*time.Millisecond)
+	s.Close()
+
+	events := c.events()
+	assert.Equal(t, []string{"/eventListener/v7/eventBatch"}, c.paths())
+	for i, e := range events {
+		assert.Equal(t, "fault", e.CommonEventHeader.Domain)
+		assert.Equal(t, "ric-alarm-42", e.CommonEventHeader.EventId)
+		assert.Equal(t, i+1, e.CommonEventHeader.Sequence)
+		assert.Equal(t, raise.AlarmTime/1000, e.CommonEventHeader.StartEpochMicrosec)
+		assert.Equal(t, "my-pod", e.CommonEventHeader.SourceName)
+		assert.Equal(t, "E2 CONNECTIVITY LOST TO E2NODE", e.FaultFields.AlarmCondition)
+		assert.Equal(t, "72004", e.FaultFields.SpecificProblem)
+	}
+	assert.Equal(t, "MAJOR", events[0].FaultFields.EventSeverity)
+	assert.Equal(t, "CRITICAL", events[1].FaultFields.EventSeverity)
+	assert.Equal(t, "High", events[1].CommonEventHeader.Priority)
+	assert.Equal(t, "NORMAL", events[2].FaultFields.EventSeverity)
+
+	// Sequence starts again once the alarm has been cleared
+	assert.Equal(t, 0, len(s.alarms))
+}
+
+func TestVesSinkRetry(t *testing.T) {
+	c := newVesCollector(2)
+	defer c.close()
+	s := NewVesSink(VesConfig{Url: c.url(), MaxRetries: 2, RetryInterval: 10 * time.Millisecond, BatchInterval: 10 * time.Millisecond})
+
+	s.Notify(vesNotification(alarm.AlarmActionRaise, alarm.SeverityMajor))
+	assert.Eventually(t, func() bool { return len(c.events()) == 1 }, 5*time.Second, 10*time.Millisecond)
+	s.Close()
+
+	assert.Equal(t, []string{"/"}, c.paths())
+	assert.Equal(t, 1, c.events()[0].CommonEventHeader.Sequence)
+
+	// No events accepted after close
+	s.Notify(vesNotification(alarm.AlarmActionClear, alarm.SeverityMajor))
+	assert.Equal(t, 1, len(c.events()))
+}
+
+func TestVesSinkRetryBackoff(t *testing.T) {
+	c := newVesCollector(1000)
+	defer c.close()
+	s := NewVesSink(VesConfig{Url: c.url(), MaxRetries: 1000, RetryInterval: 10 * time.Millisecond,
+		MaxRetryInterval: 20 * time.Millisecond, BatchInterval: 10 * time.Millisecond})
+
+	// The retry interval is capped, i.e. the collector is tried several times within a short time
+	s.Notify(vesNotification(alarm.AlarmActionRaise, alarm.SeverityMajor))
+	assert.Eventually(t, func() bool {
+		return c.failuresLeft() <= 990
+	}, 2*time.Second, 10*time.Millisecond)
+
+	// Close doesn't wait for the retries to end
+	closed := make(chan struct{})
+	go func() {
+		s.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Error("VES sink not closed while retrying")
+	}
+	assert.Equal(t, 0, len(c.events()))
+}
+
+func TestAlarmManagerCloseSinks(t *testing.T) {
+	// The collector accepts the connection but never answers
+	release := make(chan struct{})
+	c := &vesCollector{newRecordingServer(func(w http.ResponseWriter, r recordedRequest) {
+		<-release
+	})}
+	defer c.close()
+	defer close(release)
+	s := NewVesSink(VesConfig{Url: c.url(), BatchInterval: 10 * time.Millisecond})
+	a := &AlarmManager{sinks: []AlarmSink{s}}
+
+	for i := 0; i < 3; i++ {
+		m := vesNotification(alarm.AlarmActionRaise, alarm.SeverityMajor)
+		a.NotifySinks(&m)
+	}
+	assert.Eventually(t, func() bool { return len(c.received("POST")) == 1 }, time.Second, 10*time.Millisecond)
+
+	// On shutdown the ongoing post is cancelled, and the queued events are not posted
+	start := time.Now()
+	a.Close()
+	assert.True(t, time.Since(start) < time.Second, "alarm manager close should not wait for the VES collector")
+	assert.Equal(t, 1, len(c.received("POST")))
+}
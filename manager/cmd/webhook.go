@@ -0,0 +1,470 @@
+/*
+ *  Copyright (c) 2020 AT&T Intellectual Property.
+ *  Copyright (c) 2020 Nokia.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ * This source code is part of the near-RT RIC (RAN Intelligent Controller)
+ * platform project (RICP).
+ */
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/alarm-go.git/alarm"
+	app "gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/xapp"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/viper"
+)
+
+// WebhookConfig is the configuration of a webhook sink, see controls.webhooks in config-file.json.
+// The intervals and the timeout are given in milliseconds.
+type WebhookConfig struct {
+	Name           string            `mapstructure:"name"`
+	Url            string            `mapstructure:"url"`
+	Headers        map[string]string `mapstructure:"headers"`
+	User           string            `mapstructure:"user"`
+	Password       string            `mapstructure:"password"`
+	BearerToken    string            `mapstructure:"bearerToken"`
+	Template       string            `mapstructure:"template"`
+	Actions        []string          `mapstructure:"actions"`
+	Timeout        int               `mapstructure:"timeout"`
+	MaxRetries     int               `mapstructure:"maxRetries"`
+	RetryInterval  int               `mapstructure:"retryInterval"`
+	QueueSize      int               `mapstructure:"queueSize"`
+	DeadLetterFile string            `mapstructure:"deadLetterFile"`
+	DeadLetterSize int               `mapstructure:"deadLetterSize"`
+}
+
+// DeadLetter is a notification not delivered to the webhook after all retries
+type DeadLetter struct {
+	Id          int               `json:"id"`
+	Time        int64             `json:"time"`
+	AlarmId     int               `json:"alarmId"`
+	AlarmAction alarm.AlarmAction `json:"alarmAction"`
+	Body        string            `json:"body"`
+	Error       string            `json:"error"`
+}
+
+// WebhookStatus is the state of a webhook sink returned via REST
+type WebhookStatus struct {
+	Name        string `json:"name"`
+	Url         string `json:"url"`
+	DeadLetters int    `json:"deadLetters"`
+}
+
+// WebhookSink posts the alarm notifications to a webhook. The body is built with a Go template from the
+// AlarmNotification, by default the notification is posted as JSON. Failed posts are retried with doubling
+// interval, and finally stored in the dead-letter queue, which can be replayed via REST.
+type WebhookSink struct {
+	cfg          WebhookConfig
+	template     *template.Template
+	actions      map[alarm.AlarmAction]bool
+	httpClient   *http.Client
+	notification chan AlarmNotification
+	stop         chan struct{}
+	done         chan struct{}
+	ctx          context.Context
+	cancel       context.CancelFunc
+	deadLetters  []DeadLetter
+	nextId       int
+	closed       bool
+	mutex        sync.Mutex
+}
+
+var (
+	webhookDeliveries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "alarm_manager",
+		Name:      "webhook_deliveries_total",
+		Help:      "The total number of notifications delivered to the webhook",
+	}, []string{"sink"})
+	webhookFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "alarm_manager",
+		Name:      "webhook_failures_total",
+		Help:      "The total number of notifications not delivered to the webhook after all retries",
+	}, []string{"sink"})
+	webhookRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "alarm_manager",
+		Name:      "webhook_retries_total",
+		Help:      "The total number of retried webhook posts",
+	}, []string{"sink"})
+	webhookDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "alarm_manager",
+		Name:      "webhook_dropped_total",
+		Help:      "The total number of notifications dropped because the webhook queue is full",
+	}, []string{"sink"})
+	webhookDeadLetters = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "alarm_manager",
+		Name:      "webhook_dead_letters",
+		Help:      "The number of notifications in the dead-letter queue of the webhook",
+	}, []string{"sink"})
+	webhookLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "alarm_manager",
+		Name:      "webhook_delivery_duration_seconds",
+		Help:      "The time taken to post a notification to the webhook",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"sink"})
+)
+
+func init() {
+	webhookDeliveries = registerMetric(webhookDeliveries)
+	webhookFailures = registerMetric(webhookFailures)
+	webhookRetries = registerMetric(webhookRetries)
+	webhookDropped = registerMetric(webhookDropped)
+	webhookDeadLetters = registerMetric(webhookDeadLetters)
+	webhookLatency = registerMetric(webhookLatency)
+}
+
+var webhookTemplateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"time": func(t int64) string {
+		return time.Unix(0, t).UTC().Format(time.RFC3339)
+	},
+}
+
+// ReadWebhookConfigs reads the webhook sink configurations. The dead-letter queues are persisted next to
+// the alarm info file, unless given.
+func ReadWebhookConfigs(alarmInfoPvFile string) []WebhookConfig {
+	var cfgs []WebhookConfig
+	if err := viper.UnmarshalKey("controls.webhooks", &cfgs); err != nil {
+		app.Logger.Error("Invalid webhook configuration: %v", err)
+		return nil
+	}
+
+	for i := range cfgs {
+		if cfgs[i].DeadLetterFile == "" && alarmInfoPvFile != "" {
+			cfgs[i].DeadLetterFile = filepath.Join(filepath.Dir(alarmInfoPvFile), fmt.Sprintf("webhook-%s-dlq.json", cfgs[i].Name))
+		}
+	}
+	return cfgs
+}
+
+// NewWebhookSink starts the webhook sink. Zero values of the configuration are replaced with the defaults.
+func NewWebhookSink(cfg WebhookConfig) (*WebhookSink, error) {
+	if cfg.Name == "" || cfg.Url == "" {
+		return nil, fmt.Errorf("webhook name and url are mandatory")
+	}
+	if cfg.Template == "" {
+		cfg.Template = "{{json .}}"
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 5000
+	}
+	if cfg.RetryInterval <= 0 {
+		cfg.RetryInterval = 1000
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 1000
+	}
+	if cfg.DeadLetterSize <= 0 {
+		cfg.DeadLetterSize = 1000
+	}
+
+	tmpl, err := template.New(cfg.Name).Funcs(webhookTemplateFuncs).Parse(cfg.Template)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template of webhook '%s': %v", cfg.Name, err)
+	}
+
+	s := &WebhookSink{
+		cfg:          cfg,
+		template:     tmpl,
+		actions:      make(map[alarm.AlarmAction]bool),
+		httpClient:   &http.Client{Timeout: time.Duration(cfg.Timeout) * time.Millisecond},
+		notification: make(chan AlarmNotification, cfg.QueueSize),
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+		deadLetters:  make([]DeadLetter, 0),
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	for _, action := range cfg.Actions {
+		s.actions[alarm.AlarmAction(strings.ToUpper(action))] = true
+	}
+	s.readDeadLetters()
+
+	go s.run()
+	return s, nil
+}
+
+// Notify queues the alarm notification. The notification is dropped if the queue is full.
+func (s *WebhookSink) Notify(m AlarmNotification) {
+	if len(s.actions) > 0 && !s.actions[m.AlarmAction] {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return
+	}
+
+	select {
+	case s.notification <- m:
+	default:
+		webhookDropped.WithLabelValues(s.cfg.Name).Inc()
+		app.Logger.Warn("Webhook '%s' queue full, dropping notification of alarm (sp=%d id=%d)", s.cfg.Name, m.SpecificProblem, m.AlarmId)
+	}
+}
+
+// Close stops the sink. The ongoing post is cancelled, and the notification being delivered and the queued
+// ones are stored to the dead-letter queue without posting.
+func (s *WebhookSink) Close() {
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		return
+	}
+	s.closed = true
+	close(s.stop)
+	s.cancel()
+	close(s.notification)
+	s.mutex.Unlock()
+	<-s.done
+}
+
+func (s *WebhookSink) run() {
+	defer close(s.done)
+	for m := range s.notification {
+		var body bytes.Buffer
+		if err := s.template.Execute(&body, m); err != nil {
+			webhookFailures.WithLabelValues(s.cfg.Name).Inc()
+			app.Logger.Error("Webhook '%s' template failed for alarm (sp=%d id=%d): %v", s.cfg.Name, m.SpecificProblem, m.AlarmId, err)
+			continue
+		}
+
+		// Shutting down, the remaining notifications are not posted
+		select {
+		case <-s.stop:
+			app.Logger.Info("Webhook '%s' stopped, storing notification of alarm (sp=%d id=%d) to the dead-letter queue", s.cfg.Name, m.SpecificProblem, m.AlarmId)
+			s.addDeadLetter(DeadLetter{Time: time.Now().UnixNano(), AlarmId: m.AlarmId, AlarmAction: m.AlarmAction, Body: body.String(), Error: "webhook stopped"})
+			continue
+		default:
+		}
+
+		if err := s.deliver(body.Bytes()); err != nil {
+			webhookFailures.WithLabelValues(s.cfg.Name).Inc()
+			app.Logger.Error("Unable to post notification of alarm (sp=%d id=%d) to webhook '%s': %v", m.SpecificProblem, m.AlarmId, s.cfg.Name, err)
+			s.addDeadLetter(DeadLetter{Time: time.Now().UnixNano(), AlarmId: m.AlarmId, AlarmAction: m.AlarmAction, Body: body.String(), Error: err.Error()})
+		}
+	}
+}
+
+// deliver posts the body, and retries with doubling interval until the sink is stopped
+func (s *WebhookSink) deliver(body []byte) error {
+	interval := time.Duration(s.cfg.RetryInterval) * time.Millisecond
+	for attempt := 0; ; attempt++ {
+		err := s.post(s.ctx, body)
+		if err == nil {
+			webhookDeliveries.WithLabelValues(s.cfg.Name).Inc()
+			return nil
+		}
+		if attempt >= s.cfg.MaxRetries {
+			return err
+		}
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-s.stop:
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		webhookRetries.WithLabelValues(s.cfg.Name).Inc()
+		interval *= 2
+	}
+}
+
+func (s *WebhookSink) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.cfg.Url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range s.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	if s.cfg.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+s.cfg.BearerToken)
+	} else if s.cfg.User != "" {
+		req.SetBasicAuth(s.cfg.User, s.cfg.Password)
+	}
+
+	start := time.Now()
+	resp, err := s.httpClient.Do(req)
+	webhookLatency.WithLabelValues(s.cfg.Name).Observe(time.Since(start).Seconds())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	ioutil.ReadAll(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("HttpError=%s", resp.Status)
+	}
+	return nil
+}
+
+// Status returns the name, URL and dead-letter count of the webhook
+func (s *WebhookSink) Status() WebhookStatus {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return WebhookStatus{Name: s.cfg.Name, Url: s.cfg.Url, DeadLetters: len(s.deadLetters)}
+}
+
+// DeadLetters returns the notifications in the dead-letter queue, the oldest first
+func (s *WebhookSink) DeadLetters() []DeadLetter {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]DeadLetter{}, s.deadLetters...)
+}
+
+// ReplayDeadLetters posts the notifications of the dead-letter queue once more. The delivered notifications
+// are removed from the queue. Returns the number of delivered and remaining notifications.
+func (s *WebhookSink) ReplayDeadLetters() (int, int) {
+	delivered := make(map[int]bool)
+	for _, d := range s.DeadLetters() {
+		if err := s.post(context.Background(), []byte(d.Body)); err != nil {
+			app.Logger.Info("Replay of dead letter %d to webhook '%s' failed: %v", d.Id, s.cfg.Name, err)
+			continue
+		}
+		webhookDeliveries.WithLabelValues(s.cfg.Name).Inc()
+		delivered[d.Id] = true
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	remaining := make([]DeadLetter, 0, len(s.deadLetters))
+	for _, d := range s.deadLetters {
+		if !delivered[d.Id] {
+			remaining = append(remaining, d)
+		}
+	}
+	s.deadLetters = remaining
+	s.writeDeadLetters()
+	return len(delivered), len(remaining)
+}
+
+// PurgeDeadLetters empties the dead-letter queue
+func (s *WebhookSink) PurgeDeadLetters() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.deadLetters = make([]DeadLetter, 0)
+	s.writeDeadLetters()
+}
+
+// addDeadLetter stores the notification to the dead-letter queue. The oldest notification is dropped if the queue is full.
+func (s *WebhookSink) addDeadLetter(d DeadLetter) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.nextId++
+	d.Id = s.nextId
+	s.deadLetters = append(s.deadLetters, d)
+	if len(s.deadLetters) > s.cfg.DeadLetterSize {
+		app.Logger.Warn("Webhook '%s' dead-letter queue full, dropping the oldest notification", s.cfg.Name)
+		s.deadLetters = s.deadLetters[len(s.deadLetters)-s.cfg.DeadLetterSize:]
+	}
+	s.writeDeadLetters()
+}
+
+func (s *WebhookSink) readDeadLetters() {
+	if s.cfg.DeadLetterFile == "" {
+		return
+	}
+
+	data, err := ioutil.ReadFile(s.cfg.DeadLetterFile)
+	if err != nil {
+		app.Logger.Info("Unable to read dead letters of webhook '%s': %v", s.cfg.Name, err)
+		return
+	}
+	if err := json.Unmarshal(data, &s.deadLetters); err != nil {
+		app.Logger.Error("Dead letters of webhook '%s' json unmarshal error %v", s.cfg.Name, err)
+		s.deadLetters = make([]DeadLetter, 0)
+	}
+	for _, d := range s.deadLetters {
+		if d.Id > s.nextId {
+			s.nextId = d.Id
+		}
+	}
+	webhookDeadLetters.WithLabelValues(s.cfg.Name).Set(float64(len(s.deadLetters)))
+}
+
+// writeDeadLetters persists the dead-letter queue. Called with the mutex locked.
+func (s *WebhookSink) writeDeadLetters() {
+	webhookDeadLetters.WithLabelValues(s.cfg.Name).Set(float64(len(s.deadLetters)))
+	if s.cfg.DeadLetterFile == "" {
+		return
+	}
+
+	data, err := json.MarshalIndent(s.deadLetters, "", " ")
+	if err != nil {
+		app.Logger.Error("Dead letters of webhook '%s' json marshal error %v", s.cfg.Name, err)
+		return
+	}
+	if err := ioutil.WriteFile(s.cfg.DeadLetterFile, data, 0644); err != nil {
+		app.Logger.Error("Dead letters of webhook '%s' file write error %v", s.cfg.Name, err)
+	}
+}
+
+func (a *AlarmManager) GetWebhooks(w http.ResponseWriter, r *http.Request) {
+	webhooks := make([]WebhookStatus, 0, len(a.webhooks))
+	for _, s := range a.webhooks {
+		webhooks = append(webhooks, s.Status())
+	}
+	a.respondWithJSON(w, http.StatusOK, webhooks)
+}
+
+func (a *AlarmManager) GetDeadLetters(w http.ResponseWriter, r *http.Request) {
+	if s := a.webhookFromPath(w, r); s != nil {
+		a.respondWithJSON(w, http.StatusOK, s.DeadLetters())
+	}
+}
+
+func (a *AlarmManager) ReplayDeadLetters(w http.ResponseWriter, r *http.Request) {
+	if s := a.webhookFromPath(w, r); s != nil {
+		delivered, remaining := s.ReplayDeadLetters()
+		app.Logger.Info("Dead letters of webhook '%s' replayed: %d delivered, %d remaining", s.cfg.Name, delivered, remaining)
+		a.respondWithJSON(w, http.StatusOK, map[string]int{"delivered": delivered, "remaining": remaining})
+	}
+}
+
+func (a *AlarmManager) PurgeDeadLetters(w http.ResponseWriter, r *http.Request) {
+	if s := a.webhookFromPath(w, r); s != nil {
+		s.PurgeDeadLetters()
+		a.respondWithJSON(w, http.StatusOK, nil)
+	}
+}
+
+func (a *AlarmManager) webhookFromPath(w http.ResponseWriter, r *http.Request) *WebhookSink {
+	name := mux.Vars(r)["name"]
+	for _, s := range a.webhooks {
+		if s.cfg.Name == name {
+			return s
+		}
+	}
+	a.respondWithError(w, http.StatusNotFound, "Non existent webhook")
+	return nil
+}
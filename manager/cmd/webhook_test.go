@@ -0,0 +1,207 @@
+/*
+ *  Copyright (c) 2020 AT&T Intellectual Property.
+ *  Copyright (c) 2020 Nokia.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ * This source code is part of the near-RT RIC (RAN Intelligent Controller)
+ * platform project (RICP).
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/alarm-go.git/alarm"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// newWebhookReceiver returns a webhook receiver recording the notifications posted to it
+func newWebhookReceiver() *recordingServer {
+	return newRecordingServer(nil)
+}
+
+func TestWebhookSinkTemplate(t *testing.T) {
+	h := newWebhookReceiver()
+	defer h.close()
+
+	s, err := NewWebhookSink(WebhookConfig{
+		Name:        "template",
+		Url:         h.url(),
+		Headers:     map[string]string{"X-Source": "ric"},
+		BearerToken: "secret",
+		Template:    `{"id": {{.AlarmId}}, "action": "{{.AlarmAction}}", "severity": "{{.PerceivedSeverity}}", "time": "{{time .AlarmTime}}"}`,
+		Actions:     []string{"raise", "clear"},
+	})
+	assert.Nil(t, err)
+	s.Notify(vesNotification(alarm.AlarmActionRaise, alarm.SeverityMajor))
+	s.Notify(vesNotification(alarm.AlarmActionUpdate, alarm.SeverityCritical))
+	s.Notify(vesNotification(alarm.AlarmActionClear, alarm.SeverityCritical))
+	assert.Eventually(t, func() bool { return len(h.received("POST")) == 2 }, time.Second, 10*time.Millisecond)
+	s.Close()
+
+	bodies := h.received("POST")
+	assert.Equal(t, 2, len(bodies))
+	var body map[string]interface{}
+	assert.Nil(t, json.Unmarshal(bodies[0].Body, &body))
+	assert.Equal(t, float64(42), body["id"])
+	assert.Equal(t, "RAISE", body["action"])
+	assert.Equal(t, "MAJOR", body["severity"])
+	assert.Equal(t, "Bearer secret", bodies[0].Header.Get("Authorization"))
+	assert.Equal(t, "ric", bodies[0].Header.Get("X-Source"))
+	assert.Equal(t, float64(2), testutil.ToFloat64(webhookDeliveries.WithLabelValues("template")))
+
+	_, err = NewWebhookSink(WebhookConfig{Name: "invalid", Url: h.url(), Template: "{{.AlarmId"})
+	assert.NotNil(t, err)
+}
+
+func TestWebhookSinkDeadLetters(t *testing.T) {
+	h := newWebhookReceiver()
+	defer h.close()
+	h.setFail(true)
+
+	cfg := WebhookConfig{Name: "dlq", Url: h.url(), MaxRetries: 2, RetryInterval: 10, DeadLetterFile: filepath.Join(t.TempDir(), "dlq.json")}
+	s, err := NewWebhookSink(cfg)
+	assert.Nil(t, err)
+	s.Notify(vesNotification(alarm.AlarmActionRaise, alarm.SeverityMajor))
+	s.Notify(vesNotification(alarm.AlarmActionClear, alarm.SeverityMajor))
+	assert.Eventually(t, func() bool { return len(s.DeadLetters()) == 2 }, 5*time.Second, 10*time.Millisecond)
+	s.Close()
+
+	assert.Equal(t, 2, len(s.DeadLetters()))
+	assert.Equal(t, alarm.AlarmActionRaise, s.DeadLetters()[0].AlarmAction)
+	assert.Equal(t, float64(4), testutil.ToFloat64(webhookRetries.WithLabelValues("dlq")))
+	assert.Equal(t, float64(2), testutil.ToFloat64(webhookFailures.WithLabelValues("dlq")))
+	assert.Equal(t, float64(2), testutil.ToFloat64(webhookDeadLetters.WithLabelValues("dlq")))
+
+	// Dead letters are persisted, and replayed once the webhook is available
+	s, err = NewWebhookSink(cfg)
+	assert.Nil(t, err)
+	defer s.Close()
+	assert.Equal(t, 2, s.Status().DeadLetters)
+
+	delivered, remaining := s.ReplayDeadLetters()
+	assert.Equal(t, 0, delivered)
+	assert.Equal(t, 2, remaining)
+
+	h.setFail(false)
+	delivered, remaining = s.ReplayDeadLetters()
+	assert.Equal(t, 2, delivered)
+	assert.Equal(t, 0, remaining)
+	assert.Equal(t, 2, len(h.received("POST")))
+
+	var n AlarmNotification
+	assert.Nil(t, json.Unmarshal(h.received("POST")[0].Body, &n))
+	assert.Equal(t, 42, n.AlarmId)
+	assert.Equal(t, float64(0), testutil.ToFloat64(webhookDeadLetters.WithLabelValues("dlq")))
+}
+
+func TestWebhookSinkCloseWhileRetrying(t *testing.T) {
+	h := newWebhookReceiver()
+	defer h.close()
+	h.setFail(true)
+
+	// The notifications pending on close are stored to the dead-letter file without waiting for the retries
+	cfg := WebhookConfig{Name: "close", Url: h.url(), MaxRetries: 10, RetryInterval: 60000, DeadLetterFile: filepath.Join(t.TempDir(), "dlq.json")}
+	s, err := NewWebhookSink(cfg)
+	assert.Nil(t, err)
+	s.Notify(vesNotification(alarm.AlarmActionRaise, alarm.SeverityMajor))
+	s.Notify(vesNotification(alarm.AlarmActionClear, alarm.SeverityMajor))
+
+	closed := make(chan struct{})
+	go func() {
+		s.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Webhook sink not closed while retrying")
+	}
+
+	s, err = NewWebhookSink(cfg)
+	assert.Nil(t, err)
+	defer s.Close()
+	assert.Equal(t, 2, len(s.DeadLetters()))
+}
+
+func TestWebhookSinkCloseWithUnreachableEndpoint(t *testing.T) {
+	// The endpoint accepts the connection but never answers
+	release := make(chan struct{})
+	h := newRecordingServer(func(w http.ResponseWriter, r recordedRequest) {
+		<-release
+	})
+	defer h.close()
+	defer close(release)
+
+	cfg := WebhookConfig{Name: "unreachable", Url: h.url(), Timeout: 5000, DeadLetterFile: filepath.Join(t.TempDir(), "dlq.json")}
+	s, err := NewWebhookSink(cfg)
+	assert.Nil(t, err)
+	for i := 0; i < 3; i++ {
+		s.Notify(vesNotification(alarm.AlarmActionRaise, alarm.SeverityMajor))
+	}
+	assert.Eventually(t, func() bool { return len(h.received("POST")) == 1 }, time.Second, 10*time.Millisecond)
+
+	// The ongoing post is cancelled, and the queued notifications are not posted
+	start := time.Now()
+	s.Close()
+	assert.True(t, time.Since(start) < time.Second, "webhook sink close should not wait for the endpoint")
+	assert.Equal(t, 3, len(s.DeadLetters()))
+	assert.Equal(t, 1, len(h.received("POST")))
+}
+
+func TestWebhookRESTInterface(t *testing.T) {
+	h := newWebhookReceiver()
+	defer h.close()
+	h.setFail(true)
+
+	s, _ := NewWebhookSink(WebhookConfig{Name: "rest", Url: h.url()})
+	s.Notify(vesNotification(alarm.AlarmActionRaise, alarm.SeverityMajor))
+	s.Close()
+	alarmManager.webhooks = []*WebhookSink{s}
+	defer func() { alarmManager.webhooks = nil }()
+
+	req, _ := http.NewRequest("GET", "/ric/v1/webhooks", nil)
+	rr := executeRequest(req, alarmManager.GetWebhooks)
+	checkResponseCode(t, http.StatusOK, rr.Code)
+	var webhooks []WebhookStatus
+	json.NewDecoder(rr.Body).Decode(&webhooks)
+	assert.Equal(t, []WebhookStatus{{Name: "rest", Url: h.url(), DeadLetters: 1}}, webhooks)
+
+	req, _ = http.NewRequest("GET", "/ric/v1/webhooks/rest/deadletters", nil)
+	req = mux.SetURLVars(req, map[string]string{"name": "rest"})
+	rr = executeRequest(req, alarmManager.GetDeadLetters)
+	var deadLetters []DeadLetter
+	json.NewDecoder(rr.Body).Decode(&deadLetters)
+	assert.Equal(t, 1, len(deadLetters))
+
+	h.setFail(false)
+	req, _ = http.NewRequest("POST", "/ric/v1/webhooks/rest/deadletters/replay", nil)
+	req = mux.SetURLVars(req, map[string]string{"name": "rest"})
+	rr = executeRequest(req, alarmManager.ReplayDeadLetters)
+	checkResponseCode(t, http.StatusOK, rr.Code)
+	var result map[string]int
+	json.NewDecoder(rr.Body).Decode(&result)
+	assert.Equal(t, map[string]int{"delivered": 1, "remaining": 0}, result)
+
+	req, _ = http.NewRequest("DELETE", "/ric/v1/webhooks/foo/deadletters", nil)
+	req = mux.SetURLVars(req, map[string]string{"name": "foo"})
+	checkResponseCode(t, http.StatusNotFound, executeRequest(req, alarmManager.PurgeDeadLetters).Code)
+}